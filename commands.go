@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/cloudbase/garm-provider-oci/provider"
+)
+
+// commands are operator facing subcommands. GARM itself never passes
+// arguments and drives the provider through environment variables.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"drift":       driftCommand,
+	"lint":        lintCommand,
+	"maintenance": maintenanceCommand,
+	"recycle":     recycleCommand,
+	"remove-all":  removeAllCommand,
+	"spec":        specCommand,
+}
+
+// newCommandFlags returns a flag set with the flags shared by all commands.
+// They default to the variables GARM sets for the provider.
+func newCommandFlags(name string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cfgFile := fs.String("config", os.Getenv("GARM_PROVIDER_CONFIG_FILE"), "path to the provider config file")
+	controllerID := fs.String("controller-id", os.Getenv("GARM_CONTROLLER_ID"), "only consider instances of this GARM controller")
+	return fs, cfgFile, controllerID
+}
+
+func newCommandProvider(ctx context.Context, cfgFile, controllerID string) (*provider.OciProvider, error) {
+	if cfgFile == "" {
+		return nil, fmt.Errorf("missing -config")
+	}
+	return provider.NewOciProvider(ctx, cfgFile, controllerID)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// maintenanceCommand prints the runners that are scheduled for a maintenance
+// reboot.
+func maintenanceCommand(ctx context.Context, args []string) error {
+	fs, cfgFile, controllerID := newCommandFlags("maintenance")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	prov, err := newCommandProvider(ctx, *cfgFile, *controllerID)
+	if err != nil {
+		return fmt.Errorf("error creating provider: %w", err)
+	}
+	events, err := prov.PendingMaintenance(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(events)
+}
+
+// removeAllCommand terminates all instances of the controller or, with
+// -dry-run, prints the instances that would be terminated.
+func removeAllCommand(ctx context.Context, args []string) error {
+	fs, cfgFile, controllerID := newCommandFlags("remove-all")
+	dryRun := fs.Bool("dry-run", false, "only list the instances that would be terminated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	prov, err := newCommandProvider(ctx, *cfgFile, *controllerID)
+	if err != nil {
+		return fmt.Errorf("error creating provider: %w", err)
+	}
+	if !*dryRun {
+		return prov.RemoveAllInstances(ctx)
+	}
+	ids, err := prov.RemoveAllInstancesDryRun(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(ids)
+}
+
+// recycleCommand terminates the instances of a pool that are older than
+// -max-age and prints their OCIDs. GARM replaces them with new instances.
+func recycleCommand(ctx context.Context, args []string) error {
+	fs, cfgFile, controllerID := newCommandFlags("recycle")
+	poolID := fs.String("pool-id", "", "the pool to recycle the instances of")
+	maxAge := fs.Duration("max-age", 0, "terminate instances created longer ago than this, for example 24h")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *poolID == "" {
+		return fmt.Errorf("missing -pool-id")
+	}
+	prov, err := newCommandProvider(ctx, *cfgFile, *controllerID)
+	if err != nil {
+		return fmt.Errorf("error creating provider: %w", err)
+	}
+	ids, err := prov.RecycleStaleInstances(ctx, *poolID, *maxAge)
+	if err != nil {
+		return err
+	}
+	return printJSON(ids)
+}
+
+// readBootstrapParams decodes the bootstrap params from the given file, or
+// from stdin if it is "-".
+func readBootstrapParams(path string) (params.BootstrapInstance, error) {
+	input := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return params.BootstrapInstance{}, fmt.Errorf("error opening bootstrap params: %w", err)
+		}
+		defer f.Close()
+		input = f
+	}
+	var bootstrapParams params.BootstrapInstance
+	if err := json.NewDecoder(input).Decode(&bootstrapParams); err != nil {
+		return params.BootstrapInstance{}, fmt.Errorf("error decoding bootstrap params: %w", err)
+	}
+	return bootstrapParams, nil
+}
+
+// specCommand prints the spec an instance would be launched with for the
+// bootstrap params GARM would send, read from -bootstrap-params or stdin.
+func specCommand(ctx context.Context, args []string) error {
+	fs, cfgFile, controllerID := newCommandFlags("spec")
+	bootstrapFile := fs.String("bootstrap-params", "-", "path to a JSON file with the bootstrap params, - reads them from stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	bootstrapParams, err := readBootstrapParams(*bootstrapFile)
+	if err != nil {
+		return err
+	}
+	prov, err := newCommandProvider(ctx, *cfgFile, *controllerID)
+	if err != nil {
+		return fmt.Errorf("error creating provider: %w", err)
+	}
+	resolved, err := prov.GetRunnerSpec(ctx, bootstrapParams)
+	if err != nil {
+		return err
+	}
+	return printJSON(json.RawMessage(resolved))
+}
+
+// lintCommand validates the bootstrap params, read from -bootstrap-params or
+// stdin, against the config offline: neither the runner tools nor OCI are
+// contacted.
+func lintCommand(ctx context.Context, args []string) error {
+	fs, cfgFile, controllerID := newCommandFlags("lint")
+	bootstrapFile := fs.String("bootstrap-params", "-", "path to a JSON file with the bootstrap params, - reads them from stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *cfgFile == "" {
+		return fmt.Errorf("missing -config")
+	}
+	bootstrapParams, err := readBootstrapParams(*bootstrapFile)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.NewConfig(*cfgFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	return spec.ValidateBootstrapParams(cfg, bootstrapParams, *controllerID)
+}
+
+// driftCommand prints the instances of the pool that were launched with a
+// spec other than the one the bootstrap params currently resolve to.
+func driftCommand(ctx context.Context, args []string) error {
+	fs, cfgFile, controllerID := newCommandFlags("drift")
+	bootstrapFile := fs.String("bootstrap-params", "-", "path to a JSON file with the bootstrap params, - reads them from stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	bootstrapParams, err := readBootstrapParams(*bootstrapFile)
+	if err != nil {
+		return err
+	}
+	prov, err := newCommandProvider(ctx, *cfgFile, *controllerID)
+	if err != nil {
+		return fmt.Errorf("error creating provider: %w", err)
+	}
+	instances, err := prov.DriftedInstances(ctx, bootstrapParams)
+	if err != nil {
+		return err
+	}
+	return printJSON(instances)
+}
@@ -17,11 +17,45 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
+const (
+	defaultShapeCacheTTL       = time.Hour
+	defaultUserDataMetadataKey = "user_data"
+	defaultRegistrationTimeout = 10 * time.Minute
+	defaultRetryBaseDelay      = time.Second
+	defaultRetryMaxDelay       = 30 * time.Second
+	defaultLaunchTimeoutBase   = 5 * time.Minute
+	defaultLaunchTimeoutPerGB  = time.Second
+	defaultLaunchTimeoutMax    = 30 * time.Minute
+	defaultStoppingTimeout     = 5 * time.Minute
+	defaultRequestTimeout      = time.Minute
+)
+
+const (
+	// AuthMethodAPIKey signs requests with the API key of a user.
+	AuthMethodAPIKey = "api_key"
+	// AuthMethodInstancePrincipal signs requests as the OCI instance the
+	// provider runs on.
+	AuthMethodInstancePrincipal = "instance_principal"
+)
+
+const (
+	// StoppingOnDeleteWait waits for an instance caught in STOPPING to be
+	// STOPPED before terminating it.
+	StoppingOnDeleteWait = "wait"
+	// StoppingOnDeleteForce stops an instance caught in STOPPING right away
+	// before terminating it.
+	StoppingOnDeleteForce = "force"
+)
+
 func NewConfig(cfgFile string) (*Config, error) {
 	var config Config
 	if _, err := toml.DecodeFile(cfgFile, &config); err != nil {
@@ -39,12 +73,269 @@ type Config struct {
 	CompartmentId      string `toml:"compartment_id"`
 	SubnetID           string `toml:"subnet_id"`
 	NsgID              string `toml:"network_security_group_id"`
-	TenancyID          string `toml:"tenancy_id"`
-	UserID             string `toml:"user_id"`
-	Region             string `toml:"region"`
-	Fingerprint        string `toml:"fingerprint"`
-	PrivateKeyPath     string `toml:"private_key_path"`
+	NsgName            string `toml:"network_security_group_name"`
+	// AuthMethod selects how requests are authenticated, api_key (the
+	// default) or instance_principal. The tenancy, user, fingerprint and
+	// private key are only needed for api_key.
+	AuthMethod     string `toml:"auth_method"`
+	TenancyID      string `toml:"tenancy_id"`
+	UserID         string `toml:"user_id"`
+	Region         string `toml:"region"`
+	Fingerprint    string `toml:"fingerprint"`
+	PrivateKeyPath string `toml:"private_key_path"`
+	// PrivateKey is the PEM encoded private key, as an alternative to
+	// PrivateKeyPath.
+	PrivateKey         string `toml:"private_key"`
 	PrivateKeyPassword string `toml:"private_key_password"`
+	// PrivateKeyPasswordSecretID is the OCID of an OCI Vault secret holding
+	// the private key password, as an alternative to PrivateKeyPassword.
+	PrivateKeyPasswordSecretID string `toml:"private_key_password_secret_id"`
+	// CompartmentInstanceQuota caps the number of GARM instances, across all
+	// pools, that may exist in the compartment. A value of 0 disables the check.
+	CompartmentInstanceQuota int `toml:"compartment_instance_quota"`
+	// CheckTagDefaults enables a preflight that verifies the launch supplies
+	// all defined tags required by the tag defaults of the compartment.
+	CheckTagDefaults bool `toml:"check_tag_defaults"`
+	// ShapeCacheTTL controls how long the list of shapes available in the
+	// availability domain is cached, as a duration like 1h. Defaults to 1h.
+	ShapeCacheTTL string `toml:"shape_cache_ttl"`
+	// CheckSubnetCapacity enables a preflight that verifies the subnet still
+	// has a free private IP address before launching.
+	CheckSubnetCapacity bool `toml:"check_subnet_capacity"`
+	// ReuseBootVolumes preserves the boot volume of deleted instances and
+	// launches new instances of the same pool from it instead of the image.
+	ReuseBootVolumes bool `toml:"reuse_boot_volumes"`
+	// PreserveBootVolume keeps the boot volume of deleted instances. By
+	// default it is deleted with the instance.
+	PreserveBootVolume bool `toml:"preserve_boot_volume"`
+	// TagOnTerminate tags instances with GARM_TERMINATED_AT and
+	// GARM_TERMINATED_BY right before they are terminated.
+	TagOnTerminate bool `toml:"tag_on_terminate"`
+	// WebhookURL receives a JSON notification after an instance is created or
+	// deleted. Notifications are best-effort.
+	WebhookURL string `toml:"webhook_url"`
+	// AuditDir is the directory a JSON audit record of every launched
+	// instance is written to, as <instance id>.json. Records are
+	// best-effort.
+	AuditDir string `toml:"audit_dir"`
+	// UserDataMetadataKey is the instance metadata key the user data is
+	// passed in. Defaults to user_data.
+	UserDataMetadataKey string `toml:"user_data_metadata_key"`
+	// AdditionalRegions are listed for instances, concurrently with Region,
+	// for providers whose pools span several regions.
+	AdditionalRegions []string `toml:"additional_regions"`
+	// BootVolumeRetention is how long boot volumes must survive the
+	// termination of their instance, for compartments whose policy requires
+	// it, as a duration like 720h. Boot volumes are then always preserved and
+	// tagged with GARM_BOOT_VOLUME_EXPIRES_AT for later reaping.
+	BootVolumeRetention string `toml:"boot_volume_retention"`
+	// GarmAPIURL enables a post-launch gate that polls the GARM API until the
+	// runner registers. Instances whose runner doesn't register within
+	// RegistrationTimeout are terminated and the launch fails.
+	GarmAPIURL string `toml:"garm_api_url"`
+	// GarmAPIToken is the bearer token used to query the GARM API.
+	GarmAPIToken string `toml:"garm_api_token"`
+	// RegistrationTimeout is how long to wait for the runner to register,
+	// as a duration like 10m. Defaults to 10m.
+	RegistrationTimeout string `toml:"registration_timeout"`
+	// SoftResetOnFailedStart falls back to a SOFTRESET when starting an
+	// instance fails because of the state it is stuck in.
+	SoftResetOnFailedStart bool `toml:"soft_reset_on_failed_start"`
+	// StoppingOnDelete controls how deleting an instance that rejects the
+	// termination because it is STOPPING is handled: wait or force. The
+	// conflict is returned by default.
+	StoppingOnDelete string `toml:"stopping_on_delete"`
+	// StoppingTimeout is how long to wait for a STOPPING instance to be
+	// STOPPED, as a duration like 5m. Defaults to 5m.
+	StoppingTimeout string `toml:"stopping_timeout"`
+	// ToolsMirrorURL is the base URL of a mirror serving the runner
+	// binaries, for regions that can't reach GitHub. {region} is replaced
+	// by Region.
+	ToolsMirrorURL string `toml:"tools_mirror_url"`
+	// IdempotentCreate makes creating an instance return the instance of
+	// the same name and pool that is already running or launching, rather
+	// than launching a duplicate when GARM retries a create that timed out.
+	IdempotentCreate bool `toml:"idempotent_create"`
+	// RetryPolicy controls how OCI API calls that fail with a transient
+	// error are retried. Calls are not retried by default.
+	RetryPolicy RetryPolicy `toml:"retry_policy"`
+	// RequestTimeout bounds how long a single OCI API call may take, as a
+	// duration like 30s. Defaults to 1m.
+	RequestTimeout string `toml:"request_timeout"`
+	// WaitForRunning makes creating an instance wait for it to reach
+	// RUNNING, within LaunchTimeout. Instances that don't are terminated and
+	// the launch fails.
+	WaitForRunning bool `toml:"wait_for_running"`
+	// LaunchTimeout bounds how long to wait for a launched instance to
+	// reach RUNNING, scaled by the size of its boot volume.
+	LaunchTimeout LaunchTimeout `toml:"launch_timeout"`
+	// LaunchGracePeriod is how long a launched instance may stay
+	// PROVISIONING while waiting for it, as a duration like 3m, before the
+	// launch is considered failed. Unset, only LaunchTimeout applies.
+	LaunchGracePeriod string `toml:"launch_grace_period"`
+	// ValidateOnStart checks the settings that can only be checked against
+	// OCI, like the availability domain, when the provider starts.
+	ValidateOnStart bool `toml:"validate_on_start"`
+	// RateLimit caps the rate of the OCI API calls of the provider, to stay
+	// under the API limits of the tenancy. Calls are not limited by default.
+	RateLimit RateLimit `toml:"rate_limit"`
+}
+
+// RetryPolicy retries OCI API calls that fail with a 429 or 5xx status, with
+// a jittered exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a call is attempted. 0 and 1
+	// disable retries.
+	MaxAttempts int `toml:"max_attempts"`
+	// BaseDelay is the delay before the first retry, doubled for every
+	// following one, as a duration like 500ms. Defaults to 1s.
+	BaseDelay string `toml:"base_delay"`
+	// MaxDelay caps the delay between two attempts. Defaults to 30s.
+	MaxDelay string `toml:"max_delay"`
+}
+
+func (r RetryPolicy) validate() error {
+	if r.MaxAttempts < 0 {
+		return fmt.Errorf("retry_policy.max_attempts must not be negative")
+	}
+	delays := []struct{ name, value string }{
+		{"base_delay", r.BaseDelay},
+		{"max_delay", r.MaxDelay},
+	}
+	for _, d := range delays {
+		if d.value == "" {
+			continue
+		}
+		if delay, err := time.ParseDuration(d.value); err != nil || delay <= 0 {
+			return fmt.Errorf("retry_policy.%s must be a positive duration, like 500ms", d.name)
+		}
+	}
+	if r.BaseDelayDuration() > r.MaxDelayDuration() {
+		return fmt.Errorf("retry_policy.base_delay must not exceed retry_policy.max_delay")
+	}
+	return nil
+}
+
+// BaseDelayDuration returns the delay before the first retry.
+func (r RetryPolicy) BaseDelayDuration() time.Duration {
+	delay, err := time.ParseDuration(r.BaseDelay)
+	if err != nil || delay <= 0 {
+		return defaultRetryBaseDelay
+	}
+	return delay
+}
+
+// MaxDelayDuration returns the longest delay between two attempts.
+func (r RetryPolicy) MaxDelayDuration() time.Duration {
+	delay, err := time.ParseDuration(r.MaxDelay)
+	if err != nil || delay <= 0 {
+		return defaultRetryMaxDelay
+	}
+	return delay
+}
+
+// RateLimit is a token bucket shared by every OCI API call of the provider.
+type RateLimit struct {
+	// RequestsPerSecond is the rate the bucket refills at. 0 disables the
+	// rate limit.
+	RequestsPerSecond float64 `toml:"requests_per_second"`
+	// Burst is the number of calls that can be made at once. Defaults to
+	// RequestsPerSecond, rounded up.
+	Burst int `toml:"burst"`
+	// FailFast makes calls over the rate limit fail right away instead of
+	// waiting for a token.
+	FailFast bool `toml:"fail_fast"`
+}
+
+func (r RateLimit) validate() error {
+	if r.RequestsPerSecond < 0 {
+		return fmt.Errorf("rate_limit.requests_per_second must not be negative")
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("rate_limit.burst must not be negative")
+	}
+	return nil
+}
+
+// Enabled reports whether OCI API calls are rate limited.
+func (r RateLimit) Enabled() bool {
+	return r.RequestsPerSecond > 0
+}
+
+// BurstSize returns the number of calls that can be made at once.
+func (r RateLimit) BurstSize() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return max(int(math.Ceil(r.RequestsPerSecond)), 1)
+}
+
+// LaunchTimeout grows the time a launched instance is given to reach RUNNING
+// with its boot volume, as larger volumes take longer to provision.
+type LaunchTimeout struct {
+	// Base is the timeout for an instance without a boot volume, as a
+	// duration like 5m. Defaults to 5m.
+	Base string `toml:"base"`
+	// PerGB is added to the timeout for every GB of boot volume. Defaults
+	// to 1s.
+	PerGB string `toml:"per_gb"`
+	// Max caps the timeout. Defaults to 30m.
+	Max string `toml:"max"`
+}
+
+func (l LaunchTimeout) validate() error {
+	durations := []struct{ name, value string }{
+		{"base", l.Base},
+		{"max", l.Max},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration <= 0 {
+			return fmt.Errorf("launch_timeout.%s must be a positive duration, like 5m", d.name)
+		}
+	}
+	if l.PerGB != "" {
+		if duration, err := time.ParseDuration(l.PerGB); err != nil || duration < 0 {
+			return fmt.Errorf("launch_timeout.per_gb must be a duration that is not negative, like 1s")
+		}
+	}
+	if l.baseDuration() > l.maxDuration() {
+		return fmt.Errorf("launch_timeout.base must not exceed launch_timeout.max")
+	}
+	return nil
+}
+
+// For returns the timeout of an instance with a boot volume of the given
+// size in GBs.
+func (l LaunchTimeout) For(bootVolumeSizeInGBs int64) time.Duration {
+	timeout := l.baseDuration() + time.Duration(max(bootVolumeSizeInGBs, 0))*l.perGBDuration()
+	return min(timeout, l.maxDuration())
+}
+
+func (l LaunchTimeout) baseDuration() time.Duration {
+	duration, err := time.ParseDuration(l.Base)
+	if err != nil || duration <= 0 {
+		return defaultLaunchTimeoutBase
+	}
+	return duration
+}
+
+func (l LaunchTimeout) perGBDuration() time.Duration {
+	duration, err := time.ParseDuration(l.PerGB)
+	if err != nil || duration < 0 {
+		return defaultLaunchTimeoutPerGB
+	}
+	return duration
+}
+
+func (l LaunchTimeout) maxDuration() time.Duration {
+	duration, err := time.ParseDuration(l.Max)
+	if err != nil || duration <= 0 {
+		return defaultLaunchTimeoutMax
+	}
+	return duration
 }
 
 func (c *Config) Validate() error {
@@ -57,28 +348,245 @@ func (c *Config) Validate() error {
 	if c.SubnetID == "" {
 		return fmt.Errorf("subnet_id is required")
 	}
-	if c.NsgID == "" {
-		return fmt.Errorf("ngs_id is required")
+	if c.NsgID == "" && c.NsgName == "" {
+		return fmt.Errorf("network_security_group_id or network_security_group_name is required")
+	}
+	if err := checkOCID("compartment_id", c.CompartmentId, "compartment or tenancy", "compartment", "tenancy"); err != nil {
+		return err
+	}
+	if err := checkOCID("subnet_id", c.SubnetID, "subnet", "subnet"); err != nil {
+		return err
+	}
+	if c.NsgID != "" {
+		if err := checkOCID("network_security_group_id", c.NsgID, "network security group", "networksecuritygroup"); err != nil {
+			return err
+		}
+	}
+	if c.Region == "" {
+		return fmt.Errorf("region is required")
+	}
+	switch c.GetAuthMethod() {
+	case AuthMethodAPIKey:
+		if err := c.validateAPIKey(); err != nil {
+			return err
+		}
+	case AuthMethodInstancePrincipal:
+	default:
+		return fmt.Errorf("auth_method must be %s or %s", AuthMethodAPIKey, AuthMethodInstancePrincipal)
+	}
+	if c.CompartmentInstanceQuota < 0 {
+		return fmt.Errorf("compartment_instance_quota must not be negative")
+	}
+	if c.WebhookURL != "" {
+		u, err := url.Parse(c.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook_url must be a valid http or https URL")
+		}
+	}
+	seen := map[string]bool{c.Region: true}
+	for _, region := range c.AdditionalRegions {
+		if region == "" || seen[region] {
+			return fmt.Errorf("additional_regions must not be empty, repeat a region or contain region %s", c.Region)
+		}
+		seen[region] = true
+	}
+	if c.BootVolumeRetention != "" {
+		retention, err := time.ParseDuration(c.BootVolumeRetention)
+		if err != nil || retention <= 0 {
+			return fmt.Errorf("boot_volume_retention must be a positive duration, like 720h")
+		}
+	}
+	if c.GarmAPIURL != "" {
+		u, err := url.Parse(c.GarmAPIURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("garm_api_url must be a valid http or https URL")
+		}
+		if c.GarmAPIToken == "" {
+			return fmt.Errorf("garm_api_token is required when garm_api_url is set")
+		}
+	}
+	if c.ToolsMirrorURL != "" {
+		u, err := url.Parse(c.ToolsMirrorURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tools_mirror_url must be a valid http or https URL")
+		}
+	}
+	switch c.StoppingOnDelete {
+	case "", StoppingOnDeleteWait, StoppingOnDeleteForce:
+	default:
+		return fmt.Errorf("invalid stopping_on_delete %q", c.StoppingOnDelete)
+	}
+	durations := []struct{ name, value, example string }{
+		{"shape_cache_ttl", c.ShapeCacheTTL, "1h"},
+		{"registration_timeout", c.RegistrationTimeout, "10m"},
+		{"stopping_timeout", c.StoppingTimeout, "5m"},
+		{"request_timeout", c.RequestTimeout, "30s"},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d.value); err != nil || duration <= 0 {
+			return fmt.Errorf("%s must be a positive duration, like %s", d.name, d.example)
+		}
+	}
+	if err := c.RetryPolicy.validate(); err != nil {
+		return err
+	}
+	if err := c.LaunchTimeout.validate(); err != nil {
+		return err
+	}
+	if c.LaunchGracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(c.LaunchGracePeriod)
+		if err != nil || gracePeriod <= 0 {
+			return fmt.Errorf("launch_grace_period must be a positive duration, like 3m")
+		}
 	}
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+	if c.UserDataMetadataKey == "ssh_authorized_keys" {
+		return fmt.Errorf("user_data_metadata_key must not be ssh_authorized_keys")
+	}
+	return nil
+}
+
+// validateAPIKey validates the settings of the api_key auth method.
+func (c *Config) validateAPIKey() error {
 	if c.TenancyID == "" {
 		return fmt.Errorf("tenancy_id is required")
 	}
 	if c.UserID == "" {
 		return fmt.Errorf("user_id is required")
 	}
-	if c.Region == "" {
-		return fmt.Errorf("region is required")
+	if err := checkOCID("tenancy_id", c.TenancyID, "tenancy", "tenancy"); err != nil {
+		return err
+	}
+	if err := checkOCID("user_id", c.UserID, "user", "user"); err != nil {
+		return err
 	}
 	if c.Fingerprint == "" {
 		return fmt.Errorf("fingerprint is required")
 	}
-	if c.PrivateKeyPath == "" {
-		return fmt.Errorf("private_key_path is required")
+	if c.PrivateKeyPath == "" && c.PrivateKey == "" {
+		return fmt.Errorf("private_key_path or private_key is required")
+	}
+	if c.PrivateKeyPath != "" && c.PrivateKey != "" {
+		return fmt.Errorf("private_key_path and private_key can't be combined")
+	}
+	if c.PrivateKeyPasswordSecretID != "" {
+		if c.PrivateKeyPassword != "" {
+			return fmt.Errorf("private_key_password and private_key_password_secret_id can't be combined")
+		}
+		if !strings.HasPrefix(c.PrivateKeyPasswordSecretID, "ocid1.vaultsecret.") {
+			return fmt.Errorf("private_key_password_secret_id must be the OCID of a vault secret")
+		}
 	}
 	return nil
 }
 
+// checkOCID verifies that value is an OCID of one of the resource types, so a
+// value pasted into the wrong field fails here rather than at launch.
+func checkOCID(field, value, kind string, resourceTypes ...string) error {
+	for _, resourceType := range resourceTypes {
+		if strings.HasPrefix(value, "ocid1."+resourceType+".") {
+			if !isWellFormedOCID(value) {
+				return fmt.Errorf("%s is not a well-formed OCID, got %q", field, value)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be the OCID of a %s, got %q", field, kind, value)
+}
+
+// isWellFormedOCID reports whether value has the parts of an OCID:
+// ocid1.<resource type>.<realm>.[region].<unique ID>. The region is empty for
+// resources that are not regional, like compartments, but the unique ID is
+// never empty.
+func isWellFormedOCID(value string) bool {
+	parts := strings.Split(value, ".")
+	return len(parts) >= 5 && parts[len(parts)-1] != ""
+}
+
+// GetAuthMethod returns how requests are authenticated.
+func (c *Config) GetAuthMethod() string {
+	if c.AuthMethod == "" {
+		return AuthMethodAPIKey
+	}
+	return c.AuthMethod
+}
+
+// UserDataKey returns the instance metadata key of the user data.
+func (c *Config) UserDataKey() string {
+	if c.UserDataMetadataKey == "" {
+		return defaultUserDataMetadataKey
+	}
+	return c.UserDataMetadataKey
+}
+
+// ShapeCacheTTLDuration returns how long the shape cache is considered fresh.
+func (c *Config) ShapeCacheTTLDuration() time.Duration {
+	duration, err := time.ParseDuration(c.ShapeCacheTTL)
+	if err != nil || duration <= 0 {
+		return defaultShapeCacheTTL
+	}
+	return duration
+}
+
+// RegistrationTimeoutDuration returns how long to wait for a launched runner
+// to register with GARM.
+func (c *Config) RegistrationTimeoutDuration() time.Duration {
+	duration, err := time.ParseDuration(c.RegistrationTimeout)
+	if err != nil || duration <= 0 {
+		return defaultRegistrationTimeout
+	}
+	return duration
+}
+
+// StoppingTimeoutDuration returns how long to wait for a STOPPING instance to
+// be STOPPED before terminating it.
+func (c *Config) StoppingTimeoutDuration() time.Duration {
+	duration, err := time.ParseDuration(c.StoppingTimeout)
+	if err != nil || duration <= 0 {
+		return defaultStoppingTimeout
+	}
+	return duration
+}
+
+// RequestTimeoutDuration returns how long a single OCI API call may take.
+func (c *Config) RequestTimeoutDuration() time.Duration {
+	duration, err := time.ParseDuration(c.RequestTimeout)
+	if err != nil || duration <= 0 {
+		return defaultRequestTimeout
+	}
+	return duration
+}
+
+// BootVolumeRetentionPeriod returns how long boot volumes are retained after
+// termination, or 0 if they are not retained.
+func (c *Config) BootVolumeRetentionPeriod() time.Duration {
+	retention, err := time.ParseDuration(c.BootVolumeRetention)
+	if err != nil {
+		return 0
+	}
+	return retention
+}
+
+// LaunchGracePeriodDuration returns how long a launched instance may stay
+// PROVISIONING, or 0 if it may stay PROVISIONING until the launch timeout.
+func (c *Config) LaunchGracePeriodDuration() time.Duration {
+	gracePeriod, err := time.ParseDuration(c.LaunchGracePeriod)
+	if err != nil {
+		return 0
+	}
+	return gracePeriod
+}
+
+// GetPrivateKey returns the inline private key, or reads it from the path.
 func (c *Config) GetPrivateKey() (string, error) {
+	if c.PrivateKey != "" {
+		return c.PrivateKey, nil
+	}
 	pemFileContent, err := os.ReadFile(c.PrivateKeyPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read the .pem file: %v", err)
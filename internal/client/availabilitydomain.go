@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v49/identity"
+)
+
+// ValidateAvailabilityDomain checks that the configured availability domain
+// exists in the region of the provider, so a mismatched pair fails at once
+// rather than as an obscure launch failure.
+func (o *OciCli) ValidateAvailabilityDomain(ctx context.Context) error {
+	resp, err := o.identityClient.ListAvailabilityDomains(ctx, identity.ListAvailabilityDomainsRequest{
+		CompartmentId: &o.cfg.CompartmentId,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing availability domains: %w", err)
+	}
+	names := make([]string, 0, len(resp.Items))
+	for _, ad := range resp.Items {
+		if ad.Name == nil {
+			continue
+		}
+		if *ad.Name == o.cfg.AvailabilityDomain {
+			return nil
+		}
+		names = append(names, *ad.Name)
+	}
+	return fmt.Errorf("availability domain %q not found in region %s, it must be one of: %s", o.cfg.AvailabilityDomain, o.cfg.Region, strings.Join(names, ", "))
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAvailabilityDomain(t *testing.T) {
+	domains := []identity.AvailabilityDomain{
+		{Name: common.String("Uocm:PHX-AD-1")},
+		{Name: common.String("Uocm:PHX-AD-2")},
+	}
+	tests := []struct {
+		name               string
+		availabilityDomain string
+		listErr            error
+		errString          string
+	}{
+		{
+			name:               "availability domain of the region",
+			availabilityDomain: "Uocm:PHX-AD-2",
+		},
+		{
+			name:               "availability domain of another region",
+			availabilityDomain: "Uocm:IAD-AD-1",
+			errString:          `availability domain "Uocm:IAD-AD-1" not found in region us-phoenix-1, it must be one of: Uocm:PHX-AD-1, Uocm:PHX-AD-2`,
+		},
+		{
+			name:               "listing fails",
+			availabilityDomain: "Uocm:PHX-AD-1",
+			listErr:            fmt.Errorf("not authorized"),
+			errString:          "error listing availability domains: not authorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockIdentityClient := new(MockIdentityClient)
+			ociCli := &OciCli{
+				identityClient: mockIdentityClient,
+				cfg: &config.Config{
+					AvailabilityDomain: tt.availabilityDomain,
+					CompartmentId:      "compartment",
+					Region:             "us-phoenix-1",
+				},
+			}
+			mockIdentityClient.On("ListAvailabilityDomains", ctx, identity.ListAvailabilityDomainsRequest{
+				CompartmentId: common.String("compartment"),
+			}).Return(identity.ListAvailabilityDomainsResponse{Items: domains}, tt.listErr)
+
+			err := ociCli.ValidateAvailabilityDomain(ctx)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+const (
+	// blockVolumesTag records on the instance how many block volumes were
+	// created for it, so only those instances are looked at on delete.
+	blockVolumesTag = "GARM_BLOCK_VOLUMES"
+	// blockVolumeInstanceTag records on a block volume the instance it was
+	// created for.
+	blockVolumeInstanceTag = "GARM_INSTANCE_ID"
+)
+
+// blockVolumeDetachTimeout bounds how long deleting an instance waits for
+// its block volumes to be detached.
+var blockVolumeDetachTimeout = 5 * time.Minute
+
+// hasBlockVolumes reports whether block volumes were created for the
+// instance.
+func hasBlockVolumes(instance core.Instance) bool {
+	_, ok := instance.FreeformTags[blockVolumesTag]
+	return ok
+}
+
+// attachBlockVolumes creates the block volumes of the spec and attaches them
+// to the instance. OCI only attaches volumes to running instances, so it
+// waits for the instance to be running, within the launch timeout.
+func (o *OciCli) attachBlockVolumes(ctx context.Context, instance core.Instance, spec *spec.RunnerSpec) error {
+	if len(spec.BlockVolumes) == 0 {
+		return nil
+	}
+	timeout := o.cfg.LaunchTimeout.For(spec.BootVolumeSize)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	availabilityDomain := instance.AvailabilityDomain
+	if availabilityDomain == nil {
+		availabilityDomain = &spec.AvailabilityDomain
+	}
+	volumeIDs := make([]string, 0, len(spec.BlockVolumes))
+	for i, blockVolume := range spec.BlockVolumes {
+		details := core.CreateVolumeDetails{
+			AvailabilityDomain: availabilityDomain,
+			CompartmentId:      &spec.CompartmentID,
+			DisplayName:        common.String(fmt.Sprintf("%s-%d", spec.BootstrapParams.Name, i)),
+			SizeInGBs:          common.Int64(blockVolume.SizeInGBs),
+			FreeformTags: map[string]string{
+				"GARM_POOL_ID":         spec.BootstrapParams.PoolID,
+				"GARM_CONTROLLER_ID":   spec.ControllerID,
+				blockVolumeInstanceTag: *instance.Id,
+			},
+		}
+		if blockVolume.VpusPerGB != 0 {
+			details.VpusPerGB = common.Int64(blockVolume.VpusPerGB)
+		}
+		resp, err := o.blockstorageClient.CreateVolume(ctx, core.CreateVolumeRequest{CreateVolumeDetails: details})
+		if err != nil {
+			return fmt.Errorf("error creating block volume %d: %w", i, err)
+		}
+		volumeIDs = append(volumeIDs, *resp.Id)
+	}
+	if _, err := o.WaitForInstanceState(ctx, *instance.Id, core.InstanceLifecycleStateRunning, timeout); err != nil {
+		return err
+	}
+	for _, volumeID := range volumeIDs {
+		if err := o.waitForVolumeAvailable(ctx, volumeID); err != nil {
+			return err
+		}
+		_, err := o.computeClient.AttachVolume(ctx, core.AttachVolumeRequest{
+			AttachVolumeDetails: attachVolumeDetails(spec, *instance.Id, volumeID),
+		})
+		if err != nil {
+			return fmt.Errorf("error attaching block volume %s: %w", volumeID, err)
+		}
+	}
+	return nil
+}
+
+// attachVolumeDetails attaches the volume over iSCSI on bare metal shapes,
+// which don't support paravirtualized attachments, and when multipath is
+// used.
+func attachVolumeDetails(spec *spec.RunnerSpec, instanceID, volumeID string) core.AttachVolumeDetails {
+	if spec.IsMultipath || strings.HasPrefix(spec.BootstrapParams.Flavor, "BM.") {
+		return core.AttachIScsiVolumeDetails{
+			InstanceId: &instanceID,
+			VolumeId:   &volumeID,
+		}
+	}
+	return core.AttachParavirtualizedVolumeDetails{
+		InstanceId: &instanceID,
+		VolumeId:   &volumeID,
+	}
+}
+
+func (o *OciCli) waitForVolumeAvailable(ctx context.Context, volumeID string) error {
+	for {
+		resp, err := o.blockstorageClient.GetVolume(ctx, core.GetVolumeRequest{
+			VolumeId: &volumeID,
+		})
+		if err != nil {
+			return fmt.Errorf("error getting block volume %s: %w", volumeID, err)
+		}
+		switch resp.LifecycleState {
+		case core.VolumeLifecycleStateAvailable:
+			return nil
+		case core.VolumeLifecycleStateProvisioning, core.VolumeLifecycleStateRestoring:
+		default:
+			return fmt.Errorf("block volume %s is %s", volumeID, resp.LifecycleState)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for block volume %s to be %s: %w", volumeID, core.VolumeLifecycleStateAvailable, ctx.Err())
+		case <-time.After(instanceStatePollInterval):
+		}
+	}
+}
+
+// deleteBlockVolumes detaches and deletes the block volumes created for the
+// instance. Volumes are found by their GARM_INSTANCE_ID tag rather than by
+// their attachments, so a delete that was interrupted after detaching them
+// still deletes them when it is retried.
+func (o *OciCli) deleteBlockVolumes(ctx context.Context, instanceID string) error {
+	volumes, err := o.listBlockVolumes(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	if len(volumes) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, blockVolumeDetachTimeout)
+	defer cancel()
+	var attachmentIDs []string
+	for _, volume := range volumes {
+		ids, err := o.detachBlockVolume(ctx, instanceID, volume)
+		if err != nil {
+			return err
+		}
+		attachmentIDs = append(attachmentIDs, ids...)
+	}
+	for _, attachmentID := range attachmentIDs {
+		if err := o.waitForVolumeDetached(ctx, attachmentID); err != nil {
+			return err
+		}
+	}
+	for _, volume := range volumes {
+		if _, err := o.blockstorageClient.DeleteVolume(ctx, core.DeleteVolumeRequest{VolumeId: volume.Id}); err != nil && !isNotFound(err) {
+			return fmt.Errorf("error deleting block volume %s: %w", *volume.Id, err)
+		}
+	}
+	return nil
+}
+
+// listBlockVolumes returns the block volumes created for the instance that
+// are not deleted yet.
+func (o *OciCli) listBlockVolumes(ctx context.Context, instanceID string) ([]core.Volume, error) {
+	request := core.ListVolumesRequest{
+		CompartmentId: &o.cfg.CompartmentId,
+	}
+	var volumes []core.Volume
+	for {
+		resp, err := o.blockstorageClient.ListVolumes(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("error listing block volumes: %w", err)
+		}
+		for _, volume := range resp.Items {
+			if volume.FreeformTags[blockVolumeInstanceTag] != instanceID {
+				continue
+			}
+			if volume.LifecycleState == core.VolumeLifecycleStateTerminating || volume.LifecycleState == core.VolumeLifecycleStateTerminated {
+				continue
+			}
+			volumes = append(volumes, volume)
+		}
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			return volumes, nil
+		}
+		request.Page = resp.OpcNextPage
+	}
+}
+
+// detachBlockVolume detaches the volume from the instance and returns the
+// attachments to wait for.
+func (o *OciCli) detachBlockVolume(ctx context.Context, instanceID string, volume core.Volume) ([]string, error) {
+	resp, err := o.computeClient.ListVolumeAttachments(ctx, core.ListVolumeAttachmentsRequest{
+		CompartmentId: &o.cfg.CompartmentId,
+		InstanceId:    &instanceID,
+		VolumeId:      volume.Id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing attachments of block volume %s: %w", *volume.Id, err)
+	}
+	var attachmentIDs []string
+	for _, attachment := range resp.Items {
+		switch attachment.GetLifecycleState() {
+		case core.VolumeAttachmentLifecycleStateAttaching, core.VolumeAttachmentLifecycleStateAttached:
+			_, err := o.computeClient.DetachVolume(ctx, core.DetachVolumeRequest{VolumeAttachmentId: attachment.GetId()})
+			if err != nil {
+				return nil, fmt.Errorf("error detaching block volume %s: %w", *volume.Id, err)
+			}
+		case core.VolumeAttachmentLifecycleStateDetaching:
+		default:
+			continue
+		}
+		attachmentIDs = append(attachmentIDs, *attachment.GetId())
+	}
+	return attachmentIDs, nil
+}
+
+func (o *OciCli) waitForVolumeDetached(ctx context.Context, attachmentID string) error {
+	for {
+		resp, err := o.computeClient.GetVolumeAttachment(ctx, core.GetVolumeAttachmentRequest{
+			VolumeAttachmentId: &attachmentID,
+		})
+		if err != nil {
+			return fmt.Errorf("error getting volume attachment %s: %w", attachmentID, err)
+		}
+		state := resp.VolumeAttachment.GetLifecycleState()
+		if state == core.VolumeAttachmentLifecycleStateDetached {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for volume attachment %s to be %s, it is %s: %w", attachmentID, core.VolumeAttachmentLifecycleStateDetached, state, ctx.Err())
+		case <-time.After(instanceStatePollInterval):
+		}
+	}
+}
+
+// blockVolumesTagValue is the value of the GARM_BLOCK_VOLUMES tag of an
+// instance launched with the block volumes of the spec.
+func blockVolumesTagValue(spec *spec.RunnerSpec) string {
+	return strconv.Itoa(len(spec.BlockVolumes))
+}
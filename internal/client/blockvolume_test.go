@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func blockVolumesSpec(flavor string) *spec.RunnerSpec {
+	return &spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		ControllerID:       "controller",
+		BlockVolumes: []spec.BlockVolume{
+			{SizeInGBs: 100},
+			{SizeInGBs: 200, VpusPerGB: 20},
+		},
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			PoolID: "my-pool",
+			Flavor: flavor,
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+}
+
+func TestCreateInstanceAttachesBlockVolumes(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	tests := []struct {
+		name           string
+		flavor         string
+		expectedAttach core.AttachVolumeDetails
+	}{
+		{
+			name:   "virtual machine",
+			flavor: "VM.Standard.E4.Flex",
+			expectedAttach: core.AttachParavirtualizedVolumeDetails{
+				InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				VolumeId:   common.String("ocid1.volume.oc1..aaaa"),
+			},
+		},
+		{
+			name:   "bare metal",
+			flavor: "BM.Standard3.64",
+			expectedAttach: core.AttachIScsiVolumeDetails{
+				InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				VolumeId:   common.String("ocid1.volume.oc1..aaaa"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockBlockstorageClient := new(MockBlockstorageClient)
+			ociCli := &OciCli{
+				computeClient:      mockComputeClient,
+				blockstorageClient: mockBlockstorageClient,
+				cfg:                cfg,
+			}
+			spec := blockVolumesSpec(tt.flavor)
+			instance := core.Instance{
+				Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				AvailabilityDomain: common.String("ad"),
+				LifecycleState:     core.InstanceLifecycleStateProvisioning,
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(tt.flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: instance,
+			}, nil)
+			mockBlockstorageClient.On("CreateVolume", mock.Anything, mock.MatchedBy(func(req core.CreateVolumeRequest) bool {
+				return *req.SizeInGBs == 100
+			})).Return(core.CreateVolumeResponse{
+				Volume: core.Volume{Id: common.String("ocid1.volume.oc1..aaaa")},
+			}, nil)
+			mockBlockstorageClient.On("CreateVolume", mock.Anything, mock.MatchedBy(func(req core.CreateVolumeRequest) bool {
+				return *req.SizeInGBs == 200
+			})).Return(core.CreateVolumeResponse{
+				Volume: core.Volume{Id: common.String("ocid1.volume.oc1..bbbb")},
+			}, nil)
+			mockComputeClient.On("GetInstance", mock.Anything, mock.Anything).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: instance.Id, LifecycleState: core.InstanceLifecycleStateRunning},
+			}, nil)
+			mockBlockstorageClient.On("GetVolume", mock.Anything, mock.Anything).Return(core.GetVolumeResponse{
+				Volume: core.Volume{LifecycleState: core.VolumeLifecycleStateProvisioning},
+			}, nil).Once()
+			mockBlockstorageClient.On("GetVolume", mock.Anything, mock.Anything).Return(core.GetVolumeResponse{
+				Volume: core.Volume{LifecycleState: core.VolumeLifecycleStateAvailable},
+			}, nil)
+			mockComputeClient.On("AttachVolume", mock.Anything, mock.Anything).Return(core.AttachVolumeResponse{}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, spec)
+			require.NoError(t, err)
+
+			var launch core.LaunchInstanceRequest
+			var attaches []core.AttachVolumeDetails
+			for _, call := range mockComputeClient.Calls {
+				switch call.Method {
+				case "LaunchInstance":
+					launch = call.Arguments.Get(1).(core.LaunchInstanceRequest)
+				case "AttachVolume":
+					attaches = append(attaches, call.Arguments.Get(1).(core.AttachVolumeRequest).AttachVolumeDetails)
+				}
+			}
+			require.Equal(t, "2", launch.LaunchInstanceDetails.FreeformTags[blockVolumesTag])
+			require.Len(t, attaches, 2)
+			require.Equal(t, tt.expectedAttach, attaches[0])
+
+			var creates []core.CreateVolumeDetails
+			for _, call := range mockBlockstorageClient.Calls {
+				if call.Method == "CreateVolume" {
+					creates = append(creates, call.Arguments.Get(1).(core.CreateVolumeRequest).CreateVolumeDetails)
+				}
+			}
+			require.Len(t, creates, 2)
+			require.Equal(t, core.CreateVolumeDetails{
+				AvailabilityDomain: common.String("ad"),
+				CompartmentId:      common.String("compartment"),
+				DisplayName:        common.String("garm-instance-1"),
+				SizeInGBs:          common.Int64(200),
+				VpusPerGB:          common.Int64(20),
+				FreeformTags: map[string]string{
+					"GARM_POOL_ID":       "my-pool",
+					"GARM_CONTROLLER_ID": "controller",
+					"GARM_INSTANCE_ID":   "ocid1.instance.oc1.iad.aaaaaaaamf7",
+				},
+			}, creates[1])
+			require.Nil(t, creates[0].VpusPerGB)
+			mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestCreateInstanceBlockVolumeAttachFailure(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	spec := blockVolumesSpec("VM.Standard.E4.Flex")
+	spec.BlockVolumes = spec.BlockVolumes[:1]
+	instanceID := common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")
+	volumeID := common.String("ocid1.volume.oc1..aaaa")
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: instanceID, AvailabilityDomain: common.String("ad")},
+	}, nil)
+	mockBlockstorageClient.On("CreateVolume", mock.Anything, mock.Anything).Return(core.CreateVolumeResponse{
+		Volume: core.Volume{Id: volumeID},
+	}, nil)
+	mockComputeClient.On("GetInstance", mock.Anything, mock.Anything).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: instanceID, LifecycleState: core.InstanceLifecycleStateRunning},
+	}, nil)
+	mockBlockstorageClient.On("GetVolume", mock.Anything, mock.Anything).Return(core.GetVolumeResponse{
+		Volume: core.Volume{LifecycleState: core.VolumeLifecycleStateAvailable},
+	}, nil)
+	mockComputeClient.On("AttachVolume", mock.Anything, mock.Anything).Return(core.AttachVolumeResponse{}, errors.New("limit exceeded"))
+	mockBlockstorageClient.On("ListVolumes", mock.Anything, mock.Anything).Return(core.ListVolumesResponse{
+		Items: []core.Volume{{
+			Id:             volumeID,
+			LifecycleState: core.VolumeLifecycleStateAvailable,
+			FreeformTags:   map[string]string{blockVolumeInstanceTag: *instanceID},
+		}},
+	}, nil)
+	mockComputeClient.On("ListVolumeAttachments", mock.Anything, mock.Anything).Return(core.ListVolumeAttachmentsResponse{}, nil)
+	mockBlockstorageClient.On("DeleteVolume", mock.Anything, core.DeleteVolumeRequest{VolumeId: volumeID}).Return(core.DeleteVolumeResponse{}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{InstanceId: instanceID}).Return(core.TerminateInstanceResponse{}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, spec)
+	require.ErrorContains(t, err, "error attaching block volumes to instance ocid1.instance.oc1.iad.aaaaaaaamf7: error attaching block volume ocid1.volume.oc1..aaaa: limit exceeded")
+	mockBlockstorageClient.AssertExpectations(t)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestDeleteInstanceDeletesBlockVolumes(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	volumeID := common.String("ocid1.volume.oc1..aaaa")
+	attachmentID := common.String("ocid1.volumeattachment.oc1..aaaa")
+
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: common.String(inst),
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{
+			Id:           common.String(inst),
+			FreeformTags: map[string]string{blockVolumesTag: "1"},
+		},
+	}, nil)
+	mockBlockstorageClient.On("ListVolumes", ctx, core.ListVolumesRequest{
+		CompartmentId: common.String("compartment"),
+	}).Return(core.ListVolumesResponse{
+		Items: []core.Volume{
+			{
+				Id:             volumeID,
+				LifecycleState: core.VolumeLifecycleStateAvailable,
+				FreeformTags:   map[string]string{blockVolumeInstanceTag: inst},
+			},
+			{
+				Id:             common.String("ocid1.volume.oc1..bbbb"),
+				LifecycleState: core.VolumeLifecycleStateAvailable,
+				FreeformTags:   map[string]string{blockVolumeInstanceTag: "ocid1.instance.oc1.iad.other"},
+			},
+			{
+				Id:             common.String("ocid1.volume.oc1..cccc"),
+				LifecycleState: core.VolumeLifecycleStateTerminated,
+				FreeformTags:   map[string]string{blockVolumeInstanceTag: inst},
+			},
+		},
+	}, nil)
+	mockComputeClient.On("ListVolumeAttachments", mock.Anything, core.ListVolumeAttachmentsRequest{
+		CompartmentId: common.String("compartment"),
+		InstanceId:    common.String(inst),
+		VolumeId:      volumeID,
+	}).Return(core.ListVolumeAttachmentsResponse{
+		Items: []core.VolumeAttachment{
+			core.ParavirtualizedVolumeAttachment{
+				Id:             attachmentID,
+				LifecycleState: core.VolumeAttachmentLifecycleStateAttached,
+			},
+		},
+	}, nil)
+	mockComputeClient.On("DetachVolume", mock.Anything, core.DetachVolumeRequest{
+		VolumeAttachmentId: attachmentID,
+	}).Return(core.DetachVolumeResponse{}, nil)
+	mockComputeClient.On("GetVolumeAttachment", mock.Anything, core.GetVolumeAttachmentRequest{
+		VolumeAttachmentId: attachmentID,
+	}).Return(core.GetVolumeAttachmentResponse{
+		VolumeAttachment: core.ParavirtualizedVolumeAttachment{LifecycleState: core.VolumeAttachmentLifecycleStateDetaching},
+	}, nil).Once()
+	mockComputeClient.On("GetVolumeAttachment", mock.Anything, core.GetVolumeAttachmentRequest{
+		VolumeAttachmentId: attachmentID,
+	}).Return(core.GetVolumeAttachmentResponse{
+		VolumeAttachment: core.ParavirtualizedVolumeAttachment{LifecycleState: core.VolumeAttachmentLifecycleStateDetached},
+	}, nil)
+	mockBlockstorageClient.On("DeleteVolume", mock.Anything, core.DeleteVolumeRequest{
+		VolumeId: volumeID,
+	}).Return(core.DeleteVolumeResponse{}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         common.String(inst),
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := ociCli.DeleteInstance(ctx, inst)
+	require.NoError(t, err)
+	mockBlockstorageClient.AssertExpectations(t)
+	mockBlockstorageClient.AssertNumberOfCalls(t, "DeleteVolume", 1)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestDeleteInstanceBlockVolumeFailure(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+
+	mockComputeClient.On("GetInstance", ctx, mock.Anything).Return(core.GetInstanceResponse{
+		Instance: core.Instance{
+			Id:           common.String(inst),
+			FreeformTags: map[string]string{blockVolumesTag: "1"},
+		},
+	}, nil)
+	mockBlockstorageClient.On("ListVolumes", ctx, mock.Anything).Return(core.ListVolumesResponse{}, errors.New("unavailable"))
+
+	err := ociCli.DeleteInstance(ctx, inst)
+	require.ErrorContains(t, err, "error deleting block volumes of instance ocid1.instance.oc1.iad.aaaaaaaamf7: error listing block volumes: unavailable")
+	mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+}
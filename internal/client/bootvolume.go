@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// resolveBootVolumeID returns the OCID of the boot volume to launch the
+// instance from, or an empty string if it should be launched from the image.
+// The boot volume set by boot_volume_id must be available, unattached and in
+// the availability domain of the pool.
+func (o *OciCli) resolveBootVolumeID(ctx context.Context, spec *spec.RunnerSpec, imageID string) (string, error) {
+	if spec.BootVolumeID == "" {
+		return o.findReusableBootVolume(ctx, spec, imageID)
+	}
+	resp, err := o.blockstorageClient.GetBootVolume(ctx, core.GetBootVolumeRequest{
+		BootVolumeId: &spec.BootVolumeID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting boot volume %s: %w", spec.BootVolumeID, err)
+	}
+	if resp.LifecycleState != core.BootVolumeLifecycleStateAvailable {
+		return "", fmt.Errorf("boot volume %s is %s, it must be %s", spec.BootVolumeID, resp.LifecycleState, core.BootVolumeLifecycleStateAvailable)
+	}
+	if resp.AvailabilityDomain == nil || *resp.AvailabilityDomain != spec.AvailabilityDomain {
+		return "", fmt.Errorf("boot volume %s is not in availability domain %s", spec.BootVolumeID, spec.AvailabilityDomain)
+	}
+	attached, err := o.isBootVolumeAttached(ctx, resp.BootVolume)
+	if err != nil {
+		return "", err
+	}
+	if attached {
+		return "", fmt.Errorf("boot volume %s is attached to another instance", spec.BootVolumeID)
+	}
+	return spec.BootVolumeID, nil
+}
+
+// findReusableBootVolume returns the OCID of a preserved boot volume of the
+// pool that can be used to launch the instance, or an empty string if there
+// is none and the instance should be launched from the image.
+func (o *OciCli) findReusableBootVolume(ctx context.Context, spec *spec.RunnerSpec, imageID string) (string, error) {
+	if !o.cfg.ReuseBootVolumes {
+		return "", nil
+	}
+	request := core.ListBootVolumesRequest{
+		AvailabilityDomain: &spec.AvailabilityDomain,
+		CompartmentId:      &spec.CompartmentID,
+	}
+	for {
+		resp, err := o.blockstorageClient.ListBootVolumes(ctx, request)
+		if err != nil {
+			return "", fmt.Errorf("error listing boot volumes: %w", err)
+		}
+		for _, volume := range resp.Items {
+			if !isReusableBootVolume(volume, spec, imageID) {
+				continue
+			}
+			attached, err := o.isBootVolumeAttached(ctx, volume)
+			if err != nil {
+				return "", err
+			}
+			if !attached {
+				return *volume.Id, nil
+			}
+		}
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			break
+		}
+		request.Page = resp.OpcNextPage
+	}
+	return "", nil
+}
+
+// isReusableBootVolume reports whether the boot volume was preserved for the
+// pool of the spec and was created from the image with the same size.
+func isReusableBootVolume(volume core.BootVolume, spec *spec.RunnerSpec, imageID string) bool {
+	if volume.LifecycleState != core.BootVolumeLifecycleStateAvailable {
+		return false
+	}
+	if volume.FreeformTags["GARM_POOL_ID"] != spec.BootstrapParams.PoolID || volume.FreeformTags["GARM_CONTROLLER_ID"] != spec.ControllerID {
+		return false
+	}
+	if volume.ImageId == nil || *volume.ImageId != imageID {
+		return false
+	}
+	return volume.SizeInGBs != nil && *volume.SizeInGBs == spec.BootVolumeSize
+}
+
+func (o *OciCli) isBootVolumeAttached(ctx context.Context, volume core.BootVolume) (bool, error) {
+	resp, err := o.computeClient.ListBootVolumeAttachments(ctx, core.ListBootVolumeAttachmentsRequest{
+		AvailabilityDomain: volume.AvailabilityDomain,
+		CompartmentId:      volume.CompartmentId,
+		BootVolumeId:       volume.Id,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error listing attachments of boot volume %s: %w", *volume.Id, err)
+	}
+	for _, attachment := range resp.Items {
+		if attachment.LifecycleState == core.BootVolumeAttachmentLifecycleStateAttaching || attachment.LifecycleState == core.BootVolumeAttachmentLifecycleStateAttached {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// bootVolumeExpiresAtTag records until when a boot volume retained because
+// of boot_volume_retention must be kept.
+const bootVolumeExpiresAtTag = "GARM_BOOT_VOLUME_EXPIRES_AT"
+
+// preserveBootVolume tags the boot volume of the instance and reports whether
+// it should be preserved. A retention required by boot_volume_retention
+// overrides reuse_boot_volumes: the boot volume is always preserved and a
+// tagging failure is only logged. Otherwise the boot volume is tagged with
+// its pool, so a later launch can reuse it, and any failure is logged and the
+// boot volume is deleted with the instance, rather than left behind untagged.
+func (o *OciCli) preserveBootVolume(ctx context.Context, instanceID string) bool {
+	if retention := o.cfg.BootVolumeRetentionPeriod(); retention > 0 {
+		expiresAt := o.currentTime().Add(retention)
+		if err := o.tagPreservedBootVolume(ctx, instanceID, expiresAt); err != nil {
+			slog.WarnContext(ctx, "failed to tag retained boot volume", "instance_id", instanceID, "error", err)
+		}
+		return true
+	}
+	if !o.cfg.ReuseBootVolumes {
+		return false
+	}
+	if err := o.tagPreservedBootVolume(ctx, instanceID, time.Time{}); err != nil {
+		slog.WarnContext(ctx, "not preserving boot volume", "instance_id", instanceID, "error", err)
+		return false
+	}
+	return true
+}
+
+// tagPreservedBootVolume tags the boot volume of the instance with its pool,
+// if boot volumes are reused, and with its expiry, if expiresAt is set. The
+// tags already on the boot volume are kept.
+func (o *OciCli) tagPreservedBootVolume(ctx context.Context, instanceID string, expiresAt time.Time) error {
+	instance, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+		InstanceId: &instanceID,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting instance: %w", err)
+	}
+	poolID, ok := instance.FreeformTags["GARM_POOL_ID"]
+	if o.cfg.ReuseBootVolumes && !ok {
+		return fmt.Errorf("instance has no GARM_POOL_ID tag")
+	}
+	attachments, err := o.computeClient.ListBootVolumeAttachments(ctx, core.ListBootVolumeAttachmentsRequest{
+		AvailabilityDomain: instance.AvailabilityDomain,
+		CompartmentId:      instance.CompartmentId,
+		InstanceId:         &instanceID,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing boot volume attachments: %w", err)
+	}
+	if len(attachments.Items) == 0 {
+		return fmt.Errorf("no boot volume attached")
+	}
+	// Updating the freeform tags replaces all of them.
+	volume, err := o.blockstorageClient.GetBootVolume(ctx, core.GetBootVolumeRequest{
+		BootVolumeId: attachments.Items[0].BootVolumeId,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting boot volume: %w", err)
+	}
+	tags := make(map[string]string, len(volume.FreeformTags)+3)
+	for key, value := range volume.FreeformTags {
+		tags[key] = value
+	}
+	if o.cfg.ReuseBootVolumes {
+		tags["GARM_POOL_ID"] = poolID
+		tags["GARM_CONTROLLER_ID"] = instance.FreeformTags["GARM_CONTROLLER_ID"]
+	}
+	if !expiresAt.IsZero() {
+		tags[bootVolumeExpiresAtTag] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	_, err = o.blockstorageClient.UpdateBootVolume(ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId: attachments.Items[0].BootVolumeId,
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+			FreeformTags: tags,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error tagging boot volume: %w", err)
+	}
+	return nil
+}
+
+// defaultVpusPerGB is the performance OCI creates boot volumes with, the
+// Balanced level.
+const defaultVpusPerGB int64 = 10
+
+// bootVolumeAttachmentPollInterval is how often the boot volume attachments
+// of a launched instance are polled while waiting for its boot volume.
+var bootVolumeAttachmentPollInterval = 5 * time.Second
+
+// tuneBootVolume applies the boot volume settings of the spec the launch
+// details do not expose: the detached volume autotune, which drops the
+// volume to the lowest performance level, and cost, while it is not
+// attached, and the VPUs per GB. It is applied once the boot volume is
+// attached, which happens some time after the launch returns.
+func (o *OciCli) tuneBootVolume(ctx context.Context, instance core.Instance, spec *spec.RunnerSpec) error {
+	var details core.UpdateBootVolumeDetails
+	if spec.BootVolumeDetachedAutotune {
+		details.IsAutoTuneEnabled = common.Bool(true)
+	}
+	if spec.BootVolumeVpusPerGB != 0 && spec.BootVolumeVpusPerGB != defaultVpusPerGB {
+		details.VpusPerGB = common.Int64(spec.BootVolumeVpusPerGB)
+	}
+	if details.IsAutoTuneEnabled == nil && details.VpusPerGB == nil {
+		return nil
+	}
+	bootVolumeID, err := o.waitForBootVolume(ctx, instance, o.cfg.LaunchTimeout.For(spec.BootVolumeSize))
+	if err != nil {
+		return err
+	}
+	_, err = o.blockstorageClient.UpdateBootVolume(ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId:            &bootVolumeID,
+		UpdateBootVolumeDetails: details,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating boot volume performance: %w", err)
+	}
+	return nil
+}
+
+// waitForBootVolume returns the OCID of the boot volume of the instance,
+// waiting for it to be attached. Right after the launch the instance has no
+// boot volume attachment yet.
+func (o *OciCli) waitForBootVolume(ctx context.Context, instance core.Instance, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		resp, err := o.computeClient.ListBootVolumeAttachments(ctx, core.ListBootVolumeAttachmentsRequest{
+			AvailabilityDomain: instance.AvailabilityDomain,
+			CompartmentId:      instance.CompartmentId,
+			InstanceId:         instance.Id,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error listing boot volume attachments: %w", err)
+		}
+		for _, attachment := range resp.Items {
+			if attachment.LifecycleState == core.BootVolumeAttachmentLifecycleStateAttached && attachment.BootVolumeId != nil {
+				return *attachment.BootVolumeId, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("timed out waiting for the boot volume of instance %s: %w", *instance.Id, ctx.Err())
+		case <-time.After(bootVolumeAttachmentPollInterval):
+		}
+	}
+}
@@ -0,0 +1,720 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstanceReuseBootVolume(t *testing.T) {
+	bootVolume := func(id, poolID string) core.BootVolume {
+		return core.BootVolume{
+			Id:                 common.String(id),
+			AvailabilityDomain: common.String("ad"),
+			CompartmentId:      common.String("compartment"),
+			LifecycleState:     core.BootVolumeLifecycleStateAvailable,
+			ImageId:            common.String("ocid1.image.oc1.iad.aaaaaaaamf7"),
+			SizeInGBs:          common.Int64(255),
+			FreeformTags: map[string]string{
+				"GARM_POOL_ID":       poolID,
+				"GARM_CONTROLLER_ID": "controller",
+			},
+		}
+	}
+	tests := []struct {
+		name           string
+		volumes        []core.BootVolume
+		attached       map[string]bool
+		expectedSource core.InstanceSourceDetails
+	}{
+		{
+			name: "reuse preserved boot volume",
+			volumes: []core.BootVolume{
+				bootVolume("ocid1.bootvolume.oc1..other", "other-pool"),
+				bootVolume("ocid1.bootvolume.oc1..attached", "my-pool"),
+				bootVolume("ocid1.bootvolume.oc1..free", "my-pool"),
+			},
+			attached: map[string]bool{"ocid1.bootvolume.oc1..attached": true},
+			expectedSource: core.InstanceSourceViaBootVolumeDetails{
+				BootVolumeId: common.String("ocid1.bootvolume.oc1..free"),
+			},
+		},
+		{
+			name: "fall through to image",
+			volumes: []core.BootVolume{
+				bootVolume("ocid1.bootvolume.oc1..other", "other-pool"),
+				bootVolume("ocid1.bootvolume.oc1..attached", "my-pool"),
+			},
+			attached: map[string]bool{"ocid1.bootvolume.oc1..attached": true},
+			expectedSource: core.InstanceSourceViaImageDetails{
+				ImageId:             common.String("ocid1.image.oc1.iad.aaaaaaaamf7"),
+				BootVolumeSizeInGBs: common.Int64(255),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				ReuseBootVolumes:   true,
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockBlockstorageClient := new(MockBlockstorageClient)
+			ociCli := &OciCli{
+				computeClient:      mockComputeClient,
+				blockstorageClient: mockBlockstorageClient,
+				cfg:                cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				ControllerID:       "controller",
+				BootVolumeSize:     255,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					PoolID: "my-pool",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockBlockstorageClient.On("ListBootVolumes", ctx, core.ListBootVolumesRequest{
+				AvailabilityDomain: common.String("ad"),
+				CompartmentId:      common.String("compartment"),
+			}).Return(core.ListBootVolumesResponse{Items: tt.volumes}, nil)
+			for _, volume := range tt.volumes {
+				if volume.FreeformTags["GARM_POOL_ID"] != spec.BootstrapParams.PoolID {
+					continue
+				}
+				var attachments []core.BootVolumeAttachment
+				if tt.attached[*volume.Id] {
+					attachments = append(attachments, core.BootVolumeAttachment{
+						BootVolumeId:   volume.Id,
+						LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+					})
+				}
+				mockComputeClient.On("ListBootVolumeAttachments", ctx, core.ListBootVolumeAttachmentsRequest{
+					AvailabilityDomain: common.String("ad"),
+					CompartmentId:      common.String("compartment"),
+					BootVolumeId:       volume.Id,
+				}).Return(core.ListBootVolumeAttachmentsResponse{Items: attachments}, nil)
+			}
+			mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+				return assert.ObjectsAreEqual(tt.expectedSource, req.LaunchInstanceDetails.SourceDetails)
+			})).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			mockComputeClient.AssertExpectations(t)
+			// Reused boot volumes were created from the image of the pool.
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, spec.BootstrapParams.Image, req.LaunchInstanceDetails.FreeformTags["GARM_IMAGE_ID"])
+		})
+	}
+}
+
+func TestCreateInstanceWithBootVolumeID(t *testing.T) {
+	tests := []struct {
+		name      string
+		volume    core.BootVolume
+		attached  bool
+		errString string
+	}{
+		{
+			name: "available boot volume",
+			volume: core.BootVolume{
+				AvailabilityDomain: common.String("ad"),
+				LifecycleState:     core.BootVolumeLifecycleStateAvailable,
+			},
+		},
+		{
+			name: "boot volume in use",
+			volume: core.BootVolume{
+				AvailabilityDomain: common.String("ad"),
+				LifecycleState:     core.BootVolumeLifecycleStateAvailable,
+			},
+			attached:  true,
+			errString: "boot volume ocid1.bootvolume.oc1.iad.aaaa is attached to another instance",
+		},
+		{
+			name: "boot volume in another availability domain",
+			volume: core.BootVolume{
+				AvailabilityDomain: common.String("other-ad"),
+				LifecycleState:     core.BootVolumeLifecycleStateAvailable,
+			},
+			errString: "boot volume ocid1.bootvolume.oc1.iad.aaaa is not in availability domain ad",
+		},
+		{
+			name: "boot volume that is not available",
+			volume: core.BootVolume{
+				AvailabilityDomain: common.String("ad"),
+				LifecycleState:     core.BootVolumeLifecycleStateProvisioning,
+			},
+			errString: "boot volume ocid1.bootvolume.oc1.iad.aaaa is PROVISIONING, it must be AVAILABLE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockBlockstorageClient := new(MockBlockstorageClient)
+			ociCli := &OciCli{
+				computeClient:      mockComputeClient,
+				blockstorageClient: mockBlockstorageClient,
+				cfg:                cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				ControllerID:       "controller",
+				BootVolumeSize:     255,
+				BootVolumeID:       "ocid1.bootvolume.oc1.iad.aaaa",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					PoolID: "my-pool",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			volume := tt.volume
+			volume.Id = common.String(spec.BootVolumeID)
+			volume.CompartmentId = common.String("compartment")
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockBlockstorageClient.On("GetBootVolume", ctx, core.GetBootVolumeRequest{
+				BootVolumeId: common.String(spec.BootVolumeID),
+			}).Return(core.GetBootVolumeResponse{BootVolume: volume}, nil)
+			var attachments []core.BootVolumeAttachment
+			if tt.attached {
+				attachments = append(attachments, core.BootVolumeAttachment{
+					BootVolumeId:   volume.Id,
+					LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+				})
+			}
+			mockComputeClient.On("ListBootVolumeAttachments", ctx, core.ListBootVolumeAttachmentsRequest{
+				AvailabilityDomain: volume.AvailabilityDomain,
+				CompartmentId:      common.String("compartment"),
+				BootVolumeId:       volume.Id,
+			}).Return(core.ListBootVolumeAttachmentsResponse{Items: attachments}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString != "" {
+				require.ErrorContains(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			mockBlockstorageClient.AssertNotCalled(t, "ListBootVolumes", ctx, mock.Anything)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, core.InstanceSourceViaBootVolumeDetails{
+				BootVolumeId: common.String(spec.BootVolumeID),
+			}, req.LaunchInstanceDetails.SourceDetails)
+			assert.Equal(t, spec.BootVolumeID, req.LaunchInstanceDetails.FreeformTags["GARM_BOOT_VOLUME_ID"])
+			assert.NotContains(t, req.LaunchInstanceDetails.FreeformTags, "GARM_IMAGE_ID")
+		})
+	}
+}
+
+func TestDeleteInstancePreservesBootVolume(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		ReuseBootVolumes:   true,
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: common.String(inst),
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{
+			Id:                 common.String(inst),
+			AvailabilityDomain: common.String("ad"),
+			CompartmentId:      common.String("compartment"),
+			FreeformTags: map[string]string{
+				"GARM_POOL_ID":       "my-pool",
+				"GARM_CONTROLLER_ID": "controller",
+			},
+		},
+	}, nil)
+	mockComputeClient.On("ListBootVolumeAttachments", ctx, core.ListBootVolumeAttachmentsRequest{
+		AvailabilityDomain: common.String("ad"),
+		CompartmentId:      common.String("compartment"),
+		InstanceId:         common.String(inst),
+	}).Return(core.ListBootVolumeAttachmentsResponse{
+		Items: []core.BootVolumeAttachment{{BootVolumeId: common.String("ocid1.bootvolume.oc1..aaaa")}},
+	}, nil)
+	mockBlockstorageClient.On("GetBootVolume", ctx, core.GetBootVolumeRequest{
+		BootVolumeId: common.String("ocid1.bootvolume.oc1..aaaa"),
+	}).Return(core.GetBootVolumeResponse{
+		BootVolume: core.BootVolume{FreeformTags: map[string]string{"CostCenter": "ci"}},
+	}, nil)
+	mockBlockstorageClient.On("UpdateBootVolume", ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId: common.String("ocid1.bootvolume.oc1..aaaa"),
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+			FreeformTags: map[string]string{
+				"CostCenter":         "ci",
+				"GARM_POOL_ID":       "my-pool",
+				"GARM_CONTROLLER_ID": "controller",
+			},
+		},
+	}).Return(core.UpdateBootVolumeResponse{}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         common.String(inst),
+		PreserveBootVolume: common.Bool(true),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := ociCli.DeleteInstance(ctx, inst)
+	require.NoError(t, err)
+	mockBlockstorageClient.AssertExpectations(t)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestDeleteInstanceRetainsBootVolume(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	tests := []struct {
+		name             string
+		reuseBootVolumes bool
+		updateErr        error
+		expectedTags     map[string]string
+	}{
+		{
+			name:         "retention forces preservation",
+			expectedTags: map[string]string{"CostCenter": "ci", "GARM_BOOT_VOLUME_EXPIRES_AT": "2024-05-31T12:00:00Z"},
+		},
+		{
+			name:             "retention with reuse",
+			reuseBootVolumes: true,
+			expectedTags: map[string]string{
+				"CostCenter":                  "ci",
+				"GARM_POOL_ID":                "my-pool",
+				"GARM_CONTROLLER_ID":          "controller",
+				"GARM_BOOT_VOLUME_EXPIRES_AT": "2024-05-31T12:00:00Z",
+			},
+		},
+		{
+			name:             "tagging failure still preserves",
+			reuseBootVolumes: true,
+			updateErr:        fmt.Errorf("service unavailable"),
+			expectedTags: map[string]string{
+				"CostCenter":                  "ci",
+				"GARM_POOL_ID":                "my-pool",
+				"GARM_CONTROLLER_ID":          "controller",
+				"GARM_BOOT_VOLUME_EXPIRES_AT": "2024-05-31T12:00:00Z",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain:  "ad",
+				CompartmentId:       "compartment",
+				ReuseBootVolumes:    tt.reuseBootVolumes,
+				BootVolumeRetention: "720h",
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockBlockstorageClient := new(MockBlockstorageClient)
+			ociCli := &OciCli{
+				computeClient:      mockComputeClient,
+				blockstorageClient: mockBlockstorageClient,
+				cfg:                cfg,
+				now:                func() time.Time { return now },
+			}
+			mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: common.String(inst),
+			}).Return(core.GetInstanceResponse{
+				Instance: core.Instance{
+					Id:                 common.String(inst),
+					AvailabilityDomain: common.String("ad"),
+					CompartmentId:      common.String("compartment"),
+					FreeformTags: map[string]string{
+						"GARM_POOL_ID":       "my-pool",
+						"GARM_CONTROLLER_ID": "controller",
+					},
+				},
+			}, nil)
+			mockComputeClient.On("ListBootVolumeAttachments", ctx, core.ListBootVolumeAttachmentsRequest{
+				AvailabilityDomain: common.String("ad"),
+				CompartmentId:      common.String("compartment"),
+				InstanceId:         common.String(inst),
+			}).Return(core.ListBootVolumeAttachmentsResponse{
+				Items: []core.BootVolumeAttachment{{BootVolumeId: common.String("ocid1.bootvolume.oc1..aaaa")}},
+			}, nil)
+			mockBlockstorageClient.On("GetBootVolume", ctx, core.GetBootVolumeRequest{
+				BootVolumeId: common.String("ocid1.bootvolume.oc1..aaaa"),
+			}).Return(core.GetBootVolumeResponse{
+				BootVolume: core.BootVolume{FreeformTags: map[string]string{"CostCenter": "ci"}},
+			}, nil)
+			mockBlockstorageClient.On("UpdateBootVolume", ctx, core.UpdateBootVolumeRequest{
+				BootVolumeId: common.String("ocid1.bootvolume.oc1..aaaa"),
+				UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+					FreeformTags: tt.expectedTags,
+				},
+			}).Return(core.UpdateBootVolumeResponse{}, tt.updateErr)
+			mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+				InstanceId:         common.String(inst),
+				PreserveBootVolume: common.Bool(true),
+			}).Return(core.TerminateInstanceResponse{}, nil)
+
+			err := ociCli.DeleteInstance(ctx, inst)
+			require.NoError(t, err)
+			mockBlockstorageClient.AssertExpectations(t)
+			mockComputeClient.AssertExpectations(t)
+		})
+	}
+}
+
+func setBootVolumeAttachmentPollInterval(t *testing.T, interval time.Duration) {
+	previous := bootVolumeAttachmentPollInterval
+	bootVolumeAttachmentPollInterval = interval
+	t.Cleanup(func() { bootVolumeAttachmentPollInterval = previous })
+}
+
+func TestCreateInstanceDetachedAutotune(t *testing.T) {
+	setBootVolumeAttachmentPollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain:         "ad",
+		CompartmentID:              "compartment",
+		SubnetID:                   "subnet",
+		NsgID:                      "nsg",
+		BootVolumeSize:             255,
+		BootVolumeDetachedAutotune: true,
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	instance := core.Instance{
+		Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		AvailabilityDomain: common.String("ad"),
+		CompartmentId:      common.String("compartment"),
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: instance,
+	}, nil)
+	attachments := core.ListBootVolumeAttachmentsRequest{
+		AvailabilityDomain: common.String("ad"),
+		CompartmentId:      common.String("compartment"),
+		InstanceId:         instance.Id,
+	}
+	// The boot volume is not attached yet when the launch returns.
+	mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, attachments).Return(core.ListBootVolumeAttachmentsResponse{}, nil).Once()
+	mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, attachments).Return(core.ListBootVolumeAttachmentsResponse{
+		Items: []core.BootVolumeAttachment{{
+			BootVolumeId:   common.String("ocid1.bootvolume.oc1..boot"),
+			LifecycleState: core.BootVolumeAttachmentLifecycleStateAttaching,
+		}},
+	}, nil).Once()
+	mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, attachments).Return(core.ListBootVolumeAttachmentsResponse{
+		Items: []core.BootVolumeAttachment{{
+			BootVolumeId:   common.String("ocid1.bootvolume.oc1..boot"),
+			LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+		}},
+	}, nil)
+	mockBlockstorageClient.On("UpdateBootVolume", ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId: common.String("ocid1.bootvolume.oc1..boot"),
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+			IsAutoTuneEnabled: common.Bool(true),
+		},
+	}).Return(core.UpdateBootVolumeResponse{}, nil)
+
+	result, err := ociCli.CreateInstance(ctx, &spec)
+
+	require.NoError(t, err)
+	assert.Equal(t, instance, result)
+	mockBlockstorageClient.AssertExpectations(t)
+	mockComputeClient.AssertNumberOfCalls(t, "ListBootVolumeAttachments", 3)
+}
+
+func TestCreateInstanceBootVolumeVpusPerGB(t *testing.T) {
+	tests := []struct {
+		name              string
+		vpusPerGB         int64
+		expectedVpusPerGB *int64
+	}{
+		{name: "higher performance", vpusPerGB: 20, expectedVpusPerGB: common.Int64(20)},
+		{name: "balanced is the volume default", vpusPerGB: 10},
+		{name: "unset", vpusPerGB: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockBlockstorageClient := new(MockBlockstorageClient)
+			ociCli := &OciCli{
+				computeClient:      mockComputeClient,
+				blockstorageClient: mockBlockstorageClient,
+				cfg:                cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:  "ad",
+				CompartmentID:       "compartment",
+				SubnetID:            "subnet",
+				NsgID:               "nsg",
+				BootVolumeSize:      255,
+				BootVolumeVpusPerGB: tt.vpusPerGB,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Windows,
+				},
+			}
+			instance := core.Instance{
+				Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				AvailabilityDomain: common.String("ad"),
+				CompartmentId:      common.String("compartment"),
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: instance,
+			}, nil)
+			mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, mock.Anything).Return(core.ListBootVolumeAttachmentsResponse{
+				Items: []core.BootVolumeAttachment{{
+					BootVolumeId:   common.String("ocid1.bootvolume.oc1..boot"),
+					LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+				}},
+			}, nil)
+			mockBlockstorageClient.On("UpdateBootVolume", ctx, mock.Anything).Return(core.UpdateBootVolumeResponse{}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+
+			if tt.expectedVpusPerGB == nil {
+				mockBlockstorageClient.AssertNotCalled(t, "UpdateBootVolume", ctx, mock.Anything)
+				return
+			}
+			mockBlockstorageClient.AssertCalled(t, "UpdateBootVolume", ctx, core.UpdateBootVolumeRequest{
+				BootVolumeId: common.String("ocid1.bootvolume.oc1..boot"),
+				UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+					VpusPerGB: tt.expectedVpusPerGB,
+				},
+			})
+		})
+	}
+}
+
+func TestCreateInstanceWindowsDefaultBootVolumeVpusPerGB(t *testing.T) {
+	setBootVolumeAttachmentPollInterval(t, time.Millisecond)
+	defaultToolFetch := spec.DefaultToolFetch
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return params.RunnerApplicationDownload{
+			OS:           common.String("win"),
+			Architecture: common.String("x64"),
+			DownloadURL:  common.String("MockURL"),
+			Filename:     common.String("garm-runner"),
+		}, nil
+	}
+	t.Cleanup(func() { spec.DefaultToolFetch = defaultToolFetch })
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	// No boot_volume_vpus_per_gb, Windows runners default to 20.
+	spec, err := spec.GetRunnerSpecFromBootstrapParams(cfg, params.BootstrapInstance{
+		Name:       "garm-instance",
+		Flavor:     "VM.Standard.E4.Flex",
+		Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+		OSType:     params.Windows,
+		OSArch:     params.Amd64,
+		PoolID:     "my-pool",
+		ExtraSpecs: json.RawMessage(`{}`),
+	}, "controller")
+	require.NoError(t, err)
+	instance := core.Instance{
+		Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		AvailabilityDomain: common.String("ad"),
+		CompartmentId:      common.String("compartment"),
+		LifecycleState:     core.InstanceLifecycleStateProvisioning,
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: instance,
+	}, nil)
+	// The instance is still provisioning and has no boot volume attachment
+	// when the launch returns.
+	mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, mock.Anything).Return(core.ListBootVolumeAttachmentsResponse{}, nil).Once()
+	mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, mock.Anything).Return(core.ListBootVolumeAttachmentsResponse{
+		Items: []core.BootVolumeAttachment{{
+			BootVolumeId:   common.String("ocid1.bootvolume.oc1..boot"),
+			LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+		}},
+	}, nil)
+	mockBlockstorageClient.On("UpdateBootVolume", ctx, core.UpdateBootVolumeRequest{
+		BootVolumeId: common.String("ocid1.bootvolume.oc1..boot"),
+		UpdateBootVolumeDetails: core.UpdateBootVolumeDetails{
+			VpusPerGB: common.Int64(20),
+		},
+	}).Return(core.UpdateBootVolumeResponse{}, nil)
+
+	_, err = ociCli.CreateInstance(ctx, spec)
+
+	require.NoError(t, err)
+	mockBlockstorageClient.AssertExpectations(t)
+	mockComputeClient.AssertNumberOfCalls(t, "ListBootVolumeAttachments", 2)
+}
+
+func TestCreateInstanceBootVolumeTuningFailure(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	mockBlockstorageClient := new(MockBlockstorageClient)
+	ociCli := &OciCli{
+		computeClient:      mockComputeClient,
+		blockstorageClient: mockBlockstorageClient,
+		cfg:                cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain:  "ad",
+		CompartmentID:       "compartment",
+		SubnetID:            "subnet",
+		NsgID:               "nsg",
+		BootVolumeSize:      255,
+		BootVolumeVpusPerGB: 30,
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	instance := core.Instance{
+		Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		AvailabilityDomain: common.String("ad"),
+		CompartmentId:      common.String("compartment"),
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: instance,
+	}, nil)
+	mockComputeClient.On("ListBootVolumeAttachments", mock.Anything, mock.Anything).Return(core.ListBootVolumeAttachmentsResponse{
+		Items: []core.BootVolumeAttachment{{
+			BootVolumeId:   common.String("ocid1.bootvolume.oc1..boot"),
+			LifecycleState: core.BootVolumeAttachmentLifecycleStateAttached,
+		}},
+	}, nil)
+	mockBlockstorageClient.On("UpdateBootVolume", ctx, mock.Anything).Return(core.UpdateBootVolumeResponse{}, fmt.Errorf("conflict"))
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId: instance.Id,
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+
+	require.ErrorContains(t, err, "error tuning the boot volume of instance ocid1.instance.oc1.iad.aaaaaaaamf7: error updating boot volume performance: conflict")
+	mockComputeClient.AssertExpectations(t)
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// resolveCapacityReservationID returns the OCID of the compute capacity
+// reservation the instance should be launched in, or an empty string if none
+// was requested. An explicit OCID always wins, otherwise the display name is
+// looked up in the availability domain and must match exactly one reservation.
+func (o *OciCli) resolveCapacityReservationID(ctx context.Context, spec *spec.RunnerSpec) (string, error) {
+	if spec.CapacityReservationID != "" || spec.CapacityReservationName == "" {
+		return spec.CapacityReservationID, nil
+	}
+
+	request := core.ListComputeCapacityReservationsRequest{
+		CompartmentId:      &spec.CompartmentID,
+		AvailabilityDomain: &spec.AvailabilityDomain,
+		DisplayName:        &spec.CapacityReservationName,
+	}
+	var matches []string
+	for {
+		resp, err := o.computeClient.ListComputeCapacityReservations(ctx, request)
+		if err != nil {
+			return "", fmt.Errorf("error listing compute capacity reservations: %w", err)
+		}
+		for _, reservation := range resp.Items {
+			if reservation.LifecycleState == core.ComputeCapacityReservationLifecycleStateDeleting || reservation.LifecycleState == core.ComputeCapacityReservationLifecycleStateDeleted {
+				continue
+			}
+			matches = append(matches, *reservation.Id)
+		}
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			break
+		}
+		request.Page = resp.OpcNextPage
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("compute capacity reservation %q not found in availability domain %s", spec.CapacityReservationName, spec.AvailabilityDomain)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("compute capacity reservation name %q is not unique in availability domain %s, found %d reservations", spec.CapacityReservationName, spec.AvailabilityDomain, len(matches))
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/tracing"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/common/auth"
+	"github.com/oracle/oci-go-sdk/v49/secrets"
+)
+
+// CredentialProvider builds the OCI configuration provider used to
+// authenticate the SDK clients.
+type CredentialProvider interface {
+	ConfigurationProvider() (common.ConfigurationProvider, error)
+}
+
+// SecretsClientInterface reads secrets stored in OCI Vault.
+type SecretsClientInterface interface {
+	GetSecretBundle(ctx context.Context, request secrets.GetSecretBundleRequest) (secrets.GetSecretBundleResponse, error)
+}
+
+// NewRawConfigCredentialProvider returns a CredentialProvider that signs
+// requests with the API key described in the provider config.
+func NewRawConfigCredentialProvider(cfg *config.Config) CredentialProvider {
+	return &rawConfigCredentialProvider{
+		cfg: cfg,
+	}
+}
+
+// NewInstancePrincipalCredentialProvider returns a CredentialProvider that
+// signs requests as the OCI instance the provider runs on.
+func NewInstancePrincipalCredentialProvider(cfg *config.Config) CredentialProvider {
+	return &instancePrincipalCredentialProvider{
+		cfg: cfg,
+	}
+}
+
+// newCredentialProvider returns the CredentialProvider of the auth method
+// selected in the config.
+func newCredentialProvider(cfg *config.Config) CredentialProvider {
+	if cfg.GetAuthMethod() == config.AuthMethodInstancePrincipal {
+		return NewInstancePrincipalCredentialProvider(cfg)
+	}
+	return NewRawConfigCredentialProvider(cfg)
+}
+
+type instancePrincipalCredentialProvider struct {
+	cfg *config.Config
+}
+
+func (i *instancePrincipalCredentialProvider) ConfigurationProvider() (common.ConfigurationProvider, error) {
+	confProvider, err := auth.InstancePrincipalConfigurationProviderForRegion(common.StringToRegion(i.cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("error getting instance principal: %w", err)
+	}
+	return confProvider, nil
+}
+
+type rawConfigCredentialProvider struct {
+	cfg *config.Config
+	// secretsClient reads the private key password from Vault. When nil, a
+	// client authenticated with the instance principal is created.
+	secretsClient SecretsClientInterface
+}
+
+func (r *rawConfigCredentialProvider) ConfigurationProvider() (common.ConfigurationProvider, error) {
+	privateKey, err := r.cfg.GetPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("error getting private key: %w", err)
+	}
+	password, err := r.privateKeyPassword(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error getting private key password: %w", err)
+	}
+	return common.NewRawConfigurationProvider(
+		r.cfg.TenancyID,
+		r.cfg.UserID,
+		r.cfg.Region,
+		r.cfg.Fingerprint,
+		privateKey,
+		common.String(password),
+	), nil
+}
+
+// privateKeyPassword returns the password of the private key, reading it from
+// Vault if private_key_password_secret_id is set. The API key can't sign any
+// request before its password is known, so the secret is read with the
+// instance principal of the instance the provider runs on.
+func (r *rawConfigCredentialProvider) privateKeyPassword(ctx context.Context) (string, error) {
+	secretID := r.cfg.PrivateKeyPasswordSecretID
+	if secretID == "" {
+		return r.cfg.PrivateKeyPassword, nil
+	}
+	if r.secretsClient == nil {
+		confProvider, err := auth.InstancePrincipalConfigurationProvider()
+		if err != nil {
+			return "", fmt.Errorf("error getting instance principal: %w", err)
+		}
+		secretsClient, err := secrets.NewSecretsClientWithConfigurationProvider(confProvider)
+		if err != nil {
+			return "", fmt.Errorf("error creating secrets client: %w", err)
+		}
+		secretsClient.HTTPClient = tracing.WrapDispatcher(secretsClient.HTTPClient)
+		r.secretsClient = secretsClient
+	}
+	password, err := readSecret(ctx, r.secretsClient, secretID)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret %s: %w", secretID, err)
+	}
+	return password, nil
+}
+
+// readSecret returns the decoded content of the current version of the
+// secret.
+func readSecret(ctx context.Context, secretsClient SecretsClientInterface, secretID string) (string, error) {
+	response, err := secretsClient.GetSecretBundle(ctx, secrets.GetSecretBundleRequest{
+		SecretId: &secretID,
+	})
+	if err != nil {
+		return "", err
+	}
+	content, ok := response.SecretBundleContent.(secrets.Base64SecretBundleContentDetails)
+	if !ok || content.Content == nil {
+		return "", fmt.Errorf("secret has no base64 content")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(*content.Content)
+	if err != nil {
+		return "", fmt.Errorf("error decoding secret content: %w", err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCredentialProvider struct {
+	provider common.ConfigurationProvider
+	err      error
+}
+
+func (f *fakeCredentialProvider) ConfigurationProvider() (common.ConfigurationProvider, error) {
+	return f.provider, f.err
+}
+
+func generatePrivateKey(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+func TestNewOciCliWithCredentialProvider(t *testing.T) {
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		Region:             "us-ashburn-1",
+	}
+
+	t.Run("fake credential provider", func(t *testing.T) {
+		credentials := &fakeCredentialProvider{
+			provider: common.NewRawConfigurationProvider("tenancy", "user", "us-ashburn-1", "fingerprint", generatePrivateKey(t), nil),
+		}
+		ociCli, err := NewOciCliWithCredentialProvider(context.Background(), cfg, credentials)
+		require.NoError(t, err)
+		require.NotNil(t, ociCli.ComputeClient())
+		require.Equal(t, cfg, ociCli.Config())
+	})
+
+	t.Run("credential provider error", func(t *testing.T) {
+		credentials := &fakeCredentialProvider{
+			err: fmt.Errorf("no credentials"),
+		}
+		_, err := NewOciCliWithCredentialProvider(context.Background(), cfg, credentials)
+		require.EqualError(t, err, "error getting configuration provider: no credentials")
+	})
+}
+
+func TestRawConfigCredentialProvider(t *testing.T) {
+	keyFile, err := os.CreateTemp("", "test.pem")
+	require.NoError(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.WriteString(generatePrivateKey(t))
+	require.NoError(t, err)
+	require.NoError(t, keyFile.Close())
+
+	cfg := &config.Config{
+		TenancyID:      "tenancy",
+		UserID:         "user",
+		Region:         "us-ashburn-1",
+		Fingerprint:    "fingerprint",
+		PrivateKeyPath: keyFile.Name(),
+	}
+	provider, err := NewRawConfigCredentialProvider(cfg).ConfigurationProvider()
+	require.NoError(t, err)
+	ok, err := common.IsConfigurationProviderValid(provider)
+	require.NoError(t, err)
+	require.True(t, ok)
+	keyID, err := provider.KeyID()
+	require.NoError(t, err)
+	require.Equal(t, "tenancy/user/fingerprint", keyID)
+
+	cfg.PrivateKeyPath = "nonexistent.pem"
+	_, err = NewRawConfigCredentialProvider(cfg).ConfigurationProvider()
+	require.ErrorContains(t, err, "error getting private key")
+}
+
+func TestPrivateKeyPasswordFromSecret(t *testing.T) {
+	ctx := context.Background()
+	secretID := "ocid1.vaultsecret.oc1.iad.aaaa"
+	tests := []struct {
+		name      string
+		content   secrets.SecretBundleContentDetails
+		err       error
+		expected  string
+		errString string
+	}{
+		{
+			name:     "base64 secret",
+			content:  secrets.Base64SecretBundleContentDetails{Content: common.String(base64.StdEncoding.EncodeToString([]byte("s3cret")))},
+			expected: "s3cret",
+		},
+		{
+			name:      "unreadable secret",
+			err:       fmt.Errorf("not authorized"),
+			errString: "error reading secret ocid1.vaultsecret.oc1.iad.aaaa: not authorized",
+		},
+		{
+			name:      "secret without content",
+			errString: "error reading secret ocid1.vaultsecret.oc1.iad.aaaa: secret has no base64 content",
+		},
+		{
+			name:      "invalid base64 content",
+			content:   secrets.Base64SecretBundleContentDetails{Content: common.String("not base64!")},
+			errString: "error reading secret ocid1.vaultsecret.oc1.iad.aaaa: error decoding secret content",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSecretsClient := new(MockSecretsClient)
+			mockSecretsClient.On("GetSecretBundle", ctx, secrets.GetSecretBundleRequest{
+				SecretId: &secretID,
+			}).Return(secrets.GetSecretBundleResponse{
+				SecretBundle: secrets.SecretBundle{SecretBundleContent: tt.content},
+			}, tt.err)
+			credentials := &rawConfigCredentialProvider{
+				cfg:           &config.Config{PrivateKeyPasswordSecretID: secretID},
+				secretsClient: mockSecretsClient,
+			}
+
+			password, err := credentials.privateKeyPassword(ctx)
+			if tt.errString != "" {
+				require.ErrorContains(t, err, tt.errString)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, password)
+		})
+	}
+}
+
+func TestNewCredentialProvider(t *testing.T) {
+	credentials := newCredentialProvider(&config.Config{})
+	require.IsType(t, &rawConfigCredentialProvider{}, credentials)
+
+	credentials = newCredentialProvider(&config.Config{AuthMethod: config.AuthMethodAPIKey})
+	require.IsType(t, &rawConfigCredentialProvider{}, credentials)
+
+	credentials = newCredentialProvider(&config.Config{AuthMethod: config.AuthMethodInstancePrincipal})
+	require.IsType(t, &instancePrincipalCredentialProvider{}, credentials)
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// specHashTag holds the hash of the spec the instance was launched with.
+const specHashTag = "GARM_SPEC_HASH"
+
+// ListDriftedInstances returns the instances of the pool that were launched
+// with a spec other than the one with the given hash, including instances
+// launched before the hash was recorded.
+func (o *OciCli) ListDriftedInstances(ctx context.Context, poolID, specHash string) ([]core.Instance, error) {
+	instances, err := o.ListInstances(ctx, poolID)
+	if err != nil {
+		return nil, err
+	}
+	drifted := []core.Instance{}
+	for _, instance := range instances {
+		if instance.FreeformTags[specHashTag] != specHash {
+			drifted = append(drifted, instance)
+		}
+	}
+	return drifted, nil
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// faultDomains are the fault domains of an availability domain.
+var faultDomains = []string{"FAULT-DOMAIN-1", "FAULT-DOMAIN-2", "FAULT-DOMAIN-3"}
+
+// spreadFaultDomain returns the fault domain of the availability domain with
+// the fewest live instances of the pool, the first one on a tie, so that
+// consecutive launches go round-robin across the fault domains.
+func (o *OciCli) spreadFaultDomain(ctx context.Context, spec *spec.RunnerSpec) (string, error) {
+	instances, err := o.listCompartmentInstances(ctx, o.computeClient)
+	if err != nil {
+		return "", fmt.Errorf("error listing instances: %w", err)
+	}
+	counts := map[string]int{}
+	for _, instance := range instances {
+		if instance.FreeformTags["GARM_POOL_ID"] != spec.BootstrapParams.PoolID || instance.FaultDomain == nil {
+			continue
+		}
+		if instance.LifecycleState == core.InstanceLifecycleStateTerminating || instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+			continue
+		}
+		if instance.AvailabilityDomain != nil && *instance.AvailabilityDomain != spec.AvailabilityDomain {
+			continue
+		}
+		counts[*instance.FaultDomain]++
+	}
+	spread := faultDomains[0]
+	for _, faultDomain := range faultDomains[1:] {
+		if counts[faultDomain] < counts[spread] {
+			spread = faultDomain
+		}
+	}
+	return spread, nil
+}
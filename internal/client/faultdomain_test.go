@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstanceFaultDomainSpread(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	// Instances of other pools, other availability domains or that are
+	// going away don't count.
+	pool := []core.Instance{
+		{
+			Id:                 common.String("ocid1.instance.oc1.iad.other-pool"),
+			AvailabilityDomain: common.String("ad"),
+			FaultDomain:        common.String("FAULT-DOMAIN-1"),
+			FreeformTags:       map[string]string{"GARM_POOL_ID": "other-pool"},
+			LifecycleState:     core.InstanceLifecycleStateRunning,
+		},
+		{
+			Id:                 common.String("ocid1.instance.oc1.iad.other-ad"),
+			AvailabilityDomain: common.String("other-ad"),
+			FaultDomain:        common.String("FAULT-DOMAIN-1"),
+			FreeformTags:       map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState:     core.InstanceLifecycleStateRunning,
+		},
+		{
+			Id:                 common.String("ocid1.instance.oc1.iad.terminating"),
+			AvailabilityDomain: common.String("ad"),
+			FaultDomain:        common.String("FAULT-DOMAIN-1"),
+			FreeformTags:       map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState:     core.InstanceLifecycleStateTerminating,
+		},
+	}
+
+	var assigned []string
+	for i := 0; i < 4; i++ {
+		mockComputeClient := new(MockComputeClient)
+		ociCli := &OciCli{
+			computeClient: mockComputeClient,
+			cfg:           cfg,
+		}
+		spec := spec.RunnerSpec{
+			AvailabilityDomain: "ad",
+			CompartmentID:      "compartment",
+			SubnetID:           "subnet",
+			NsgID:              "nsg",
+			FaultDomainSpread:  true,
+			BootstrapParams: params.BootstrapInstance{
+				Name:   fmt.Sprintf("garm-instance-%d", i),
+				PoolID: "my-pool",
+				Flavor: "VM.Standard.E4.Flex",
+				Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+				OSType: params.Linux,
+			},
+		}
+		mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+			Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+		}, nil)
+		mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+		mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+			CompartmentId: &cfg.CompartmentId,
+		}).Return(core.ListInstancesResponse{Items: pool}, nil)
+		mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+			Instance: core.Instance{Id: common.String(fmt.Sprintf("ocid1.instance.oc1.iad.%d", i))},
+		}, nil)
+
+		_, err := ociCli.CreateInstance(ctx, &spec)
+		require.NoError(t, err)
+		req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+		require.NotNil(t, req.LaunchInstanceDetails.FaultDomain)
+		faultDomain := *req.LaunchInstanceDetails.FaultDomain
+		assigned = append(assigned, faultDomain)
+		pool = append(pool, core.Instance{
+			Id:                 common.String(fmt.Sprintf("ocid1.instance.oc1.iad.%d", i)),
+			AvailabilityDomain: common.String("ad"),
+			FaultDomain:        common.String(faultDomain),
+			FreeformTags:       map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState:     core.InstanceLifecycleStateProvisioning,
+		})
+	}
+
+	require.Equal(t, []string{"FAULT-DOMAIN-1", "FAULT-DOMAIN-2", "FAULT-DOMAIN-3", "FAULT-DOMAIN-1"}, assigned)
+}
+
+func TestSpreadFaultDomainFillsGaps(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{CompartmentId: "compartment"}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	instance := func(faultDomain string) core.Instance {
+		return core.Instance{
+			AvailabilityDomain: common.String("ad"),
+			FaultDomain:        common.String(faultDomain),
+			FreeformTags:       map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState:     core.InstanceLifecycleStateRunning,
+		}
+	}
+	mockComputeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{
+		Items: []core.Instance{instance("FAULT-DOMAIN-1"), instance("FAULT-DOMAIN-1"), instance("FAULT-DOMAIN-3")},
+	}, nil)
+
+	faultDomain, err := ociCli.spreadFaultDomain(ctx, &spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		BootstrapParams:    params.BootstrapInstance{PoolID: "my-pool"},
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, "FAULT-DOMAIN-2", faultDomain)
+}
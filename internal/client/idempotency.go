@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	garmErrors "github.com/cloudbase/garm-provider-common/errors"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// findLaunchedInstance returns the instance an earlier attempt to create the
+// instance of the spec already launched, or nil if there is none. Instances
+// that are being terminated don't count, a new one is launched instead.
+func (o *OciCli) findLaunchedInstance(ctx context.Context, spec *spec.RunnerSpec) (*core.Instance, error) {
+	instance, err := o.FindInstanceByTags(ctx, map[string]string{
+		"Name":               spec.BootstrapParams.Name,
+		"GARM_POOL_ID":       spec.BootstrapParams.PoolID,
+		"GARM_CONTROLLER_ID": spec.ControllerID,
+	})
+	if err != nil {
+		if errors.Is(err, garmErrors.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error looking for an already launched instance: %w", err)
+	}
+	if instance.LifecycleState == core.InstanceLifecycleStateTerminating {
+		return nil, nil
+	}
+	return instance, nil
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstanceIdempotent(t *testing.T) {
+	instance := func(id, name string, state core.InstanceLifecycleStateEnum) core.Instance {
+		return core.Instance{
+			Id:             common.String(id),
+			LifecycleState: state,
+			FreeformTags: map[string]string{
+				"Name":               name,
+				"GARM_POOL_ID":       "my-pool",
+				"GARM_CONTROLLER_ID": "controller",
+			},
+		}
+	}
+	tests := []struct {
+		name       string
+		instances  []core.Instance
+		expectedID string
+		launched   bool
+	}{
+		{
+			name: "instance already launched",
+			instances: []core.Instance{
+				instance("ocid1.instance.oc1.iad.other", "garm-other", core.InstanceLifecycleStateRunning),
+				instance("ocid1.instance.oc1.iad.existing", "garm-instance", core.InstanceLifecycleStateProvisioning),
+			},
+			expectedID: "ocid1.instance.oc1.iad.existing",
+		},
+		{
+			name: "no instance launched yet",
+			instances: []core.Instance{
+				instance("ocid1.instance.oc1.iad.other", "garm-other", core.InstanceLifecycleStateRunning),
+				instance("ocid1.instance.oc1.iad.terminated", "garm-instance", core.InstanceLifecycleStateTerminated),
+			},
+			expectedID: "ocid1.instance.oc1.iad.launched",
+			launched:   true,
+		},
+		{
+			name: "instance of the same name being terminated",
+			instances: []core.Instance{
+				instance("ocid1.instance.oc1.iad.terminating", "garm-instance", core.InstanceLifecycleStateTerminating),
+			},
+			expectedID: "ocid1.instance.oc1.iad.launched",
+			launched:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				IdempotentCreate:   true,
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				ControllerID:       "controller",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					PoolID: "my-pool",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+				CompartmentId: common.String("compartment"),
+			}).Return(core.ListInstancesResponse{Items: tt.instances}, nil)
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.launched")},
+			}, nil)
+
+			result, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedID, *result.Id)
+			if tt.launched {
+				mockComputeClient.AssertNumberOfCalls(t, "LaunchInstance", 1)
+			} else {
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/cloudbase/garm-provider-oci/internal/util"
+)
+
+// instanceMetadata returns the metadata the instance is launched with, with
+// the environment variable references of the extra metadata resolved. It
+// also returns the keys whose values were resolved from the environment, so
+// they can be redacted from the logs.
+func (o *OciCli) instanceMetadata(spec *spec.RunnerSpec) (map[string]string, []string, error) {
+	metadata := map[string]string{
+		o.cfg.UserDataKey():   spec.UserData,
+		"ssh_authorized_keys": strings.Join(spec.SSHPublicKeys, "\n"),
+	}
+	var resolvedKeys []string
+	for key, value := range spec.Metadata {
+		if _, ok := metadata[key]; ok {
+			return nil, nil, fmt.Errorf("metadata key %s is set by the provider", key)
+		}
+		expanded, referenced, err := util.ExpandEnv(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error resolving metadata %s: %w", key, err)
+		}
+		metadata[key] = expanded
+		if referenced {
+			resolvedKeys = append(resolvedKeys, key)
+		}
+	}
+	return metadata, resolvedKeys, nil
+}
@@ -17,8 +17,11 @@ package client
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/oracle/oci-go-sdk/v49/identity"
+	"github.com/oracle/oci-go-sdk/v49/secrets"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -50,3 +53,182 @@ func (m *MockComputeClient) InstanceAction(ctx context.Context, request core.Ins
 	args := m.Called(ctx, request)
 	return args.Get(0).(core.InstanceActionResponse), args.Error(1)
 }
+
+func (m *MockComputeClient) GetImage(ctx context.Context, request core.GetImageRequest) (core.GetImageResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.GetImageResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) ListShapes(ctx context.Context, request core.ListShapesRequest) (core.ListShapesResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListShapesResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) ListComputeCapacityReservations(ctx context.Context, request core.ListComputeCapacityReservationsRequest) (core.ListComputeCapacityReservationsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListComputeCapacityReservationsResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) ListVnicAttachments(ctx context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListVnicAttachmentsResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) ListImages(ctx context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListImagesResponse), args.Error(1)
+}
+
+type MockIdentityClient struct {
+	mock.Mock
+}
+
+func (m *MockIdentityClient) AssembleEffectiveTagSet(ctx context.Context, request identity.AssembleEffectiveTagSetRequest) (identity.AssembleEffectiveTagSetResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(identity.AssembleEffectiveTagSetResponse), args.Error(1)
+}
+
+func (m *MockIdentityClient) ListAvailabilityDomains(ctx context.Context, request identity.ListAvailabilityDomainsRequest) (identity.ListAvailabilityDomainsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(identity.ListAvailabilityDomainsResponse), args.Error(1)
+}
+
+func (m *MockIdentityClient) GetTagNamespace(ctx context.Context, request identity.GetTagNamespaceRequest) (identity.GetTagNamespaceResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(identity.GetTagNamespaceResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) ListBootVolumeAttachments(ctx context.Context, request core.ListBootVolumeAttachmentsRequest) (core.ListBootVolumeAttachmentsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListBootVolumeAttachmentsResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) UpdateInstance(ctx context.Context, request core.UpdateInstanceRequest) (core.UpdateInstanceResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.UpdateInstanceResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) AttachVolume(ctx context.Context, request core.AttachVolumeRequest) (core.AttachVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.AttachVolumeResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) ListVolumeAttachments(ctx context.Context, request core.ListVolumeAttachmentsRequest) (core.ListVolumeAttachmentsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListVolumeAttachmentsResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) GetVolumeAttachment(ctx context.Context, request core.GetVolumeAttachmentRequest) (core.GetVolumeAttachmentResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.GetVolumeAttachmentResponse), args.Error(1)
+}
+
+func (m *MockComputeClient) DetachVolume(ctx context.Context, request core.DetachVolumeRequest) (core.DetachVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.DetachVolumeResponse), args.Error(1)
+}
+
+type MockBlockstorageClient struct {
+	mock.Mock
+}
+
+func (m *MockBlockstorageClient) GetBootVolume(ctx context.Context, request core.GetBootVolumeRequest) (core.GetBootVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.GetBootVolumeResponse), args.Error(1)
+}
+
+func (m *MockBlockstorageClient) ListBootVolumes(ctx context.Context, request core.ListBootVolumesRequest) (core.ListBootVolumesResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListBootVolumesResponse), args.Error(1)
+}
+
+func (m *MockBlockstorageClient) UpdateBootVolume(ctx context.Context, request core.UpdateBootVolumeRequest) (core.UpdateBootVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.UpdateBootVolumeResponse), args.Error(1)
+}
+
+func (m *MockBlockstorageClient) CreateVolume(ctx context.Context, request core.CreateVolumeRequest) (core.CreateVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.CreateVolumeResponse), args.Error(1)
+}
+
+func (m *MockBlockstorageClient) GetVolume(ctx context.Context, request core.GetVolumeRequest) (core.GetVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.GetVolumeResponse), args.Error(1)
+}
+
+func (m *MockBlockstorageClient) DeleteVolume(ctx context.Context, request core.DeleteVolumeRequest) (core.DeleteVolumeResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.DeleteVolumeResponse), args.Error(1)
+}
+
+func (m *MockBlockstorageClient) ListVolumes(ctx context.Context, request core.ListVolumesRequest) (core.ListVolumesResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListVolumesResponse), args.Error(1)
+}
+
+type MockNetworkClient struct {
+	mock.Mock
+}
+
+func (m *MockNetworkClient) GetSubnet(ctx context.Context, request core.GetSubnetRequest) (core.GetSubnetResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.GetSubnetResponse), args.Error(1)
+}
+
+func (m *MockNetworkClient) ListNetworkSecurityGroups(ctx context.Context, request core.ListNetworkSecurityGroupsRequest) (core.ListNetworkSecurityGroupsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListNetworkSecurityGroupsResponse), args.Error(1)
+}
+
+func (m *MockNetworkClient) ListPrivateIps(ctx context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.ListPrivateIpsResponse), args.Error(1)
+}
+
+func (m *MockNetworkClient) CreatePrivateIp(ctx context.Context, request core.CreatePrivateIpRequest) (core.CreatePrivateIpResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.CreatePrivateIpResponse), args.Error(1)
+}
+
+func (m *MockNetworkClient) GetVnic(ctx context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(core.GetVnicResponse), args.Error(1)
+}
+
+type MockSecretsClient struct {
+	mock.Mock
+}
+
+func (m *MockSecretsClient) GetSecretBundle(ctx context.Context, request secrets.GetSecretBundleRequest) (secrets.GetSecretBundleResponse, error) {
+	args := m.Called(ctx, request)
+	return args.Get(0).(secrets.GetSecretBundleResponse), args.Error(1)
+}
+
+// MockServiceError implements common.ServiceError so tests can simulate
+// failures returned by the OCI API.
+type MockServiceError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e MockServiceError) Error() string {
+	return fmt.Sprintf("Error returned by Service. Http Status Code: %d. Error Code: %s. Message: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e MockServiceError) GetHTTPStatusCode() int {
+	return e.StatusCode
+}
+
+func (e MockServiceError) GetMessage() string {
+	return e.Message
+}
+
+func (e MockServiceError) GetCode() string {
+	return e.Code
+}
+
+func (e MockServiceError) GetOpcRequestID() string {
+	return ""
+}
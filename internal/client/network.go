@@ -0,0 +1,351 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// maxNsgsPerVnic is the number of network security groups OCI allows on a
+// VNIC.
+const maxNsgsPerVnic = 5
+
+// uniqueNsgIDs drops the empty and repeated OCIDs of the list, keeping the
+// order of the first occurrences, as OCI rejects duplicates.
+func uniqueNsgIDs(nsgIDs []string) ([]string, error) {
+	var unique []string
+	seen := map[string]bool{}
+	for _, nsgID := range nsgIDs {
+		if nsgID == "" || seen[nsgID] {
+			continue
+		}
+		seen[nsgID] = true
+		unique = append(unique, nsgID)
+	}
+	if len(unique) > maxNsgsPerVnic {
+		return nil, fmt.Errorf("%d network security groups requested, OCI allows at most %d per VNIC", len(unique), maxNsgsPerVnic)
+	}
+	return unique, nil
+}
+
+// resolveNsgID returns the OCID of the network security group to attach to
+// the VNIC. An explicit OCID always wins, otherwise the display name is looked
+// up in the VCN the subnet belongs to and must match exactly one group.
+func (o *OciCli) resolveNsgID(ctx context.Context, spec *spec.RunnerSpec) (string, error) {
+	if spec.NsgID != "" || spec.NsgName == "" {
+		return spec.NsgID, nil
+	}
+	if o.networkClient == nil {
+		return "", fmt.Errorf("network security group %q can't be looked up without a network client", spec.NsgName)
+	}
+
+	subnet, err := o.networkClient.GetSubnet(ctx, core.GetSubnetRequest{
+		SubnetId: &spec.SubnetID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error getting subnet %s: %w", spec.SubnetID, err)
+	}
+
+	request := core.ListNetworkSecurityGroupsRequest{
+		CompartmentId: &spec.CompartmentID,
+		VcnId:         subnet.VcnId,
+		DisplayName:   &spec.NsgName,
+	}
+	var matches []string
+	for {
+		resp, err := o.networkClient.ListNetworkSecurityGroups(ctx, request)
+		if err != nil {
+			return "", fmt.Errorf("error listing network security groups: %w", err)
+		}
+		for _, nsg := range resp.Items {
+			if nsg.LifecycleState == core.NetworkSecurityGroupLifecycleStateTerminating || nsg.LifecycleState == core.NetworkSecurityGroupLifecycleStateTerminated {
+				continue
+			}
+			matches = append(matches, *nsg.Id)
+		}
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			break
+		}
+		request.Page = resp.OpcNextPage
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("network security group %q not found in vcn %s", spec.NsgName, *subnet.VcnId)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("network security group name %q is not unique in vcn %s, found %d groups", spec.NsgName, *subnet.VcnId, len(matches))
+	}
+}
+
+// reservedSubnetAddresses is the number of addresses OCI reserves in every
+// subnet: the network address, the default gateway and the broadcast address.
+const reservedSubnetAddresses = 3
+
+// checkSubnetCapacity verifies that the subnet still has a free private IP
+// address for the new VNIC. It is a no-op unless enabled in the config.
+func (o *OciCli) checkSubnetCapacity(ctx context.Context, subnetID string) error {
+	if !o.cfg.CheckSubnetCapacity {
+		return nil
+	}
+	if o.networkClient == nil {
+		slog.WarnContext(ctx, "network client unavailable, skipping subnet capacity check", "subnet_id", subnetID)
+		return nil
+	}
+	subnet, err := o.networkClient.GetSubnet(ctx, core.GetSubnetRequest{
+		SubnetId: &subnetID,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting subnet %s: %w", subnetID, err)
+	}
+	if subnet.CidrBlock == nil {
+		return fmt.Errorf("subnet %s has no IPv4 CIDR block", subnetID)
+	}
+	_, ipNet, err := net.ParseCIDR(*subnet.CidrBlock)
+	if err != nil {
+		return fmt.Errorf("error parsing CIDR block of subnet %s: %w", subnetID, err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	usable := (1 << (bits - ones)) - reservedSubnetAddresses
+
+	request := core.ListPrivateIpsRequest{
+		SubnetId: &subnetID,
+	}
+	used := 0
+	for {
+		resp, err := o.networkClient.ListPrivateIps(ctx, request)
+		if err != nil {
+			return fmt.Errorf("error listing private IPs of subnet %s: %w", subnetID, err)
+		}
+		used += len(resp.Items)
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			break
+		}
+		request.Page = resp.OpcNextPage
+	}
+
+	if used >= usable {
+		return fmt.Errorf("subnet %s exhausted: all %d private IP addresses of %s are in use", subnetID, usable, *subnet.CidrBlock)
+	}
+	return nil
+}
+
+// checkSecondaryPrivateIPs verifies, before the launch, that the requested
+// secondary private IPs are usable addresses of the subnet that are not in
+// use yet.
+func (o *OciCli) checkSecondaryPrivateIPs(ctx context.Context, spec *spec.RunnerSpec) error {
+	if len(spec.SecondaryPrivateIPs) == 0 && spec.SecondaryPrivateIPCount == 0 {
+		return nil
+	}
+	// The addresses are assigned with the network client after the launch,
+	// fail before launching an instance that couldn't get them.
+	if o.networkClient == nil {
+		return fmt.Errorf("secondary private IPs can't be assigned without a network client")
+	}
+	if len(spec.SecondaryPrivateIPs) == 0 {
+		return nil
+	}
+	subnet, err := o.networkClient.GetSubnet(ctx, core.GetSubnetRequest{
+		SubnetId: &spec.SubnetID,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting subnet %s: %w", spec.SubnetID, err)
+	}
+	if subnet.CidrBlock == nil {
+		return fmt.Errorf("subnet %s has no IPv4 CIDR block", spec.SubnetID)
+	}
+	prefix, err := netip.ParsePrefix(*subnet.CidrBlock)
+	if err != nil {
+		return fmt.Errorf("error parsing CIDR block of subnet %s: %w", spec.SubnetID, err)
+	}
+	prefix = prefix.Masked()
+	for _, ip := range spec.SecondaryPrivateIPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return fmt.Errorf("invalid secondary private IP %q: %w", ip, err)
+		}
+		if !prefix.Contains(addr) {
+			return fmt.Errorf("secondary private IP %s is not in the CIDR block %s of subnet %s", ip, prefix, spec.SubnetID)
+		}
+		if isReservedSubnetAddress(prefix, addr) {
+			return fmt.Errorf("secondary private IP %s is reserved by OCI in subnet %s", ip, spec.SubnetID)
+		}
+		resp, err := o.networkClient.ListPrivateIps(ctx, core.ListPrivateIpsRequest{
+			SubnetId:  &spec.SubnetID,
+			IpAddress: common.String(ip),
+		})
+		if err != nil {
+			return fmt.Errorf("error looking up private IP %s: %w", ip, err)
+		}
+		if len(resp.Items) > 0 {
+			return fmt.Errorf("secondary private IP %s is already in use in subnet %s", ip, spec.SubnetID)
+		}
+	}
+	return nil
+}
+
+// isReservedSubnetAddress reports whether addr is one of the addresses OCI
+// reserves in the subnet: the network address, the default gateway and the
+// broadcast address.
+func isReservedSubnetAddress(prefix netip.Prefix, addr netip.Addr) bool {
+	network := prefix.Addr()
+	if addr == network || addr == network.Next() {
+		return true
+	}
+	broadcast := network.As4()
+	hostBits := 32 - prefix.Bits()
+	for i := 0; i < hostBits; i++ {
+		broadcast[3-i/8] |= 1 << (i % 8)
+	}
+	return addr == netip.AddrFrom4(broadcast)
+}
+
+var (
+	// vnicAttachmentPollInterval is how often the VNIC attachments of a
+	// launched instance are polled while waiting for its primary VNIC.
+	vnicAttachmentPollInterval = 5 * time.Second
+	// vnicAttachmentTimeout bounds the wait for the primary VNIC.
+	vnicAttachmentTimeout = 3 * time.Minute
+)
+
+// assignSecondaryPrivateIPs assigns the secondary private IPs of the spec to
+// the primary VNIC of the instance, once it is attached.
+func (o *OciCli) assignSecondaryPrivateIPs(ctx context.Context, instance core.Instance, spec *spec.RunnerSpec) error {
+	if len(spec.SecondaryPrivateIPs) == 0 && spec.SecondaryPrivateIPCount == 0 {
+		return nil
+	}
+	vnicID, err := o.waitForPrimaryVnic(ctx, instance)
+	if err != nil {
+		return err
+	}
+	addresses := make([]*string, 0, len(spec.SecondaryPrivateIPs)+spec.SecondaryPrivateIPCount)
+	for _, ip := range spec.SecondaryPrivateIPs {
+		addresses = append(addresses, common.String(ip))
+	}
+	for i := 0; i < spec.SecondaryPrivateIPCount; i++ {
+		// Without an address, OCI picks a free one of the subnet.
+		addresses = append(addresses, nil)
+	}
+	for _, address := range addresses {
+		_, err := o.networkClient.CreatePrivateIp(ctx, core.CreatePrivateIpRequest{
+			CreatePrivateIpDetails: core.CreatePrivateIpDetails{
+				VnicId:    &vnicID,
+				IpAddress: address,
+			},
+		})
+		if err != nil {
+			if address != nil {
+				return fmt.Errorf("error assigning secondary private IP %s: %w", *address, err)
+			}
+			return fmt.Errorf("error assigning secondary private IP: %w", err)
+		}
+	}
+	return nil
+}
+
+// waitForPrimaryVnic returns the OCID of the VNIC attached at launch to the
+// instance, waiting for the attachment to complete.
+func (o *OciCli) waitForPrimaryVnic(ctx context.Context, instance core.Instance) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, vnicAttachmentTimeout)
+	defer cancel()
+	for {
+		resp, err := o.computeClient.ListVnicAttachments(ctx, core.ListVnicAttachmentsRequest{
+			CompartmentId: instance.CompartmentId,
+			InstanceId:    instance.Id,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error listing VNIC attachments: %w", err)
+		}
+		for _, attachment := range resp.Items {
+			if attachment.LifecycleState == core.VnicAttachmentLifecycleStateAttached && attachment.VnicId != nil {
+				return *attachment.VnicId, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("timed out waiting for the primary VNIC of instance %s: %w", *instance.Id, ctx.Err())
+		case <-time.After(vnicAttachmentPollInterval):
+		}
+	}
+}
+
+// InstanceAddresses returns the private and public IP addresses of the
+// primary VNIC of the instance. Without a network client, and for terminated
+// instances, no addresses are returned.
+func (o *OciCli) InstanceAddresses(ctx context.Context, instance core.Instance) ([]params.Address, error) {
+	regional := o
+	if instance.Id != nil {
+		regional = o.forInstance(*instance.Id)
+	}
+	if regional.networkClient == nil || instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+		return nil, nil
+	}
+	vnic, err := regional.primaryVnic(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+	if vnic == nil {
+		return nil, nil
+	}
+	var addresses []params.Address
+	if vnic.PrivateIp != nil && *vnic.PrivateIp != "" {
+		addresses = append(addresses, params.Address{Address: *vnic.PrivateIp, Type: params.PrivateAddress})
+	}
+	if vnic.PublicIp != nil && *vnic.PublicIp != "" {
+		addresses = append(addresses, params.Address{Address: *vnic.PublicIp, Type: params.PublicAddress})
+	}
+	return addresses, nil
+}
+
+// primaryVnic returns the primary VNIC attached to the instance, or nil if it
+// isn't attached yet.
+func (o *OciCli) primaryVnic(ctx context.Context, instance core.Instance) (*core.Vnic, error) {
+	compartmentID := instance.CompartmentId
+	if compartmentID == nil {
+		compartmentID = &o.cfg.CompartmentId
+	}
+	resp, err := o.computeClient.ListVnicAttachments(ctx, core.ListVnicAttachmentsRequest{
+		CompartmentId: compartmentID,
+		InstanceId:    instance.Id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing VNIC attachments: %w", err)
+	}
+	for _, attachment := range resp.Items {
+		if attachment.LifecycleState != core.VnicAttachmentLifecycleStateAttached || attachment.VnicId == nil {
+			continue
+		}
+		vnic, err := o.networkClient.GetVnic(ctx, core.GetVnicRequest{VnicId: attachment.VnicId})
+		if err != nil {
+			return nil, fmt.Errorf("error getting VNIC %s: %w", *attachment.VnicId, err)
+		}
+		if vnic.IsPrimary != nil && *vnic.IsPrimary {
+			return &vnic.Vnic, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,416 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstanceSecondaryPrivateIPs(t *testing.T) {
+	interval := vnicAttachmentPollInterval
+	vnicAttachmentPollInterval = time.Millisecond
+	t.Cleanup(func() { vnicAttachmentPollInterval = interval })
+	vnicID := "ocid1.vnic.oc1.iad.aaaa"
+	tests := []struct {
+		name              string
+		ips               []string
+		count             int
+		expectedAddresses []*string
+	}{
+		{
+			name:              "explicit addresses",
+			ips:               []string{"10.0.0.10", "10.0.0.11"},
+			expectedAddresses: []*string{common.String("10.0.0.10"), common.String("10.0.0.11")},
+		},
+		{
+			name:              "picked by oci",
+			count:             2,
+			expectedAddresses: []*string{nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockNetworkClient := new(MockNetworkClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				networkClient: mockNetworkClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:      "ad",
+				CompartmentID:           "compartment",
+				SubnetID:                "subnet",
+				NsgID:                   "nsg",
+				SecondaryPrivateIPs:     tt.ips,
+				SecondaryPrivateIPCount: tt.count,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			instance := core.Instance{
+				Id:            common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				CompartmentId: common.String("compartment"),
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: instance,
+			}, nil)
+			mockNetworkClient.On("GetSubnet", ctx, mock.Anything).Return(core.GetSubnetResponse{
+				Subnet: core.Subnet{CidrBlock: common.String("10.0.0.0/24")},
+			}, nil)
+			mockNetworkClient.On("ListPrivateIps", ctx, mock.Anything).Return(core.ListPrivateIpsResponse{}, nil)
+			vnicAttachments := core.ListVnicAttachmentsRequest{
+				CompartmentId: instance.CompartmentId,
+				InstanceId:    instance.Id,
+			}
+			mockComputeClient.On("ListVnicAttachments", mock.Anything, vnicAttachments).Return(core.ListVnicAttachmentsResponse{
+				Items: []core.VnicAttachment{{LifecycleState: core.VnicAttachmentLifecycleStateAttaching}},
+			}, nil).Once()
+			mockComputeClient.On("ListVnicAttachments", mock.Anything, vnicAttachments).Return(core.ListVnicAttachmentsResponse{
+				Items: []core.VnicAttachment{{LifecycleState: core.VnicAttachmentLifecycleStateAttached, VnicId: common.String(vnicID)}},
+			}, nil)
+			mockNetworkClient.On("CreatePrivateIp", ctx, mock.Anything).Return(core.CreatePrivateIpResponse{}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+
+			var addresses []*string
+			for _, call := range mockNetworkClient.Calls {
+				if call.Method != "CreatePrivateIp" {
+					continue
+				}
+				req := call.Arguments.Get(1).(core.CreatePrivateIpRequest)
+				require.Equal(t, vnicID, *req.VnicId)
+				addresses = append(addresses, req.IpAddress)
+			}
+			require.Equal(t, tt.expectedAddresses, addresses)
+			mockComputeClient.AssertNotCalled(t, "TerminateInstance", ctx, mock.Anything)
+		})
+	}
+}
+
+func TestCheckSecondaryPrivateIPs(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		inUse     bool
+		errString string
+	}{
+		{name: "free address", ip: "10.0.0.10"},
+		{name: "outside the subnet", ip: "10.0.1.10", errString: "secondary private IP 10.0.1.10 is not in the CIDR block 10.0.0.0/24 of subnet subnet"},
+		{name: "default gateway", ip: "10.0.0.1", errString: "secondary private IP 10.0.0.1 is reserved by OCI in subnet subnet"},
+		{name: "broadcast address", ip: "10.0.0.255", errString: "secondary private IP 10.0.0.255 is reserved by OCI in subnet subnet"},
+		{name: "in use", ip: "10.0.0.10", inUse: true, errString: "secondary private IP 10.0.0.10 is already in use in subnet subnet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockNetworkClient := new(MockNetworkClient)
+			ociCli := &OciCli{
+				networkClient: mockNetworkClient,
+				cfg:           &config.Config{},
+			}
+			mockNetworkClient.On("GetSubnet", ctx, core.GetSubnetRequest{
+				SubnetId: common.String("subnet"),
+			}).Return(core.GetSubnetResponse{
+				Subnet: core.Subnet{CidrBlock: common.String("10.0.0.0/24")},
+			}, nil)
+			var privateIps []core.PrivateIp
+			if tt.inUse {
+				privateIps = []core.PrivateIp{{IpAddress: common.String(tt.ip)}}
+			}
+			mockNetworkClient.On("ListPrivateIps", ctx, core.ListPrivateIpsRequest{
+				SubnetId:  common.String("subnet"),
+				IpAddress: common.String(tt.ip),
+			}).Return(core.ListPrivateIpsResponse{Items: privateIps}, nil)
+
+			err := ociCli.checkSecondaryPrivateIPs(ctx, &spec.RunnerSpec{
+				SubnetID:            "subnet",
+				SecondaryPrivateIPs: []string{tt.ip},
+			})
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceWithoutNetworkClient(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	tests := []struct {
+		name                    string
+		nsgID                   string
+		nsgName                 string
+		secondaryPrivateIPCount int
+		errString               string
+	}{
+		{
+			name:  "subnet capacity check is skipped",
+			nsgID: "nsg",
+		},
+		{
+			name:      "network security group name can't be resolved",
+			nsgName:   "runners",
+			errString: `network security group "runners" can't be looked up without a network client`,
+		},
+		{
+			name:                    "secondary private IPs can't be assigned",
+			nsgID:                   "nsg",
+			secondaryPrivateIPCount: 1,
+			errString:               "secondary private IPs can't be assigned without a network client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg: &config.Config{
+					AvailabilityDomain:  "ad",
+					CompartmentId:       "compartment",
+					SubnetID:            "subnet",
+					CheckSubnetCapacity: true,
+				},
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:      "ad",
+				CompartmentID:           "compartment",
+				SubnetID:                "subnet",
+				NsgID:                   tt.nsgID,
+				NsgName:                 tt.nsgName,
+				SecondaryPrivateIPCount: tt.secondaryPrivateIPCount,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			mockComputeClient.AssertCalled(t, "LaunchInstance", ctx, mock.Anything)
+			require.Contains(t, logs.String(), "network client unavailable, skipping subnet capacity check")
+		})
+	}
+}
+
+func TestInstanceAddresses(t *testing.T) {
+	instance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		CompartmentId:  common.String("compartment"),
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	tests := []struct {
+		name      string
+		publicIP  *string
+		expected  []params.Address
+		errString string
+	}{
+		{
+			name:     "private and public addresses",
+			publicIP: common.String("203.0.113.10"),
+			expected: []params.Address{
+				{Address: "10.0.0.5", Type: params.PrivateAddress},
+				{Address: "203.0.113.10", Type: params.PublicAddress},
+			},
+		},
+		{
+			name: "private address only",
+			expected: []params.Address{
+				{Address: "10.0.0.5", Type: params.PrivateAddress},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(MockComputeClient)
+			mockNetworkClient := new(MockNetworkClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				networkClient: mockNetworkClient,
+				cfg:           &config.Config{CompartmentId: "compartment"},
+			}
+			mockComputeClient.On("ListVnicAttachments", ctx, core.ListVnicAttachmentsRequest{
+				CompartmentId: common.String("compartment"),
+				InstanceId:    instance.Id,
+			}).Return(core.ListVnicAttachmentsResponse{
+				Items: []core.VnicAttachment{
+					{VnicId: common.String("ocid1.vnic.oc1..detached"), LifecycleState: core.VnicAttachmentLifecycleStateDetached},
+					{VnicId: common.String("ocid1.vnic.oc1..secondary"), LifecycleState: core.VnicAttachmentLifecycleStateAttached},
+					{VnicId: common.String("ocid1.vnic.oc1..primary"), LifecycleState: core.VnicAttachmentLifecycleStateAttached},
+				},
+			}, nil)
+			mockNetworkClient.On("GetVnic", ctx, core.GetVnicRequest{VnicId: common.String("ocid1.vnic.oc1..secondary")}).Return(core.GetVnicResponse{
+				Vnic: core.Vnic{IsPrimary: common.Bool(false), PrivateIp: common.String("10.0.1.5")},
+			}, nil)
+			mockNetworkClient.On("GetVnic", ctx, core.GetVnicRequest{VnicId: common.String("ocid1.vnic.oc1..primary")}).Return(core.GetVnicResponse{
+				Vnic: core.Vnic{IsPrimary: common.Bool(true), PrivateIp: common.String("10.0.0.5"), PublicIp: tt.publicIP},
+			}, nil)
+
+			addresses, err := ociCli.InstanceAddresses(ctx, instance)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, addresses)
+		})
+	}
+}
+
+func TestInstanceAddressesWithoutNetworkClient(t *testing.T) {
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{CompartmentId: "compartment"},
+	}
+
+	addresses, err := ociCli.InstanceAddresses(context.Background(), core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	})
+	require.NoError(t, err)
+	require.Nil(t, addresses)
+	mockComputeClient.AssertNotCalled(t, "ListVnicAttachments", mock.Anything, mock.Anything)
+}
+
+func TestUniqueNsgIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		nsgIDs    []string
+		expected  []string
+		errString string
+	}{
+		{name: "none", nsgIDs: nil, expected: nil},
+		{name: "single", nsgIDs: []string{"nsg-a"}, expected: []string{"nsg-a"}},
+		{name: "empty is dropped", nsgIDs: []string{""}, expected: nil},
+		{
+			name:     "duplicates keep the first occurrence",
+			nsgIDs:   []string{"nsg-b", "nsg-a", "nsg-b", "nsg-c", "nsg-a"},
+			expected: []string{"nsg-b", "nsg-a", "nsg-c"},
+		},
+		{
+			name:     "five after dedup",
+			nsgIDs:   []string{"nsg-a", "nsg-b", "nsg-c", "nsg-d", "nsg-e", "nsg-a"},
+			expected: []string{"nsg-a", "nsg-b", "nsg-c", "nsg-d", "nsg-e"},
+		},
+		{
+			name:      "more than five",
+			nsgIDs:    []string{"nsg-a", "nsg-b", "nsg-c", "nsg-d", "nsg-e", "nsg-f"},
+			errString: "6 network security groups requested, OCI allows at most 5 per VNIC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nsgIDs, err := uniqueNsgIDs(tt.nsgIDs)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, nsgIDs)
+		})
+	}
+}
+
+func TestCreateInstanceTooManyNsgs(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg: &config.Config{
+			AvailabilityDomain: "ad",
+			CompartmentId:      "compartment",
+			SubnetID:           "subnet",
+		},
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgIDs: []string{
+			"ocid1.networksecuritygroup.oc1.iad.aaaa",
+			"ocid1.networksecuritygroup.oc1.iad.bbbb",
+			"ocid1.networksecuritygroup.oc1.iad.cccc",
+			"ocid1.networksecuritygroup.oc1.iad.dddd",
+			"ocid1.networksecuritygroup.oc1.iad.eeee",
+			"ocid1.networksecuritygroup.oc1.iad.ffff",
+		},
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+
+	require.EqualError(t, err, "6 network security groups requested, OCI allows at most 5 per VNIC")
+	mockComputeClient.AssertNotCalled(t, "LaunchInstance", mock.Anything, mock.Anything)
+}
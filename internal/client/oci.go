@@ -19,36 +19,95 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	garmErrors "github.com/cloudbase/garm-provider-common/errors"
+	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/cloudbase/garm-provider-oci/config"
 	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/cloudbase/garm-provider-oci/internal/tracing"
+	"github.com/cloudbase/garm-provider-oci/internal/util"
 	"github.com/oracle/oci-go-sdk/v49/common"
 	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/oracle/oci-go-sdk/v49/identity"
 )
 
 func NewOciCli(ctx context.Context, cfg *config.Config) (*OciCli, error) {
-	privateKey, err := cfg.GetPrivateKey()
-	if err != nil {
-		return nil, fmt.Errorf("error getting private key: %w", err)
-	}
-	confProvider := common.NewRawConfigurationProvider(
-		cfg.TenancyID,
-		cfg.UserID,
-		cfg.Region,
-		cfg.Fingerprint,
-		privateKey,
-		common.String(cfg.PrivateKeyPassword),
-	)
+	return NewOciCliWithCredentialProvider(ctx, cfg, newCredentialProvider(cfg))
+}
+
+// NewOciCliWithCredentialProvider creates the OCI clients using the
+// configuration provider returned by the given CredentialProvider.
+func NewOciCliWithCredentialProvider(ctx context.Context, cfg *config.Config, credentials CredentialProvider) (*OciCli, error) {
+	confProvider, err := credentials.ConfigurationProvider()
+	if err != nil {
+		return nil, fmt.Errorf("error getting configuration provider: %w", err)
+	}
 	computeClient, err := core.NewComputeClientWithConfigurationProvider(confProvider)
 	if err != nil {
 		return nil, fmt.Errorf("error creating compute client: %w", err)
 	}
-	return &OciCli{
-		computeClient: computeClient,
-		cfg:           cfg,
-	}, nil
+	identityClient, err := identity.NewIdentityClientWithConfigurationProvider(confProvider)
+	if err != nil {
+		return nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+	blockstorageClient, err := core.NewBlockstorageClientWithConfigurationProvider(confProvider)
+	if err != nil {
+		return nil, fmt.Errorf("error creating blockstorage client: %w", err)
+	}
+	computeClient.HTTPClient = tracing.WrapDispatcher(computeClient.HTTPClient)
+	identityClient.HTTPClient = tracing.WrapDispatcher(identityClient.HTTPClient)
+	blockstorageClient.HTTPClient = tracing.WrapDispatcher(blockstorageClient.HTTPClient)
+	// The timeout and the rate limit apply to every attempt of a retried
+	// call. The rate limit is shared by all clients, of all regions.
+	timeout := cfg.RequestTimeoutDuration()
+	limiter := newRateLimiter(cfg.RateLimit)
+	ociCli := &OciCli{
+		computeClient:      withRetries(withComputeTimeout(computeClient, timeout, limiter), cfg.RetryPolicy),
+		identityClient:     withIdentityTimeout(identityClient, timeout, limiter),
+		blockstorageClient: withBlockstorageTimeout(blockstorageClient, timeout, limiter),
+		cfg:                cfg,
+	}
+	// Instances can be launched without the network client, only the
+	// network checks and lookups that need it are skipped.
+	networkClient, err := core.NewVirtualNetworkClientWithConfigurationProvider(confProvider)
+	if err != nil {
+		slog.WarnContext(ctx, "network client unavailable, skipping network checks", "error", err)
+	} else {
+		networkClient.HTTPClient = tracing.WrapDispatcher(networkClient.HTTPClient)
+		ociCli.networkClient = withNetworkTimeout(networkClient, timeout, limiter)
+	}
+	for _, region := range cfg.AdditionalRegions {
+		regionComputeClient, err := core.NewComputeClientWithConfigurationProvider(confProvider)
+		if err != nil {
+			return nil, fmt.Errorf("error creating compute client for region %s: %w", region, err)
+		}
+		regionComputeClient.SetRegion(region)
+		regionComputeClient.HTTPClient = tracing.WrapDispatcher(regionComputeClient.HTTPClient)
+		ociCli.SetRegionComputeClient(region, withRetries(withComputeTimeout(regionComputeClient, timeout, limiter), cfg.RetryPolicy))
+		regionBlockstorageClient, err := core.NewBlockstorageClientWithConfigurationProvider(confProvider)
+		if err != nil {
+			return nil, fmt.Errorf("error creating blockstorage client for region %s: %w", region, err)
+		}
+		regionBlockstorageClient.SetRegion(region)
+		regionBlockstorageClient.HTTPClient = tracing.WrapDispatcher(regionBlockstorageClient.HTTPClient)
+		ociCli.SetRegionBlockstorageClient(region, withBlockstorageTimeout(regionBlockstorageClient, timeout, limiter))
+		regionNetworkClient, err := core.NewVirtualNetworkClientWithConfigurationProvider(confProvider)
+		if err != nil {
+			slog.WarnContext(ctx, "network client unavailable, skipping network lookups", "region", region, "error", err)
+			continue
+		}
+		regionNetworkClient.SetRegion(region)
+		regionNetworkClient.HTTPClient = tracing.WrapDispatcher(regionNetworkClient.HTTPClient)
+		ociCli.SetRegionNetworkClient(region, withNetworkTimeout(regionNetworkClient, timeout, limiter))
+	}
+	return ociCli, nil
 }
 
 type ClientInterface interface {
@@ -57,11 +116,63 @@ type ClientInterface interface {
 	TerminateInstance(ctx context.Context, request core.TerminateInstanceRequest) (core.TerminateInstanceResponse, error)
 	ListInstances(ctx context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error)
 	InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error)
+	GetImage(ctx context.Context, request core.GetImageRequest) (core.GetImageResponse, error)
+	ListShapes(ctx context.Context, request core.ListShapesRequest) (core.ListShapesResponse, error)
+	ListBootVolumeAttachments(ctx context.Context, request core.ListBootVolumeAttachmentsRequest) (core.ListBootVolumeAttachmentsResponse, error)
+	UpdateInstance(ctx context.Context, request core.UpdateInstanceRequest) (core.UpdateInstanceResponse, error)
+	ListComputeCapacityReservations(ctx context.Context, request core.ListComputeCapacityReservationsRequest) (core.ListComputeCapacityReservationsResponse, error)
+	ListVnicAttachments(ctx context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error)
+	ListImages(ctx context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error)
+	AttachVolume(ctx context.Context, request core.AttachVolumeRequest) (core.AttachVolumeResponse, error)
+	ListVolumeAttachments(ctx context.Context, request core.ListVolumeAttachmentsRequest) (core.ListVolumeAttachmentsResponse, error)
+	GetVolumeAttachment(ctx context.Context, request core.GetVolumeAttachmentRequest) (core.GetVolumeAttachmentResponse, error)
+	DetachVolume(ctx context.Context, request core.DetachVolumeRequest) (core.DetachVolumeResponse, error)
+}
+
+type IdentityClientInterface interface {
+	AssembleEffectiveTagSet(ctx context.Context, request identity.AssembleEffectiveTagSetRequest) (identity.AssembleEffectiveTagSetResponse, error)
+	GetTagNamespace(ctx context.Context, request identity.GetTagNamespaceRequest) (identity.GetTagNamespaceResponse, error)
+	ListAvailabilityDomains(ctx context.Context, request identity.ListAvailabilityDomainsRequest) (identity.ListAvailabilityDomainsResponse, error)
+}
+
+type NetworkClientInterface interface {
+	GetSubnet(ctx context.Context, request core.GetSubnetRequest) (core.GetSubnetResponse, error)
+	ListNetworkSecurityGroups(ctx context.Context, request core.ListNetworkSecurityGroupsRequest) (core.ListNetworkSecurityGroupsResponse, error)
+	ListPrivateIps(ctx context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error)
+	CreatePrivateIp(ctx context.Context, request core.CreatePrivateIpRequest) (core.CreatePrivateIpResponse, error)
+	GetVnic(ctx context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error)
+}
+
+type BlockstorageClientInterface interface {
+	GetBootVolume(ctx context.Context, request core.GetBootVolumeRequest) (core.GetBootVolumeResponse, error)
+	ListBootVolumes(ctx context.Context, request core.ListBootVolumesRequest) (core.ListBootVolumesResponse, error)
+	UpdateBootVolume(ctx context.Context, request core.UpdateBootVolumeRequest) (core.UpdateBootVolumeResponse, error)
+	CreateVolume(ctx context.Context, request core.CreateVolumeRequest) (core.CreateVolumeResponse, error)
+	GetVolume(ctx context.Context, request core.GetVolumeRequest) (core.GetVolumeResponse, error)
+	DeleteVolume(ctx context.Context, request core.DeleteVolumeRequest) (core.DeleteVolumeResponse, error)
+	ListVolumes(ctx context.Context, request core.ListVolumesRequest) (core.ListVolumesResponse, error)
 }
 
 type OciCli struct {
-	cfg           *config.Config
-	computeClient ClientInterface
+	cfg                *config.Config
+	controllerID       string
+	computeClient      ClientInterface
+	identityClient     IdentityClientInterface
+	networkClient      NetworkClientInterface
+	blockstorageClient BlockstorageClientInterface
+	// regionClients are the clients of the additional regions instances
+	// are listed in, and managed with once listed.
+	regionClients []regionClient
+
+	imageCache map[string]core.Image
+	imageMux   sync.Mutex
+
+	shapeCache     map[string]core.Shape
+	shapeFetchedAt time.Time
+	shapeMux       sync.Mutex
+
+	// now returns the current time. It can be overridden in tests.
+	now func() time.Time
 }
 
 func (o *OciCli) Config() *config.Config {
@@ -76,11 +187,119 @@ func (o *OciCli) SetConfig(cfg *config.Config) {
 	o.cfg = cfg
 }
 
+func (o *OciCli) SetControllerID(controllerID string) {
+	o.controllerID = controllerID
+}
+
 func (o *OciCli) SetComputeClient(computeClient ClientInterface) {
 	o.computeClient = computeClient
 }
 
+func (o *OciCli) SetIdentityClient(identityClient IdentityClientInterface) {
+	o.identityClient = identityClient
+}
+
+func (o *OciCli) SetNetworkClient(networkClient NetworkClientInterface) {
+	o.networkClient = networkClient
+}
+
+func (o *OciCli) SetBlockstorageClient(blockstorageClient BlockstorageClientInterface) {
+	o.blockstorageClient = blockstorageClient
+}
+
 func (o *OciCli) CreateInstance(ctx context.Context, spec *spec.RunnerSpec) (core.Instance, error) {
+	ctx, span := tracing.Start(ctx, "CreateInstance", tracing.InstanceNameKey.String(spec.BootstrapParams.Name))
+	instance, err := o.createInstance(ctx, spec)
+	tracing.End(span, err)
+	return instance, err
+}
+
+func (o *OciCli) createInstance(ctx context.Context, spec *spec.RunnerSpec) (core.Instance, error) {
+	if o.cfg.IdempotentCreate {
+		existing, err := o.findLaunchedInstance(ctx, spec)
+		if err != nil {
+			return core.Instance{}, err
+		}
+		if existing != nil {
+			slog.InfoContext(ctx, "instance already launched, not launching it again",
+				"instance_name", spec.BootstrapParams.Name,
+				"instance_id", *existing.Id)
+			return *existing, nil
+		}
+	}
+	if err := o.checkCompartmentQuota(ctx); err != nil {
+		return core.Instance{}, err
+	}
+	shape, err := o.GetShape(ctx, spec.BootstrapParams.Flavor)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	ocpus, memoryInGBs, err := fitShapeConfig(shape, spec.Ocpus, spec.MemoryInGBs, spec.RoundToValid)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	if ocpus != spec.Ocpus || memoryInGBs != spec.MemoryInGBs {
+		slog.InfoContext(ctx, "adjusted shape config to the nearest valid values",
+			"shape", spec.BootstrapParams.Flavor,
+			"requested_ocpus", spec.Ocpus,
+			"ocpus", ocpus,
+			"requested_memory_in_gbs", spec.MemoryInGBs,
+			"memory_in_gbs", memoryInGBs)
+	}
+	platformConfig, err := launchPlatformConfig(shape, spec.PlatformConfig)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	imageID, err := o.resolveImageID(ctx, spec)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	image, err := o.getImage(ctx, imageID)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	if err := checkImageOSType(imageID, image, spec.BootstrapParams.OSType); err != nil {
+		return core.Instance{}, err
+	}
+	var nsgIDs []string
+	switch {
+	case !spec.AttachesNsg():
+	case len(spec.NsgIDs) > 0:
+		nsgIDs = spec.NsgIDs
+	default:
+		nsgID, err := o.resolveNsgID(ctx, spec)
+		if err != nil {
+			return core.Instance{}, err
+		}
+		nsgIDs = []string{nsgID}
+	}
+	nsgIDs, err = uniqueNsgIDs(nsgIDs)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	if err := o.checkSubnetCapacity(ctx, spec.SubnetID); err != nil {
+		return core.Instance{}, err
+	}
+	if err := o.checkSecondaryPrivateIPs(ctx, spec); err != nil {
+		return core.Instance{}, err
+	}
+	bootVolumeID, err := o.resolveBootVolumeID(ctx, spec, imageID)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	capacityReservationID, err := o.resolveCapacityReservationID(ctx, spec)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	metadata, resolvedMetadataKeys, err := o.instanceMetadata(spec)
+	if err != nil {
+		return core.Instance{}, err
+	}
+	specHash, err := spec.Hash()
+	if err != nil {
+		return core.Instance{}, fmt.Errorf("error hashing spec: %w", err)
+	}
+
 	req := core.LaunchInstanceRequest{
 		LaunchInstanceDetails: core.LaunchInstanceDetails{
 			CompartmentId:      &spec.CompartmentID,
@@ -89,11 +308,11 @@ func (o *OciCli) CreateInstance(ctx context.Context, spec *spec.RunnerSpec) (cor
 			Shape:              &spec.BootstrapParams.Flavor,
 			CreateVnicDetails: &core.CreateVnicDetails{
 				SubnetId: &spec.SubnetID,
-				NsgIds:   []string{spec.NsgID},
+				NsgIds:   nsgIDs,
 			},
 			ShapeConfig: &core.LaunchInstanceShapeConfigDetails{
-				Ocpus:       common.Float32(spec.Ocpus),
-				MemoryInGBs: common.Float32(spec.MemoryInGBs),
+				Ocpus:       common.Float32(ocpus),
+				MemoryInGBs: common.Float32(memoryInGBs),
 			},
 			FreeformTags: map[string]string{
 				"Name":               spec.BootstrapParams.Name,
@@ -101,24 +320,393 @@ func (o *OciCli) CreateInstance(ctx context.Context, spec *spec.RunnerSpec) (cor
 				"OSType":             string(spec.BootstrapParams.OSType),
 				"OSArch":             string(spec.BootstrapParams.OSArch),
 				"GARM_CONTROLLER_ID": spec.ControllerID,
+				specHashTag:          specHash,
+				imageIDTag:           imageID,
 			},
-			Metadata: map[string]string{
-				"user_data":           spec.UserData,
-				"ssh_authorized_keys": strings.Join(spec.SSHPublicKeys, "\n"),
-			},
+			Metadata: metadata,
 			SourceDetails: core.InstanceSourceViaImageDetails{
-				ImageId:             &spec.BootstrapParams.Image,
+				ImageId:             &imageID,
 				BootVolumeSizeInGBs: &spec.BootVolumeSize,
 			},
 		},
 	}
+	if bootVolumeID != "" {
+		req.LaunchInstanceDetails.SourceDetails = core.InstanceSourceViaBootVolumeDetails{
+			BootVolumeId: &bootVolumeID,
+		}
+		req.LaunchInstanceDetails.FreeformTags[bootVolumeIDTag] = bootVolumeID
+		// Reused boot volumes were created from the image, a boot volume set
+		// by boot_volume_id could have been created from any image.
+		if spec.BootVolumeID != "" {
+			delete(req.LaunchInstanceDetails.FreeformTags, imageIDTag)
+		}
+	}
+	if capacityReservationID != "" {
+		req.LaunchInstanceDetails.CapacityReservationId = &capacityReservationID
+	}
+	if spec.DedicatedVMHostID != "" {
+		req.LaunchInstanceDetails.DedicatedVmHostId = &spec.DedicatedVMHostID
+	}
+	if platformConfig != nil {
+		req.LaunchInstanceDetails.PlatformConfig = platformConfig
+	}
+	faultDomain := spec.FaultDomain
+	if spec.FaultDomainSpread {
+		faultDomain, err = o.spreadFaultDomain(ctx, spec)
+		if err != nil {
+			return core.Instance{}, err
+		}
+	}
+	if faultDomain != "" {
+		req.LaunchInstanceDetails.FaultDomain = &faultDomain
+	}
+	if spec.Preemptible {
+		req.LaunchInstanceDetails.PreemptibleInstanceConfig = &core.PreemptibleInstanceConfigDetails{
+			PreemptionAction: core.TerminatePreemptionAction{
+				PreserveBootVolume: common.Bool(spec.PreserveBootVolumeOnPreemption),
+			},
+		}
+	}
+	if spec.IsPvEncryptionInTransitEnabled {
+		req.LaunchInstanceDetails.IsPvEncryptionInTransitEnabled = &spec.IsPvEncryptionInTransitEnabled
+	}
+	if spec.AreLegacyImdsEndpointsDisabled {
+		req.LaunchInstanceDetails.InstanceOptions = &core.InstanceOptions{
+			AreLegacyImdsEndpointsDisabled: common.Bool(true),
+		}
+	}
+	if spec.HostnameLabel != "" {
+		req.LaunchInstanceDetails.CreateVnicDetails.HostnameLabel = &spec.HostnameLabel
+	}
+	// Without an explicit choice, the subnet decides whether the VNIC gets a
+	// public IP.
+	if spec.AssignPublicIP != nil {
+		req.LaunchInstanceDetails.CreateVnicDetails.AssignPublicIp = spec.AssignPublicIP
+	}
+	if spec.IsMultipath || spec.NetworkPerformance != "" {
+		req.LaunchInstanceDetails.LaunchOptions = &core.LaunchOptions{}
+	}
+	if spec.IsMultipath {
+		req.LaunchInstanceDetails.LaunchOptions.BootVolumeType = core.LaunchOptionsBootVolumeTypeIscsi
+		req.LaunchInstanceDetails.LaunchOptions.RemoteDataVolumeType = core.LaunchOptionsRemoteDataVolumeTypeIscsi
+	}
+	if spec.NetworkPerformance != "" {
+		req.LaunchInstanceDetails.LaunchOptions.NetworkType = spec.NetworkType()
+	}
+	if labels := util.LabelsToTagValue(spec.BootstrapParams.Labels); labels != "" {
+		req.LaunchInstanceDetails.FreeformTags["GARM_LABELS"] = labels
+	}
+	for key, value := range spec.ExtraTags {
+		req.LaunchInstanceDetails.FreeformTags[key] = value
+	}
+	copyImageTags(req.LaunchInstanceDetails.FreeformTags, image.FreeformTags, spec.CopyImageTags)
+	if len(spec.BlockVolumes) > 0 {
+		req.LaunchInstanceDetails.FreeformTags[blockVolumesTag] = blockVolumesTagValue(spec)
+	}
+	if len(spec.DefinedTags) > 0 {
+		req.LaunchInstanceDetails.DefinedTags = definedTags(spec.DefinedTags)
+	}
+	if err := o.checkTagDefaults(ctx, req.LaunchInstanceDetails.DefinedTags); err != nil {
+		return core.Instance{}, err
+	}
+	slog.DebugContext(ctx, "launching instance",
+		"name", spec.BootstrapParams.Name,
+		"shape", spec.BootstrapParams.Flavor,
+		"image", imageID,
+		"metadata", util.RedactMetadata(req.LaunchInstanceDetails.Metadata, append(resolvedMetadataKeys, o.cfg.UserDataKey())...))
 	response, err := o.computeClient.LaunchInstance(ctx, req)
 	if err != nil {
-		return core.Instance{}, fmt.Errorf("error creating instance: %w", err)
+		return core.Instance{}, fmt.Errorf("error creating instance: %w", asQuotaError(response.RawResponse, err, o.currentTime()))
+	}
+	if err := o.tuneBootVolume(ctx, response.Instance, spec); err != nil {
+		// The launch details can't set the boot volume performance, don't
+		// leave a runner behind without the performance it was asked for.
+		if _, terminateErr := o.computeClient.TerminateInstance(ctx, core.TerminateInstanceRequest{InstanceId: response.Instance.Id}); terminateErr != nil {
+			slog.WarnContext(ctx, "failed to terminate instance", "instance_id", *response.Instance.Id, "error", terminateErr)
+		}
+		return core.Instance{}, fmt.Errorf("error tuning the boot volume of instance %s: %w", *response.Instance.Id, err)
+	}
+	if err := o.assignSecondaryPrivateIPs(ctx, response.Instance, spec); err != nil {
+		// Workloads rely on the secondary IPs, don't leave a runner without
+		// them behind.
+		if _, terminateErr := o.computeClient.TerminateInstance(ctx, core.TerminateInstanceRequest{InstanceId: response.Instance.Id}); terminateErr != nil {
+			slog.WarnContext(ctx, "failed to terminate instance", "instance_id", *response.Instance.Id, "error", terminateErr)
+		}
+		return core.Instance{}, fmt.Errorf("error assigning secondary private IPs to instance %s: %w", *response.Instance.Id, err)
+	}
+	if err := o.attachBlockVolumes(ctx, response.Instance, spec); err != nil {
+		if deleteErr := o.deleteBlockVolumes(ctx, *response.Instance.Id); deleteErr != nil {
+			slog.WarnContext(ctx, "failed to delete block volumes", "instance_id", *response.Instance.Id, "error", deleteErr)
+		}
+		if _, terminateErr := o.computeClient.TerminateInstance(ctx, core.TerminateInstanceRequest{InstanceId: response.Instance.Id}); terminateErr != nil {
+			slog.WarnContext(ctx, "failed to terminate instance", "instance_id", *response.Instance.Id, "error", terminateErr)
+		}
+		return core.Instance{}, fmt.Errorf("error attaching block volumes to instance %s: %w", *response.Instance.Id, err)
 	}
 	return response.Instance, nil
 }
 
+// checkCompartmentQuota verifies that launching one more instance does not
+// exceed the compartment wide cap on GARM instances, if one is configured.
+func (o *OciCli) checkCompartmentQuota(ctx context.Context) error {
+	if o.cfg.CompartmentInstanceQuota == 0 {
+		return nil
+	}
+	computeInstances, err := o.listCompartmentInstances(ctx, o.computeClient)
+	if err != nil {
+		return fmt.Errorf("error listing instances: %w", err)
+	}
+	count := 0
+	for _, instance := range computeInstances {
+		if _, ok := instance.FreeformTags["GARM_POOL_ID"]; ok && instance.LifecycleState != core.InstanceLifecycleStateTerminated {
+			count++
+		}
+	}
+	if count >= o.cfg.CompartmentInstanceQuota {
+		return fmt.Errorf("compartment %s has %d GARM instances, launching another would exceed the quota of %d", o.cfg.CompartmentId, count, o.cfg.CompartmentInstanceQuota)
+	}
+	return nil
+}
+
+// checkTagDefaults verifies that the defined tags of the launch contain a value
+// for every tag default marked as required that applies to the compartment,
+// including the ones it inherits from its parent compartments. It is a no-op
+// unless enabled in the config.
+func (o *OciCli) checkTagDefaults(ctx context.Context, definedTags map[string]map[string]interface{}) error {
+	if !o.cfg.CheckTagDefaults {
+		return nil
+	}
+	resp, err := o.identityClient.AssembleEffectiveTagSet(ctx, identity.AssembleEffectiveTagSetRequest{
+		CompartmentId:  &o.cfg.CompartmentId,
+		LifecycleState: identity.TagDefaultSummaryLifecycleStateActive,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing tag defaults: %w", err)
+	}
+
+	namespaces := map[string]string{}
+	var missing []string
+	for _, tagDefault := range resp.Items {
+		if tagDefault.IsRequired == nil || !*tagDefault.IsRequired {
+			continue
+		}
+		namespaceID := *tagDefault.TagNamespaceId
+		namespace, ok := namespaces[namespaceID]
+		if !ok {
+			nsResp, err := o.identityClient.GetTagNamespace(ctx, identity.GetTagNamespaceRequest{
+				TagNamespaceId: &namespaceID,
+			})
+			if err != nil {
+				return fmt.Errorf("error getting tag namespace %s: %w", namespaceID, err)
+			}
+			namespace = *nsResp.Name
+			namespaces[namespaceID] = namespace
+		}
+		if _, ok := definedTags[namespace][*tagDefault.TagDefinitionName]; !ok {
+			missing = append(missing, fmt.Sprintf("%s.%s", namespace, *tagDefault.TagDefinitionName))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing defined tags required by the tag defaults of compartment %s: %s", o.cfg.CompartmentId, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// GetShape returns the shape with the given name, as available in the
+// configured availability domain. The list of shapes is fetched lazily and
+// cached until the configured TTL expires.
+func (o *OciCli) GetShape(ctx context.Context, name string) (core.Shape, error) {
+	o.shapeMux.Lock()
+	defer o.shapeMux.Unlock()
+
+	if o.shapeCache == nil || o.currentTime().Sub(o.shapeFetchedAt) >= o.cfg.ShapeCacheTTLDuration() {
+		shapes, err := o.listShapes(ctx)
+		if err != nil {
+			return core.Shape{}, err
+		}
+		o.shapeCache = shapes
+		o.shapeFetchedAt = o.currentTime()
+	}
+
+	shape, ok := o.shapeCache[name]
+	if !ok {
+		return core.Shape{}, fmt.Errorf("shape %s is not available in availability domain %s", name, o.cfg.AvailabilityDomain)
+	}
+	return shape, nil
+}
+
+func (o *OciCli) listShapes(ctx context.Context) (map[string]core.Shape, error) {
+	shapes := map[string]core.Shape{}
+	request := core.ListShapesRequest{
+		CompartmentId:      &o.cfg.CompartmentId,
+		AvailabilityDomain: &o.cfg.AvailabilityDomain,
+	}
+	for {
+		resp, err := o.computeClient.ListShapes(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("error listing shapes: %w", err)
+		}
+		for _, shape := range resp.Items {
+			shapes[*shape.Shape] = shape
+		}
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			break
+		}
+		request.Page = resp.OpcNextPage
+	}
+	return shapes, nil
+}
+
+func (o *OciCli) currentTime() time.Time {
+	if o.now != nil {
+		return o.now()
+	}
+	return time.Now()
+}
+
+// imageIDTag holds the OCID of the image the instance was launched from, also
+// when the pool names the image by display name.
+const imageIDTag = "GARM_IMAGE_ID"
+
+// bootVolumeIDTag holds the OCID of the boot volume the instance was
+// launched from, if it was not launched from the image.
+const bootVolumeIDTag = "GARM_BOOT_VOLUME_ID"
+
+// resolveImageID returns the OCID of the image of the pool. Images not given
+// by OCID are looked up by display name in the compartment, and the most
+// recent available image with the OS type of the pool is used.
+func (o *OciCli) resolveImageID(ctx context.Context, spec *spec.RunnerSpec) (string, error) {
+	name := spec.BootstrapParams.Image
+	if strings.HasPrefix(name, "ocid1.image") {
+		return name, nil
+	}
+	request := core.ListImagesRequest{
+		CompartmentId:  &spec.CompartmentID,
+		DisplayName:    &name,
+		LifecycleState: core.ImageLifecycleStateAvailable,
+		SortBy:         core.ListImagesSortByTimecreated,
+		SortOrder:      core.ListImagesSortOrderDesc,
+	}
+	var newest *core.Image
+	for {
+		resp, err := o.computeClient.ListImages(ctx, request)
+		if err != nil {
+			return "", fmt.Errorf("error listing images named %s: %w", name, err)
+		}
+		for _, image := range resp.Items {
+			if image.Id == nil || checkImageOSType(*image.Id, image, spec.BootstrapParams.OSType) != nil {
+				continue
+			}
+			if newest == nil || (image.TimeCreated != nil && (newest.TimeCreated == nil || image.TimeCreated.After(newest.TimeCreated.Time))) {
+				newest = &image
+			}
+		}
+		if resp.OpcNextPage == nil || *resp.OpcNextPage == "" {
+			break
+		}
+		request.Page = resp.OpcNextPage
+	}
+	if newest == nil {
+		return "", fmt.Errorf("no available %s image named %s in compartment %s", spec.BootstrapParams.OSType, name, spec.CompartmentID)
+	}
+	slog.DebugContext(ctx, "resolved image by name", "name", name, "image", *newest.Id)
+	return *newest.Id, nil
+}
+
+// getImage fetches the image with the given OCID. Successful lookups are
+// cached for the lifetime of the client.
+func (o *OciCli) getImage(ctx context.Context, imageID string) (core.Image, error) {
+	o.imageMux.Lock()
+	defer o.imageMux.Unlock()
+
+	if image, ok := o.imageCache[imageID]; ok {
+		return image, nil
+	}
+
+	resp, err := o.computeClient.GetImage(ctx, core.GetImageRequest{
+		ImageId: &imageID,
+	})
+	if err != nil {
+		if isNotAuthorized(err) {
+			// OCI doesn't tell a missing image from one the caller may not
+			// read, which is what a missing cross-tenancy policy looks like.
+			return core.Image{}, fmt.Errorf("image %s not found or not accessible in compartment %s. Images shared from another tenancy need an Endorse policy in this tenancy and an Admit policy in the tenancy of the image that allow reading instance-images: %w", imageID, o.cfg.CompartmentId, err)
+		}
+		return core.Image{}, fmt.Errorf("error getting image %s: %w", imageID, err)
+	}
+
+	if o.imageCache == nil {
+		o.imageCache = map[string]core.Image{}
+	}
+	o.imageCache[imageID] = resp.Image
+	return resp.Image, nil
+}
+
+// checkImageOSType verifies the operating system family of the image matches
+// the OS type of the pool. Images that don't report an operating system are
+// not checked.
+func checkImageOSType(imageID string, image core.Image, osType params.OSType) error {
+	if image.OperatingSystem == nil || *image.OperatingSystem == "" {
+		return nil
+	}
+	imageOSType := params.Linux
+	if strings.Contains(strings.ToLower(*image.OperatingSystem), "windows") {
+		imageOSType = params.Windows
+	}
+	if imageOSType != osType {
+		return fmt.Errorf("image %s runs %s, which is not a %s operating system", imageID, *image.OperatingSystem, osType)
+	}
+	return nil
+}
+
+// copyImageTags copies the selected freeform tags of the image onto the
+// instance tags. A "*" selects all of them. Tags already set on the instance
+// and tags reserved by GARM are left untouched.
+func copyImageTags(instanceTags, imageTags map[string]string, selected []string) {
+	if len(selected) == 0 {
+		return
+	}
+	copyAll := slices.Contains(selected, "*")
+	for key, value := range imageTags {
+		if !copyAll && !slices.Contains(selected, key) {
+			continue
+		}
+		if strings.HasPrefix(key, "GARM_") {
+			continue
+		}
+		if _, ok := instanceTags[key]; ok {
+			continue
+		}
+		instanceTags[key] = value
+	}
+}
+
+// definedTags converts the defined tags of the spec to the type the SDK
+// expects.
+func definedTags(tags map[string]map[string]string) map[string]map[string]interface{} {
+	converted := make(map[string]map[string]interface{}, len(tags))
+	for namespace, keys := range tags {
+		converted[namespace] = make(map[string]interface{}, len(keys))
+		for key, value := range keys {
+			converted[namespace][key] = value
+		}
+	}
+	return converted
+}
+
+// isNotFound reports whether err is an OCI service error with a 404 status.
+func isNotFound(err error) bool {
+	var svcErr common.ServiceError
+	return errors.As(err, &svcErr) && svcErr.GetHTTPStatusCode() == http.StatusNotFound
+}
+
+// isNotAuthorized reports whether err is an OCI service error for a resource
+// that doesn't exist or that the caller isn't authorized to access.
+func isNotAuthorized(err error) bool {
+	var svcErr common.ServiceError
+	return errors.As(err, &svcErr) && (svcErr.GetHTTPStatusCode() == http.StatusNotFound || svcErr.GetHTTPStatusCode() == http.StatusForbidden)
+}
+
 func (o *OciCli) GetInstance(ctx context.Context, instanceID string) (core.Instance, error) {
 	var inst string
 	if strings.HasPrefix(instanceID, "ocid1.instance") {
@@ -140,7 +728,7 @@ func (o *OciCli) GetInstance(ctx context.Context, instanceID string) (core.Insta
 	req := core.GetInstanceRequest{
 		InstanceId: &inst,
 	}
-	resp, err := o.computeClient.GetInstance(ctx, req)
+	resp, err := o.forInstance(inst).computeClient.GetInstance(ctx, req)
 	if err != nil {
 		return core.Instance{}, fmt.Errorf("error getting instance: %w", err)
 	}
@@ -149,9 +737,22 @@ func (o *OciCli) GetInstance(ctx context.Context, instanceID string) (core.Insta
 }
 
 func (o *OciCli) DeleteInstance(ctx context.Context, instanceID string) error {
+	ctx, span := tracing.Start(ctx, "DeleteInstance", tracing.InstanceNameKey.String(instanceID))
+	err := o.deleteInstance(ctx, instanceID)
+	tracing.End(span, err)
+	return err
+}
+
+func (o *OciCli) deleteInstance(ctx context.Context, instanceID string) error {
 	var inst string
+	var instance *core.Instance
 	if strings.HasPrefix(instanceID, "ocid1.instance") {
 		inst = instanceID
+		var err error
+		instance, err = o.forInstance(inst).checkTerminationProtection(ctx, inst)
+		if err != nil {
+			return err
+		}
 	} else {
 		tags := map[string]string{
 			"Name": instanceID,
@@ -165,42 +766,180 @@ func (o *OciCli) DeleteInstance(ctx context.Context, instanceID string) error {
 			return fmt.Errorf("failed to determine instance: %w", err)
 		}
 		inst = *tmp.Id
+		if isTerminationProtected(*tmp) {
+			return fmt.Errorf("%w: %s", ErrTerminationProtected, inst)
+		}
+		instance = tmp
+	}
+	return o.forInstance(inst).terminateInstance(ctx, inst, instance)
+}
+
+// terminateInstance terminates the instance, after deleting its block
+// volumes. The instance is nil if it could not be found.
+func (o *OciCli) terminateInstance(ctx context.Context, inst string, instance *core.Instance) error {
+	// Block volumes are deleted before the instance, a failure leaves the
+	// instance around so the delete is retried instead of leaking them.
+	if instance != nil && hasBlockVolumes(*instance) {
+		if err := o.deleteBlockVolumes(ctx, inst); err != nil {
+			return fmt.Errorf("error deleting block volumes of instance %s: %w", inst, err)
+		}
 	}
 
+	// The boot volume is deleted unless explicitly preserved, it would
+	// otherwise be left behind and keep being billed.
+	preserve := o.preserveBootVolume(ctx, inst) || o.cfg.PreserveBootVolume
 	request := core.TerminateInstanceRequest{
-		InstanceId: &inst,
+		InstanceId:         &inst,
+		PreserveBootVolume: common.Bool(preserve),
+	}
+	if o.cfg.TagOnTerminate {
+		if err := o.tagTerminated(ctx, inst); err != nil {
+			slog.WarnContext(ctx, "failed to tag instance before termination", "instance_id", inst, "error", err)
+		}
 	}
 
 	_, err := o.computeClient.TerminateInstance(ctx, request)
+	if err != nil && o.cfg.StoppingOnDelete != "" && isIncorrectState(err) {
+		if stopErr := o.waitUntilStopped(ctx, inst); stopErr != nil {
+			return fmt.Errorf("error terminating instance: %w, and waiting for it to stop: %w", err, stopErr)
+		}
+		_, err = o.computeClient.TerminateInstance(ctx, request)
+	}
 	if err != nil {
 		return fmt.Errorf("error terminating instance: %w", err)
 	}
 	return nil
 }
 
+// tagTerminated records when and by which controller the instance was
+// terminated, for audit tooling that keeps terminated instance records.
+func (o *OciCli) tagTerminated(ctx context.Context, instanceID string) error {
+	resp, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+		InstanceId: &instanceID,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting instance: %w", err)
+	}
+	tags := make(map[string]string, len(resp.FreeformTags)+2)
+	for key, value := range resp.FreeformTags {
+		tags[key] = value
+	}
+	tags["GARM_TERMINATED_AT"] = o.currentTime().UTC().Format(time.RFC3339)
+	tags["GARM_TERMINATED_BY"] = o.controllerID
+	_, err = o.computeClient.UpdateInstance(ctx, core.UpdateInstanceRequest{
+		InstanceId: &instanceID,
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			FreeformTags: tags,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating instance tags: %w", err)
+	}
+	return nil
+}
+
 func (o *OciCli) ListInstances(ctx context.Context, poolID string) ([]core.Instance, error) {
+	if len(o.regionClients) > 0 {
+		return o.listInstancesInRegions(ctx, poolID)
+	}
+	return o.listPoolInstances(ctx, o.computeClient, poolID)
+}
+
+func (o *OciCli) listPoolInstances(ctx context.Context, computeClient ClientInterface, poolID string) ([]core.Instance, error) {
+	computeInstances, err := o.listCompartmentInstances(ctx, computeClient)
+	if err != nil {
+		return nil, fmt.Errorf("error listing instances: %w", err)
+	}
+	instances := []core.Instance{}
+	for _, instance := range computeInstances {
+		if instance.FreeformTags["GARM_POOL_ID"] == poolID && instance.LifecycleState != core.InstanceLifecycleStateTerminated {
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// listCompartmentInstances returns all instances in the compartment,
+// following the pages of the listing.
+func (o *OciCli) listCompartmentInstances(ctx context.Context, computeClient ClientInterface) ([]core.Instance, error) {
 	request := core.ListInstancesRequest{
 		CompartmentId: &o.cfg.CompartmentId,
 	}
-	computeInstances, err := o.computeClient.ListInstances(ctx, request)
+	instances := []core.Instance{}
+	for {
+		response, err := computeClient.ListInstances(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, response.Items...)
+		if response.OpcNextPage == nil || *response.OpcNextPage == "" {
+			return instances, nil
+		}
+		request.Page = response.OpcNextPage
+	}
+}
+
+// ListControllerInstances returns the non-terminated GARM instances in the
+// compartment that were created by the controller, in all regions. The
+// controller ID must be set, or instances GARM never created would match.
+func (o *OciCli) ListControllerInstances(ctx context.Context) ([]core.Instance, error) {
+	if o.controllerID == "" {
+		return nil, fmt.Errorf("controller ID is not set")
+	}
+	computeInstances, err := o.listAllInstances(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error listing instances: %w", err)
 	}
 	instances := []core.Instance{}
-	for _, instance := range computeInstances.Items {
-		if instance.FreeformTags["GARM_POOL_ID"] == poolID && instance.LifecycleState != core.InstanceLifecycleStateTerminated {
+	for _, instance := range computeInstances {
+		if instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+			continue
+		}
+		if _, ok := instance.FreeformTags["GARM_POOL_ID"]; !ok {
+			continue
+		}
+		if instance.FreeformTags["GARM_CONTROLLER_ID"] == o.controllerID {
 			instances = append(instances, instance)
 		}
 	}
 	return instances, nil
 }
 
-func (o *OciCli) StopInstance(ctx context.Context, instanceID string) error {
+// ListInstancesWithPendingMaintenance returns the GARM instances of the
+// controller that OCI scheduled for a maintenance reboot.
+func (o *OciCli) ListInstancesWithPendingMaintenance(ctx context.Context) ([]core.Instance, error) {
+	computeInstances, err := o.listAllInstances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing instances: %w", err)
+	}
+	instances := []core.Instance{}
+	for _, instance := range computeInstances {
+		if instance.TimeMaintenanceRebootDue == nil || instance.LifecycleState == core.InstanceLifecycleStateTerminated {
+			continue
+		}
+		if _, ok := instance.FreeformTags["GARM_POOL_ID"]; !ok {
+			continue
+		}
+		if o.controllerID != "" && instance.FreeformTags["GARM_CONTROLLER_ID"] != o.controllerID {
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// StopInstance gracefully shuts the instance down, or with force powers it
+// off right away, for hung runners that don't shut down.
+func (o *OciCli) StopInstance(ctx context.Context, instanceID string, force bool) error {
+	action := core.InstanceActionActionSoftstop
+	if force {
+		action = core.InstanceActionActionStop
+	}
 	req := core.InstanceActionRequest{
-		Action:     core.InstanceActionActionStop,
+		Action:     action,
 		InstanceId: &instanceID,
 	}
-	_, err := o.computeClient.InstanceAction(ctx, req)
+	_, err := o.forInstance(instanceID).computeClient.InstanceAction(ctx, req)
 	if err != nil {
 		return fmt.Errorf("error stopping instance: %w", err)
 	}
@@ -212,30 +951,78 @@ func (o *OciCli) StartInstance(ctx context.Context, instanceID string) error {
 		Action:     core.InstanceActionActionStart,
 		InstanceId: &instanceID,
 	}
-	_, err := o.computeClient.InstanceAction(ctx, req)
+	computeClient := o.forInstance(instanceID).computeClient
+	_, err := computeClient.InstanceAction(ctx, req)
 	if err != nil {
-		return fmt.Errorf("error starting instance: %w", err)
+		if !o.cfg.SoftResetOnFailedStart || !isIncorrectState(err) {
+			return fmt.Errorf("error starting instance: %w", err)
+		}
+		slog.WarnContext(ctx, "failed to start instance, soft resetting it", "instance_id", instanceID, "error", err)
+		req.Action = core.InstanceActionActionSoftreset
+		if _, resetErr := computeClient.InstanceAction(ctx, req); resetErr != nil {
+			return fmt.Errorf("error starting instance: %w, and soft resetting it: %w", err, resetErr)
+		}
 	}
 	return nil
 }
 
+// isIncorrectState reports whether the error is a conflict caused by the
+// lifecycle state of the resource.
+func isIncorrectState(err error) bool {
+	var svcErr common.ServiceError
+	return errors.As(err, &svcErr) && svcErr.GetHTTPStatusCode() == http.StatusConflict && svcErr.GetCode() == "IncorrectState"
+}
+
+// FindInstanceByTags returns the non-terminated instance that carries all the
+// given freeform tags, or ErrNotFound if there is none.
 func (o *OciCli) FindInstanceByTags(ctx context.Context, tags map[string]string) (*core.Instance, error) {
-	request := core.ListInstancesRequest{
-		CompartmentId: &o.cfg.CompartmentId,
-	}
-	computeInstances, err := o.computeClient.ListInstances(ctx, request)
+	// A region that can't be listed fails the lookup, the instance could be
+	// in that region.
+	computeInstances, err := o.listAllInstances(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error listing instances: %w", err)
 	}
-	for _, instance := range computeInstances.Items {
-		if instance.LifecycleState != core.InstanceLifecycleStateTerminated {
-			for key, value := range tags {
-				if instance.FreeformTags[key] != value {
-					return nil, nil
-				}
-			}
-			return &instance, nil
+	var matches []core.Instance
+	for _, instance := range computeInstances {
+		if instance.LifecycleState == core.InstanceLifecycleStateTerminated || !hasTags(instance, tags) {
+			continue
+		}
+		matches = append(matches, instance)
+	}
+	if len(matches) == 0 {
+		return nil, garmErrors.ErrNotFound
+	}
+	// Stale duplicates can exist, for example when a delete was interrupted.
+	// Always pick the most recently created one so the result is stable.
+	sort.SliceStable(matches, func(i, j int) bool {
+		return createdAfter(matches[i], matches[j])
+	})
+	if len(matches) > 1 {
+		slog.WarnContext(ctx, "found multiple instances with the same tags, using the most recently created one",
+			"tags", tags,
+			"count", len(matches),
+			"instance_id", *matches[0].Id)
+	}
+	return &matches[0], nil
+}
+
+func hasTags(instance core.Instance, tags map[string]string) bool {
+	for key, value := range tags {
+		if instance.FreeformTags[key] != value {
+			return false
 		}
 	}
-	return nil, nil
+	return true
+}
+
+// createdAfter reports whether instance a was created after instance b.
+// Instances without a creation time sort last.
+func createdAfter(a, b core.Instance) bool {
+	if a.TimeCreated == nil {
+		return false
+	}
+	if b.TimeCreated == nil {
+		return true
+	}
+	return a.TimeCreated.After(b.TimeCreated.Time)
 }
@@ -16,16 +16,31 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"log/slog"
 	"strings"
 	"testing"
+	"time"
 
+	garmErrors "github.com/cloudbase/garm-provider-common/errors"
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/cloudbase/garm-provider-oci/config"
 	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/cloudbase/garm-provider-oci/internal/tracing"
+	"github.com/cloudbase/garm-provider-oci/internal/util"
 	"github.com/oracle/oci-go-sdk/v49/common"
 	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/oracle/oci-go-sdk/v49/identity"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestCreateInstance(t *testing.T) {
@@ -94,6 +109,12 @@ func TestCreateInstance(t *testing.T) {
 		},
 	}
 
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	specHash, err := spec.Hash()
+	require.NoError(t, err)
 	mockComputeClient.On("LaunchInstance", ctx, core.LaunchInstanceRequest{
 		LaunchInstanceDetails: core.LaunchInstanceDetails{
 			CompartmentId:      &spec.CompartmentID,
@@ -114,6 +135,8 @@ func TestCreateInstance(t *testing.T) {
 				"OSType":             string(spec.BootstrapParams.OSType),
 				"OSArch":             string(spec.BootstrapParams.OSArch),
 				"GARM_CONTROLLER_ID": spec.ControllerID,
+				"GARM_SPEC_HASH":     specHash,
+				"GARM_IMAGE_ID":      spec.BootstrapParams.Image,
 			},
 			Metadata: map[string]string{
 				"user_data":           spec.UserData,
@@ -124,15 +147,2038 @@ func TestCreateInstance(t *testing.T) {
 				BootVolumeSizeInGBs: &spec.BootVolumeSize,
 			},
 		},
-	}).Return(core.LaunchInstanceResponse{
-		Instance: expectedInstance,
+	}).Return(core.LaunchInstanceResponse{
+		Instance: expectedInstance,
+	}, nil)
+
+	instance, err := ociCli.CreateInstance(ctx, &spec)
+
+	assert.Nil(t, err)
+	assert.Equal(t, expectedInstance, instance)
+
+}
+
+func TestCreateInstanceWithLabels(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		TenancyID:          "tenancy",
+		UserID:             "user",
+		Region:             "region",
+		Fingerprint:        "fingerprint",
+		PrivateKeyPath:     "private_key_path",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		BootVolumeSize:     256,
+		UserData:           "userdata",
+		ControllerID:       "controller",
+		Ocpus:              2,
+		MemoryInGBs:        8,
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+			OSArch: "amd64",
+			Labels: []string{"oci", " linux", "x64"},
+		},
+	}
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+		return req.LaunchInstanceDetails.FreeformTags["GARM_LABELS"] == "oci,linux,x64"
+	})).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+
+	assert.Nil(t, err)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceWithMultipath(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		IsMultipath:        true,
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "BM.Standard3.64",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	expectedLaunchOptions := &core.LaunchOptions{
+		BootVolumeType:       core.LaunchOptionsBootVolumeTypeIscsi,
+		RemoteDataVolumeType: core.LaunchOptionsRemoteDataVolumeTypeIscsi,
+	}
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+		return assert.ObjectsAreEqual(expectedLaunchOptions, req.LaunchInstanceDetails.LaunchOptions)
+	})).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+
+	assert.Nil(t, err)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceWithPvEncryptionInTransit(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain:             "ad",
+		CompartmentID:                  "compartment",
+		SubnetID:                       "subnet",
+		NsgID:                          "nsg",
+		IsPvEncryptionInTransitEnabled: true,
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	require.NoError(t, spec.Validate())
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+		enabled := req.LaunchInstanceDetails.IsPvEncryptionInTransitEnabled
+		return enabled != nil && *enabled
+	})).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+
+	assert.Nil(t, err)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceLegacyImdsEndpoints(t *testing.T) {
+	tests := []struct {
+		name            string
+		disabled        bool
+		expectedOptions *core.InstanceOptions
+	}{
+		{
+			name:     "disabled",
+			disabled: true,
+			expectedOptions: &core.InstanceOptions{
+				AreLegacyImdsEndpointsDisabled: common.Bool(true),
+			},
+		},
+		{name: "default", disabled: false, expectedOptions: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:             "ad",
+				CompartmentID:                  "compartment",
+				SubnetID:                       "subnet",
+				NsgID:                          "nsg",
+				AreLegacyImdsEndpointsDisabled: tt.disabled,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, tt.expectedOptions, req.LaunchInstanceDetails.InstanceOptions)
+		})
+	}
+}
+
+func TestCreateInstanceWithNetworkPerformance(t *testing.T) {
+	tests := []struct {
+		performance string
+		expected    core.LaunchOptionsNetworkTypeEnum
+	}{
+		{performance: "paravirtualized", expected: core.LaunchOptionsNetworkTypeParavirtualized},
+		{performance: "hardware_assisted", expected: core.LaunchOptionsNetworkTypeVfio},
+		{performance: "emulated", expected: core.LaunchOptionsNetworkTypeE1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.performance, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				NetworkPerformance: tt.performance,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard3.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			require.NoError(t, spec.Validate())
+			expectedLaunchOptions := &core.LaunchOptions{
+				NetworkType: tt.expected,
+			}
+
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+				return assert.ObjectsAreEqual(expectedLaunchOptions, req.LaunchInstanceDetails.LaunchOptions)
+			})).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+
+			assert.Nil(t, err)
+			mockComputeClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCreateInstanceCompartmentQuota(t *testing.T) {
+	garmInstance := func(id string) core.Instance {
+		return core.Instance{
+			Id:             common.String(id),
+			FreeformTags:   map[string]string{"GARM_POOL_ID": "pool-" + id},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+		}
+	}
+	tests := []struct {
+		name      string
+		instances []core.Instance
+		errString string
+	}{
+		{
+			name: "under the cap",
+			instances: []core.Instance{
+				garmInstance("1"),
+				{
+					Id:             common.String("not-garm"),
+					LifecycleState: core.InstanceLifecycleStateRunning,
+				},
+				{
+					Id:             common.String("terminated"),
+					FreeformTags:   map[string]string{"GARM_POOL_ID": "pool"},
+					LifecycleState: core.InstanceLifecycleStateTerminated,
+				},
+			},
+			errString: "",
+		},
+		{
+			name:      "at the cap",
+			instances: []core.Instance{garmInstance("1"), garmInstance("2")},
+			errString: "compartment compartment has 2 GARM instances, launching another would exceed the quota of 2",
+		},
+		{
+			name:      "over the cap",
+			instances: []core.Instance{garmInstance("1"), garmInstance("2"), garmInstance("3")},
+			errString: "compartment compartment has 3 GARM instances, launching another would exceed the quota of 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain:       "ad",
+				CompartmentId:            "compartment",
+				SubnetID:                 "subnet",
+				NsgID:                    "nsg",
+				CompartmentInstanceQuota: 2,
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+				CompartmentId: &cfg.CompartmentId,
+			}).Return(core.ListInstancesResponse{
+				Items: tt.instances,
+			}, nil)
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString == "" {
+				assert.NoError(t, err)
+				mockComputeClient.AssertCalled(t, "LaunchInstance", ctx, mock.Anything)
+			} else {
+				assert.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceImagePreflight(t *testing.T) {
+	tests := []struct {
+		name      string
+		imageErr  error
+		errString string
+	}{
+		{
+			name:      "image found",
+			imageErr:  nil,
+			errString: "",
+		},
+		{
+			name:      "image not found",
+			imageErr:  MockServiceError{StatusCode: 404, Code: "NotAuthorizedOrNotFound"},
+			errString: "image ocid1.image.oc1.iad.aaaaaaaamf7 not found or not accessible in compartment compartment",
+		},
+		{
+			name:      "other error",
+			imageErr:  MockServiceError{StatusCode: 500, Code: "InternalServerError"},
+			errString: "error getting image ocid1.image.oc1.iad.aaaaaaaamf7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, core.GetImageRequest{
+				ImageId: common.String("ocid1.image.oc1.iad.aaaaaaaamf7"),
+			}).Return(core.GetImageResponse{
+				Image: core.Image{Id: common.String("ocid1.image.oc1.iad.aaaaaaaamf7")},
+			}, tt.imageErr)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString != "" {
+				assert.ErrorContains(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+
+			// A second launch with the same image is served from the cache.
+			_, err = ociCli.CreateInstance(ctx, &spec)
+			assert.NoError(t, err)
+			mockComputeClient.AssertNumberOfCalls(t, "GetImage", 1)
+			mockComputeClient.AssertNumberOfCalls(t, "LaunchInstance", 2)
+		})
+	}
+}
+
+func TestCreateInstanceImageByName(t *testing.T) {
+	created := func(day int) *common.SDKTime {
+		return &common.SDKTime{Time: time.Date(2024, time.June, day, 0, 0, 0, 0, time.UTC)}
+	}
+	images := []core.Image{
+		{Id: common.String("ocid1.image.oc1.iad.older"), OperatingSystem: common.String("Canonical Ubuntu"), TimeCreated: created(1)},
+		{Id: common.String("ocid1.image.oc1.iad.newest"), OperatingSystem: common.String("Canonical Ubuntu"), TimeCreated: created(20)},
+		{Id: common.String("ocid1.image.oc1.iad.windows"), OperatingSystem: common.String("Windows"), TimeCreated: created(25)},
+		{Id: common.String("ocid1.image.oc1.iad.old"), OperatingSystem: common.String("Canonical Ubuntu"), TimeCreated: created(10)},
+	}
+	tests := []struct {
+		name        string
+		image       string
+		osType      params.OSType
+		images      []core.Image
+		expectedID  string
+		errString   string
+		listsImages bool
+	}{
+		{
+			name:       "ocid is passed through",
+			image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+			osType:     params.Linux,
+			expectedID: "ocid1.image.oc1.iad.aaaaaaaamf7",
+		},
+		{
+			name:        "name resolves to the newest image of the os type",
+			image:       "Canonical-Ubuntu-22.04",
+			osType:      params.Linux,
+			images:      images,
+			expectedID:  "ocid1.image.oc1.iad.newest",
+			listsImages: true,
+		},
+		{
+			name:        "name resolves by os type",
+			image:       "Canonical-Ubuntu-22.04",
+			osType:      params.Windows,
+			images:      images,
+			expectedID:  "ocid1.image.oc1.iad.windows",
+			listsImages: true,
+		},
+		{
+			name:        "no image with the name",
+			image:       "Canonical-Ubuntu-22.04",
+			osType:      params.Linux,
+			images:      nil,
+			errString:   "no available linux image named Canonical-Ubuntu-22.04 in compartment compartment",
+			listsImages: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  tt.image,
+					OSType: tt.osType,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("ListImages", ctx, core.ListImagesRequest{
+				CompartmentId:  common.String("compartment"),
+				DisplayName:    common.String(tt.image),
+				LifecycleState: core.ImageLifecycleStateAvailable,
+				SortBy:         core.ListImagesSortByTimecreated,
+				SortOrder:      core.ListImagesSortOrderDesc,
+			}).Return(core.ListImagesResponse{Items: tt.images}, nil)
+			mockComputeClient.On("GetImage", ctx, core.GetImageRequest{ImageId: common.String(tt.expectedID)}).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.listsImages {
+				mockComputeClient.AssertCalled(t, "ListImages", ctx, mock.Anything)
+			} else {
+				mockComputeClient.AssertNotCalled(t, "ListImages", ctx, mock.Anything)
+			}
+			if tt.errString != "" {
+				assert.ErrorContains(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			source, ok := req.LaunchInstanceDetails.SourceDetails.(core.InstanceSourceViaImageDetails)
+			require.True(t, ok)
+			assert.Equal(t, tt.expectedID, *source.ImageId)
+			assert.Equal(t, tt.expectedID, req.LaunchInstanceDetails.FreeformTags["GARM_IMAGE_ID"])
+		})
+	}
+}
+
+func TestCreateInstanceCrossTenancyImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		imageErr  error
+		errString string
+	}{
+		{
+			name:     "image shared from another tenancy",
+			imageErr: nil,
+		},
+		{
+			name:      "missing cross-tenancy policy",
+			imageErr:  MockServiceError{StatusCode: 404, Code: "NotAuthorizedOrNotFound"},
+			errString: "need an Endorse policy in this tenancy and an Admit policy in the tenancy of the image",
+		},
+		{
+			name:      "forbidden",
+			imageErr:  MockServiceError{StatusCode: 403, Code: "NotAllowed"},
+			errString: "need an Endorse policy in this tenancy and an Admit policy in the tenancy of the image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			imageID := "ocid1.image.oc1.iad.sharedimage"
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  imageID,
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, core.GetImageRequest{ImageId: &imageID}).Return(core.GetImageResponse{
+				Image: core.Image{
+					Id:              &imageID,
+					CompartmentId:   common.String("ocid1.compartment.oc1..imagetenancy"),
+					OperatingSystem: common.String("Oracle Linux"),
+				},
+			}, tt.imageErr)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString != "" {
+				assert.ErrorContains(t, err, tt.errString)
+				assert.ErrorIs(t, err, tt.imageErr)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			source, ok := req.LaunchInstanceDetails.SourceDetails.(core.InstanceSourceViaImageDetails)
+			require.True(t, ok)
+			assert.Equal(t, imageID, *source.ImageId)
+			assert.Equal(t, "compartment", *req.LaunchInstanceDetails.CompartmentId)
+		})
+	}
+}
+
+func TestCreateInstanceTagDefaults(t *testing.T) {
+	tagDefault := func(name string, required bool) identity.TagDefaultSummary {
+		return identity.TagDefaultSummary{
+			TagNamespaceId:    common.String("ocid1.tagnamespace.oc1..aaaa"),
+			TagDefinitionName: common.String(name),
+			IsRequired:        common.Bool(required),
+		}
+	}
+	// The effective tag set holds the tag defaults of the compartment and
+	// the ones inherited from its parents alike.
+	inherited := tagDefault("CostCenter", true)
+	inherited.CompartmentId = common.String("ocid1.tenancy.oc1..parent")
+	tests := []struct {
+		name        string
+		tagDefaults []identity.TagDefaultSummary
+		definedTags map[string]map[string]string
+		errString   string
+	}{
+		{
+			name:        "no required tag defaults",
+			tagDefaults: []identity.TagDefaultSummary{tagDefault("CreatedBy", false)},
+			errString:   "",
+		},
+		{
+			name: "missing required tag defaults",
+			tagDefaults: []identity.TagDefaultSummary{
+				tagDefault("CreatedBy", false),
+				tagDefault("CostCenter", true),
+				tagDefault("Project", true),
+			},
+			errString: "missing defined tags required by the tag defaults of compartment compartment: Operations.CostCenter, Operations.Project",
+		},
+		{
+			name:        "missing inherited required tag default",
+			tagDefaults: []identity.TagDefaultSummary{inherited, tagDefault("Project", true)},
+			definedTags: map[string]map[string]string{"Operations": {"Project": "runners"}},
+			errString:   "missing defined tags required by the tag defaults of compartment compartment: Operations.CostCenter",
+		},
+		{
+			name:        "required tag defaults supplied by the pool",
+			tagDefaults: []identity.TagDefaultSummary{inherited, tagDefault("Project", true)},
+			definedTags: map[string]map[string]string{"Operations": {"CostCenter": "42", "Project": "runners"}},
+			errString:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				CheckTagDefaults:   true,
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockIdentityClient := new(MockIdentityClient)
+			ociCli := &OciCli{
+				computeClient:  mockComputeClient,
+				identityClient: mockIdentityClient,
+				cfg:            cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				DefinedTags:        tt.definedTags,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockIdentityClient.On("AssembleEffectiveTagSet", ctx, identity.AssembleEffectiveTagSetRequest{
+				CompartmentId:  &cfg.CompartmentId,
+				LifecycleState: identity.TagDefaultSummaryLifecycleStateActive,
+			}).Return(identity.AssembleEffectiveTagSetResponse{
+				Items: tt.tagDefaults,
+			}, nil)
+			mockIdentityClient.On("GetTagNamespace", ctx, identity.GetTagNamespaceRequest{
+				TagNamespaceId: common.String("ocid1.tagnamespace.oc1..aaaa"),
+			}).Return(identity.GetTagNamespaceResponse{
+				TagNamespace: identity.TagNamespace{Name: common.String("Operations")},
+			}, nil)
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceWithNsgName(t *testing.T) {
+	nsg := func(id string, state core.NetworkSecurityGroupLifecycleStateEnum) core.NetworkSecurityGroup {
+		return core.NetworkSecurityGroup{
+			Id:             common.String(id),
+			DisplayName:    common.String("garm-nsg"),
+			LifecycleState: state,
+		}
+	}
+	tests := []struct {
+		name      string
+		nsgID     string
+		groups    []core.NetworkSecurityGroup
+		expected  string
+		errString string
+	}{
+		{
+			name:     "resolved by name",
+			groups:   []core.NetworkSecurityGroup{nsg("ocid1.networksecuritygroup.oc1..aaaa", core.NetworkSecurityGroupLifecycleStateAvailable)},
+			expected: "ocid1.networksecuritygroup.oc1..aaaa",
+		},
+		{
+			name: "terminated groups are ignored",
+			groups: []core.NetworkSecurityGroup{
+				nsg("ocid1.networksecuritygroup.oc1..old", core.NetworkSecurityGroupLifecycleStateTerminated),
+				nsg("ocid1.networksecuritygroup.oc1..aaaa", core.NetworkSecurityGroupLifecycleStateAvailable),
+			},
+			expected: "ocid1.networksecuritygroup.oc1..aaaa",
+		},
+		{
+			name:     "explicit id is preferred",
+			nsgID:    "ocid1.networksecuritygroup.oc1..explicit",
+			expected: "ocid1.networksecuritygroup.oc1..explicit",
+		},
+		{
+			name:      "name not found",
+			errString: "network security group \"garm-nsg\" not found in vcn ocid1.vcn.oc1..aaaa",
+		},
+		{
+			name: "duplicate names",
+			groups: []core.NetworkSecurityGroup{
+				nsg("ocid1.networksecuritygroup.oc1..aaaa", core.NetworkSecurityGroupLifecycleStateAvailable),
+				nsg("ocid1.networksecuritygroup.oc1..bbbb", core.NetworkSecurityGroupLifecycleStateAvailable),
+			},
+			errString: "network security group name \"garm-nsg\" is not unique in vcn ocid1.vcn.oc1..aaaa, found 2 groups",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              tt.nsgID,
+				NsgName:            "garm-nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockNetworkClient := new(MockNetworkClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				networkClient: mockNetworkClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              tt.nsgID,
+				NsgName:            "garm-nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockNetworkClient.On("GetSubnet", ctx, core.GetSubnetRequest{
+				SubnetId: common.String("subnet"),
+			}).Return(core.GetSubnetResponse{
+				Subnet: core.Subnet{VcnId: common.String("ocid1.vcn.oc1..aaaa")},
+			}, nil)
+			mockNetworkClient.On("ListNetworkSecurityGroups", ctx, core.ListNetworkSecurityGroupsRequest{
+				CompartmentId: common.String("compartment"),
+				VcnId:         common.String("ocid1.vcn.oc1..aaaa"),
+				DisplayName:   common.String("garm-nsg"),
+			}).Return(core.ListNetworkSecurityGroupsResponse{
+				Items: tt.groups,
+			}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+				return len(req.CreateVnicDetails.NsgIds) == 1 && req.CreateVnicDetails.NsgIds[0] == tt.expected
+			})).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString == "" {
+				assert.NoError(t, err)
+				mockComputeClient.AssertExpectations(t)
+			} else {
+				assert.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+			}
+			if tt.nsgID != "" {
+				mockNetworkClient.AssertNotCalled(t, "GetSubnet", ctx, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceWithCapacityReservationID(t *testing.T) {
+	tests := []struct {
+		name          string
+		reservationID string
+		expected      *string
+	}{
+		{name: "reservation", reservationID: "ocid1.capacityreservation.oc1.iad.aaaa", expected: common.String("ocid1.capacityreservation.oc1.iad.aaaa")},
+		{name: "no reservation", reservationID: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:    "ad",
+				CompartmentID:         "compartment",
+				SubnetID:              "subnet",
+				NsgID:                 "nsg",
+				CapacityReservationID: tt.reservationID,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, tt.expected, req.LaunchInstanceDetails.CapacityReservationId)
+			mockComputeClient.AssertNotCalled(t, "ListComputeCapacityReservations", ctx, mock.Anything)
+		})
+	}
+}
+
+func TestCreateInstanceOnDedicatedVMHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostID   string
+		expected *string
+	}{
+		{name: "dedicated host", hostID: "ocid1.dedicatedvmhost.oc1.iad.aaaa", expected: common.String("ocid1.dedicatedvmhost.oc1.iad.aaaa")},
+		{name: "shared hosts", hostID: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				DedicatedVMHostID:  tt.hostID,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, tt.expected, req.LaunchInstanceDetails.DedicatedVmHostId)
+		})
+	}
+}
+
+func TestCreateInstanceWithCapacityReservationName(t *testing.T) {
+	reservation := func(id string, state core.ComputeCapacityReservationLifecycleStateEnum) core.ComputeCapacityReservationSummary {
+		return core.ComputeCapacityReservationSummary{
+			Id:             common.String(id),
+			DisplayName:    common.String("runners"),
+			LifecycleState: state,
+		}
+	}
+	tests := []struct {
+		name          string
+		reservationID string
+		reservations  []core.ComputeCapacityReservationSummary
+		expected      string
+		errString     string
+	}{
+		{
+			name:         "resolved by name",
+			reservations: []core.ComputeCapacityReservationSummary{reservation("ocid1.capacityreservation.oc1..aaaa", core.ComputeCapacityReservationLifecycleStateActive)},
+			expected:     "ocid1.capacityreservation.oc1..aaaa",
+		},
+		{
+			name: "deleted reservations are ignored",
+			reservations: []core.ComputeCapacityReservationSummary{
+				reservation("ocid1.capacityreservation.oc1..old", core.ComputeCapacityReservationLifecycleStateDeleted),
+				reservation("ocid1.capacityreservation.oc1..aaaa", core.ComputeCapacityReservationLifecycleStateActive),
+			},
+			expected: "ocid1.capacityreservation.oc1..aaaa",
+		},
+		{
+			name:          "explicit id is preferred",
+			reservationID: "ocid1.capacityreservation.oc1..explicit",
+			expected:      "ocid1.capacityreservation.oc1..explicit",
+		},
+		{
+			name:      "name not found",
+			errString: "compute capacity reservation \"runners\" not found in availability domain ad",
+		},
+		{
+			name: "duplicate names",
+			reservations: []core.ComputeCapacityReservationSummary{
+				reservation("ocid1.capacityreservation.oc1..aaaa", core.ComputeCapacityReservationLifecycleStateActive),
+				reservation("ocid1.capacityreservation.oc1..bbbb", core.ComputeCapacityReservationLifecycleStateActive),
+			},
+			errString: "compute capacity reservation name \"runners\" is not unique in availability domain ad, found 2 reservations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:      "ad",
+				CompartmentID:           "compartment",
+				SubnetID:                "subnet",
+				NsgID:                   "nsg",
+				CapacityReservationID:   tt.reservationID,
+				CapacityReservationName: "runners",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("ListComputeCapacityReservations", ctx, core.ListComputeCapacityReservationsRequest{
+				CompartmentId:      common.String("compartment"),
+				AvailabilityDomain: common.String("ad"),
+				DisplayName:        common.String("runners"),
+			}).Return(core.ListComputeCapacityReservationsResponse{
+				Items: tt.reservations,
+			}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+				return req.CapacityReservationId != nil && *req.CapacityReservationId == tt.expected
+			})).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString == "" {
+				assert.NoError(t, err)
+				mockComputeClient.AssertCalled(t, "LaunchInstance", ctx, mock.Anything)
+			} else {
+				assert.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+			}
+			if tt.reservationID != "" {
+				mockComputeClient.AssertNotCalled(t, "ListComputeCapacityReservations", ctx, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceRedactsMetadataInLogs(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+
+	ctx := context.Background()
+	token := "AABBCCDDEEFFGGHHIIJJKKLLMMNN"
+	userData := base64.StdEncoding.EncodeToString([]byte("#!/bin/bash\nTOKEN=" + token))
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		UserData:           userData,
+		SSHPublicKeys:      []string{"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC"},
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+	require.NoError(t, err)
+
+	require.Contains(t, logs.String(), "launching instance")
+	assert.NotContains(t, logs.String(), token)
+	assert.NotContains(t, logs.String(), userData)
+	assert.NotContains(t, logs.String(), spec.SSHPublicKeys[0])
+	assert.Contains(t, logs.String(), util.RedactedValue)
+}
+
+func TestCreateInstanceUserDataMetadataKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		metadataKey string
+		expectedKey string
+	}{
+		{
+			name:        "default key",
+			expectedKey: "user_data",
+		},
+		{
+			name:        "custom key",
+			metadataKey: "ghes_user_data",
+			expectedKey: "ghes_user_data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain:  "ad",
+				CompartmentId:       "compartment",
+				SubnetID:            "subnet",
+				NsgID:               "nsg",
+				UserDataMetadataKey: tt.metadataKey,
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				UserData:           "dXNlcmRhdGE=",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, map[string]string{
+				tt.expectedKey:        "dXNlcmRhdGE=",
+				"ssh_authorized_keys": "",
+			}, req.Metadata)
+		})
+	}
+}
+
+func TestCreateInstanceMetadataFromEnv(t *testing.T) {
+	t.Setenv("GARM_TEST_TOKEN", "s3cr3t")
+	tests := []struct {
+		name             string
+		metadata         map[string]string
+		expectedMetadata map[string]string
+		errString        string
+	}{
+		{
+			name:     "resolved from environment",
+			metadata: map[string]string{"token": "${GARM_TEST_TOKEN}", "plain": "value"},
+			expectedMetadata: map[string]string{
+				"user_data":           "dXNlcmRhdGE=",
+				"ssh_authorized_keys": "",
+				"token":               "s3cr3t",
+				"plain":               "value",
+			},
+		},
+		{
+			name:      "undefined variable",
+			metadata:  map[string]string{"token": "${GARM_TEST_UNDEFINED}"},
+			errString: "error resolving metadata token: undefined environment variable GARM_TEST_UNDEFINED",
+		},
+		{
+			name:      "reserved key",
+			metadata:  map[string]string{"user_data": "${GARM_TEST_TOKEN}"},
+			errString: "metadata key user_data is set by the provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				UserData:           "dXNlcmRhdGE=",
+				Metadata:           tt.metadata,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, tt.expectedMetadata, req.Metadata)
+		})
+	}
+}
+
+func TestCreateInstancePreemptionAction(t *testing.T) {
+	tests := []struct {
+		name               string
+		preemptible        bool
+		preserveBootVolume bool
+	}{
+		{name: "on demand"},
+		{name: "terminate with boot volume", preemptible: true},
+		{name: "preserve boot volume", preemptible: true, preserveBootVolume: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:             "ad",
+				CompartmentID:                  "compartment",
+				SubnetID:                       "subnet",
+				NsgID:                          "nsg",
+				Preemptible:                    tt.preemptible,
+				PreserveBootVolumeOnPreemption: tt.preserveBootVolume,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			if !tt.preemptible {
+				require.Nil(t, req.PreemptibleInstanceConfig)
+				return
+			}
+			require.NotNil(t, req.PreemptibleInstanceConfig)
+			assert.Equal(t, core.TerminatePreemptionAction{
+				PreserveBootVolume: common.Bool(tt.preserveBootVolume),
+			}, req.PreemptibleInstanceConfig.PreemptionAction)
+		})
+	}
+}
+
+func TestCheckImageOSType(t *testing.T) {
+	imageID := "ocid1.image.oc1.iad.aaaaaaaamf7"
+	tests := []struct {
+		name            string
+		operatingSystem *string
+		osType          params.OSType
+		errString       string
+	}{
+		{name: "linux image on linux pool", operatingSystem: common.String("Canonical Ubuntu"), osType: params.Linux},
+		{name: "windows image on windows pool", operatingSystem: common.String("Windows"), osType: params.Windows},
+		{name: "unknown operating system", osType: params.Windows},
+		{
+			name:            "windows image on linux pool",
+			operatingSystem: common.String("Windows"),
+			osType:          params.Linux,
+			errString:       "image ocid1.image.oc1.iad.aaaaaaaamf7 runs Windows, which is not a linux operating system",
+		},
+		{
+			name:            "linux image on windows pool",
+			operatingSystem: common.String("Oracle Linux"),
+			osType:          params.Windows,
+			errString:       "image ocid1.image.oc1.iad.aaaaaaaamf7 runs Oracle Linux, which is not a windows operating system",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImageOSType(imageID, core.Image{OperatingSystem: tt.operatingSystem}, tt.osType)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceCopyImageTags(t *testing.T) {
+	imageTags := map[string]string{
+		"BuildVersion": "1.2.3",
+		"PatchLevel":   "2024-06",
+		"Owner":        "images-team",
+		"Name":         "golden-image",
+		"GARM_POOL_ID": "other-pool",
+	}
+	tests := []struct {
+		name      string
+		selected  []string
+		extraTags map[string]string
+		expected  map[string]string
+	}{
+		{
+			name:     "nothing selected",
+			selected: nil,
+			expected: map[string]string{},
+		},
+		{
+			name:     "selected tags",
+			selected: []string{"BuildVersion", "PatchLevel", "Missing"},
+			expected: map[string]string{"BuildVersion": "1.2.3", "PatchLevel": "2024-06"},
+		},
+		{
+			name:     "all tags minus reserved",
+			selected: []string{"*"},
+			expected: map[string]string{"BuildVersion": "1.2.3", "PatchLevel": "2024-06", "Owner": "images-team"},
+		},
+		{
+			name:      "extra tags win over image tags",
+			selected:  []string{"*"},
+			extraTags: map[string]string{"Owner": "ci-team", "CostCenter": "ci"},
+			expected:  map[string]string{"BuildVersion": "1.2.3", "PatchLevel": "2024-06", "Owner": "ci-team", "CostCenter": "ci"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				ControllerID:       "controller",
+				CopyImageTags:      tt.selected,
+				ExtraTags:          tt.extraTags,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+					OSArch: params.Amd64,
+					PoolID: "my-pool",
+				},
+			}
+			specHash, err := spec.Hash()
+			require.NoError(t, err)
+			expectedTags := map[string]string{
+				"Name":               "garm-instance",
+				"GARM_POOL_ID":       "my-pool",
+				"OSType":             "linux",
+				"OSArch":             "amd64",
+				"GARM_CONTROLLER_ID": "controller",
+				"GARM_SPEC_HASH":     specHash,
+				"GARM_IMAGE_ID":      "ocid1.image.oc1.iad.aaaaaaaamf7",
+			}
+			for key, value := range tt.expected {
+				expectedTags[key] = value
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{
+				Image: core.Image{FreeformTags: imageTags},
+			}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err = ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, expectedTags, req.LaunchInstanceDetails.FreeformTags)
+		})
+	}
+}
+
+func TestCreateInstanceDefinedTags(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		ControllerID:       "controller",
+		DefinedTags: map[string]map[string]string{
+			"Operations": {"CostCenter": "ci", "Environment": "prod"},
+		},
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+			OSArch: params.Amd64,
+			PoolID: "my-pool",
+		},
+	}
+	specHash, err := spec.Hash()
+	require.NoError(t, err)
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
 	}, nil)
 
-	instance, err := ociCli.CreateInstance(ctx, &spec)
+	_, err = ociCli.CreateInstance(ctx, &spec)
+	require.NoError(t, err)
+	req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+	assert.Equal(t, map[string]map[string]interface{}{
+		"Operations": {"CostCenter": "ci", "Environment": "prod"},
+	}, req.LaunchInstanceDetails.DefinedTags)
+	assert.Equal(t, map[string]string{
+		"Name":               "garm-instance",
+		"GARM_POOL_ID":       "my-pool",
+		"OSType":             "linux",
+		"OSArch":             "amd64",
+		"GARM_CONTROLLER_ID": "controller",
+		"GARM_SPEC_HASH":     specHash,
+		"GARM_IMAGE_ID":      "ocid1.image.oc1.iad.aaaaaaaamf7",
+	}, req.LaunchInstanceDetails.FreeformTags)
+}
 
-	assert.Nil(t, err)
-	assert.Equal(t, expectedInstance, instance)
+func TestCreateInstanceSubnetCapacity(t *testing.T) {
+	privateIps := func(count int) []core.PrivateIp {
+		items := make([]core.PrivateIp, count)
+		for i := range items {
+			items[i] = core.PrivateIp{SubnetId: common.String("subnet")}
+		}
+		return items
+	}
+	tests := []struct {
+		name      string
+		firstPage int
+		lastPage  int
+		errString string
+	}{
+		{
+			name:      "addresses available",
+			firstPage: 2,
+			lastPage:  2,
+			errString: "",
+		},
+		{
+			name:      "subnet exhausted",
+			firstPage: 3,
+			lastPage:  2,
+			errString: "subnet subnet exhausted: all 5 private IP addresses of 10.0.0.0/29 are in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain:  "ad",
+				CompartmentId:       "compartment",
+				SubnetID:            "subnet",
+				NsgID:               "nsg",
+				CheckSubnetCapacity: true,
+			}
+			mockComputeClient := new(MockComputeClient)
+			mockNetworkClient := new(MockNetworkClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				networkClient: mockNetworkClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockNetworkClient.On("GetSubnet", ctx, core.GetSubnetRequest{
+				SubnetId: common.String("subnet"),
+			}).Return(core.GetSubnetResponse{
+				Subnet: core.Subnet{CidrBlock: common.String("10.0.0.0/29")},
+			}, nil)
+			mockNetworkClient.On("ListPrivateIps", ctx, core.ListPrivateIpsRequest{
+				SubnetId: common.String("subnet"),
+			}).Return(core.ListPrivateIpsResponse{
+				Items:       privateIps(tt.firstPage),
+				OpcNextPage: common.String("page-2"),
+			}, nil)
+			mockNetworkClient.On("ListPrivateIps", ctx, core.ListPrivateIpsRequest{
+				SubnetId: common.String("subnet"),
+				Page:     common.String("page-2"),
+			}).Return(core.ListPrivateIpsResponse{
+				Items: privateIps(tt.lastPage),
+			}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			if tt.errString == "" {
+				assert.NoError(t, err)
+				mockComputeClient.AssertCalled(t, "LaunchInstance", ctx, mock.Anything)
+			} else {
+				assert.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "LaunchInstance", ctx, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceWithHostnameLabel(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		HostnameTemplate:   "runner-{{.ShortPoolID}}-{{.Suffix}}",
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-AbCdEf12",
+			PoolID: "0f3e9a3c-1b2d-4c5e-8f90-a1b2c3d4e5f6",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	require.NoError(t, spec.SetHostnameLabel())
+	require.Equal(t, "runner-0f3e9a3c-abcdef12", spec.HostnameLabel)
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+		label := req.LaunchInstanceDetails.CreateVnicDetails.HostnameLabel
+		return label != nil && *label == "runner-0f3e9a3c-abcdef12"
+	})).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+	assert.NoError(t, err)
+	mockComputeClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceWithFaultDomain(t *testing.T) {
+	tests := []struct {
+		name        string
+		faultDomain string
+	}{
+		{name: "fault domain", faultDomain: "FAULT-DOMAIN-2"},
+		{name: "no fault domain", faultDomain: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				FaultDomain:        tt.faultDomain,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			if tt.faultDomain == "" {
+				assert.Nil(t, req.LaunchInstanceDetails.FaultDomain)
+			} else {
+				require.NotNil(t, req.LaunchInstanceDetails.FaultDomain)
+				assert.Equal(t, tt.faultDomain, *req.LaunchInstanceDetails.FaultDomain)
+			}
+		})
+	}
+}
+
+func TestCreateInstanceNetworkSecurityMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		expected []string
+	}{
+		{name: "default", mode: "", expected: []string{"nsg"}},
+		{name: "nsg", mode: spec.NetworkSecurityModeNsg, expected: []string{"nsg"}},
+		{name: "both", mode: spec.NetworkSecurityModeBoth, expected: []string{"nsg"}},
+		{name: "security list", mode: spec.NetworkSecurityModeSecurityList, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain:  "ad",
+				CompartmentID:       "compartment",
+				SubnetID:            "subnet",
+				NsgID:               "nsg",
+				NetworkSecurityMode: tt.mode,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, &core.CreateVnicDetails{
+				SubnetId: common.String("subnet"),
+				NsgIds:   tt.expected,
+			}, req.LaunchInstanceDetails.CreateVnicDetails)
+		})
+	}
+}
+
+func TestCreateInstanceWithNsgIDs(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	nsgIDs := []string{
+		"ocid1.networksecuritygroup.oc1.iad.aaaa",
+		"ocid1.networksecuritygroup.oc1.iad.bbbb",
+		"ocid1.networksecuritygroup.oc1.iad.cccc",
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		// Repeated groups are only attached once.
+		NsgIDs: append(nsgIDs, nsgIDs[0]),
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+	require.NoError(t, err)
+	req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+	assert.Equal(t, nsgIDs, req.LaunchInstanceDetails.CreateVnicDetails.NsgIds)
+}
+
+func TestCreateInstanceAssignPublicIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		assignPublicIP *bool
+	}{
+		{name: "assign", assignPublicIP: common.Bool(true)},
+		{name: "don't assign", assignPublicIP: common.Bool(false)},
+		{name: "subnet default", assignPublicIP: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				AssignPublicIP:     tt.assignPublicIP,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, tt.assignPublicIP, req.LaunchInstanceDetails.CreateVnicDetails.AssignPublicIp)
+		})
+	}
+}
+
+func TestCreateInstanceHostnameLabel(t *testing.T) {
+	tests := []struct {
+		name          string
+		hostnameLabel string
+		expected      *string
+	}{
+		{name: "label", hostnameLabel: "build-runner-1", expected: common.String("build-runner-1")},
+		{name: "no label", hostnameLabel: "", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				HostnameLabel:      tt.hostnameLabel,
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+			}, nil)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+			require.NoError(t, err)
+			req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+			assert.Equal(t, tt.expected, req.LaunchInstanceDetails.CreateVnicDetails.HostnameLabel)
+		})
+	}
+}
+
+func TestCreateInstanceTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
 
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	mockComputeClient.On("ListShapes", mock.Anything, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", mock.Anything, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", mock.MatchedBy(func(ctx context.Context) bool {
+		return trace.SpanContextFromContext(ctx).IsValid()
+	}), mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "CreateInstance", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, tracing.InstanceNameKey.String("garm-instance"))
+}
+
+func TestGetShape(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		ShapeCacheTTL:      "1m",
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+		now:           func() time.Time { return now },
+	}
+	mockComputeClient.On("ListShapes", ctx, core.ListShapesRequest{
+		CompartmentId:      &cfg.CompartmentId,
+		AvailabilityDomain: &cfg.AvailabilityDomain,
+	}).Return(core.ListShapesResponse{
+		Items:       []core.Shape{{Shape: common.String("VM.Standard.E4.Flex")}},
+		OpcNextPage: common.String("page2"),
+	}, nil)
+	mockComputeClient.On("ListShapes", ctx, core.ListShapesRequest{
+		CompartmentId:      &cfg.CompartmentId,
+		AvailabilityDomain: &cfg.AvailabilityDomain,
+		Page:               common.String("page2"),
+	}).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String("BM.Standard3.64")}},
+	}, nil)
+
+	shape, err := ociCli.GetShape(ctx, "VM.Standard.E4.Flex")
+	assert.NoError(t, err)
+	assert.Equal(t, "VM.Standard.E4.Flex", *shape.Shape)
+	mockComputeClient.AssertNumberOfCalls(t, "ListShapes", 2)
+
+	// Within the TTL the cached list is used, including for unknown shapes.
+	now = now.Add(30 * time.Second)
+	shape, err = ociCli.GetShape(ctx, "BM.Standard3.64")
+	assert.NoError(t, err)
+	assert.Equal(t, "BM.Standard3.64", *shape.Shape)
+	_, err = ociCli.GetShape(ctx, "VM.Unknown")
+	assert.EqualError(t, err, "shape VM.Unknown is not available in availability domain ad")
+	mockComputeClient.AssertNumberOfCalls(t, "ListShapes", 2)
+
+	// Once the TTL expires the shapes are listed again.
+	now = now.Add(time.Minute)
+	_, err = ociCli.GetShape(ctx, "VM.Standard.E4.Flex")
+	assert.NoError(t, err)
+	mockComputeClient.AssertNumberOfCalls(t, "ListShapes", 4)
 }
 
 func TestGetInstanceWithName(t *testing.T) {
@@ -216,63 +2262,185 @@ func TestGetInstanceWithId(t *testing.T) {
 		Instance: expectedInstance,
 	}, nil)
 
-	instance, err := ociCli.GetInstance(ctx, inst)
+	instance, err := ociCli.GetInstance(ctx, inst)
+
+	assert.Nil(t, err)
+	assert.Equal(t, expectedInstance, instance)
+}
+
+func TestDeleteInstanceWithName(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		TenancyID:          "tenancy",
+		UserID:             "user",
+		Region:             "region",
+		Fingerprint:        "fingerprint",
+		PrivateKeyPath:     "private_key_path",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	inst := "instance"
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{{
+			Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+			AvailabilityDomain: &cfg.AvailabilityDomain,
+			CompartmentId:      &cfg.CompartmentId,
+			Region:             &cfg.Region,
+			FreeformTags:       map[string]string{"Name": inst},
+			LifecycleState:     core.InstanceLifecycleStateRunning,
+		}}}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	assert.Nil(t, err)
+}
+
+func TestDeleteInstanceWithId(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		TenancyID:          "tenancy",
+		UserID:             "user",
+		Region:             "region",
+		Fingerprint:        "fingerprint",
+		PrivateKeyPath:     "private_key_path",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: &inst,
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst},
+	}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         &inst,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	assert.Nil(t, err)
+}
+
+func TestDeleteInstancePreserveBootVolume(t *testing.T) {
+	tests := []struct {
+		name               string
+		preserveBootVolume bool
+	}{
+		{
+			name:               "deleted by default",
+			preserveBootVolume: false,
+		},
+		{
+			name:               "preserved",
+			preserveBootVolume: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				CompartmentId:      "compartment",
+				PreserveBootVolume: tt.preserveBootVolume,
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+			mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: &inst,
+			}).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: &inst},
+			}, nil)
+			mockComputeClient.On("TerminateInstance", ctx, mock.Anything).Return(core.TerminateInstanceResponse{}, nil)
 
-	assert.Nil(t, err)
-	assert.Equal(t, expectedInstance, instance)
+			err := ociCli.DeleteInstance(ctx, inst)
+			require.NoError(t, err)
+
+			request := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.TerminateInstanceRequest)
+			require.NotNil(t, request.PreserveBootVolume)
+			require.Equal(t, tt.preserveBootVolume, *request.PreserveBootVolume)
+		})
+	}
 }
 
-func TestDeleteInstanceWithName(t *testing.T) {
+func TestDeleteInstanceTagOnTerminate(t *testing.T) {
 	ctx := context.Background()
 	cfg := &config.Config{
-		AvailabilityDomain: "ad",
-		CompartmentId:      "compartment",
-		SubnetID:           "subnet",
-		NsgID:              "nsg",
-		TenancyID:          "tenancy",
-		UserID:             "user",
-		Region:             "region",
-		Fingerprint:        "fingerprint",
-		PrivateKeyPath:     "private_key_path",
+		CompartmentId:  "compartment",
+		TagOnTerminate: true,
 	}
 	mockComputeClient := new(MockComputeClient)
 	ociCli := &OciCli{
 		computeClient: mockComputeClient,
 		cfg:           cfg,
+		controllerID:  "controller",
+		now: func() time.Time {
+			return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		},
 	}
-	inst := "instance"
-	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
-		CompartmentId: &cfg.CompartmentId,
-	}).Return(core.ListInstancesResponse{
-		Items: []core.Instance{{
-			Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
-			AvailabilityDomain: &cfg.AvailabilityDomain,
-			CompartmentId:      &cfg.CompartmentId,
-			Region:             &cfg.Region,
-			FreeformTags:       map[string]string{"Name": inst},
-			LifecycleState:     core.InstanceLifecycleStateRunning,
-		}}}, nil)
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: common.String(inst),
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{
+			Id:           common.String(inst),
+			FreeformTags: map[string]string{"Name": "garm-instance"},
+		},
+	}, nil)
+	mockComputeClient.On("UpdateInstance", ctx, core.UpdateInstanceRequest{
+		InstanceId: common.String(inst),
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			FreeformTags: map[string]string{
+				"Name":               "garm-instance",
+				"GARM_TERMINATED_AT": "2024-06-01T12:00:00Z",
+				"GARM_TERMINATED_BY": "controller",
+			},
+		},
+	}).Return(core.UpdateInstanceResponse{}, nil)
 	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
-		InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		InstanceId:         common.String(inst),
+		PreserveBootVolume: common.Bool(false),
 	}).Return(core.TerminateInstanceResponse{}, nil)
 
 	err := ociCli.DeleteInstance(ctx, inst)
 
-	assert.Nil(t, err)
+	require.NoError(t, err)
+	mockComputeClient.AssertExpectations(t)
+	calls := mockComputeClient.Calls
+	assert.Equal(t, "UpdateInstance", calls[len(calls)-2].Method)
+	assert.Equal(t, "TerminateInstance", calls[len(calls)-1].Method)
 }
 
-func TestDeleteInstanceWithId(t *testing.T) {
+func TestDeleteInstanceTagOnTerminateFailure(t *testing.T) {
 	ctx := context.Background()
 	cfg := &config.Config{
-		AvailabilityDomain: "ad",
-		CompartmentId:      "compartment",
-		SubnetID:           "subnet",
-		NsgID:              "nsg",
-		TenancyID:          "tenancy",
-		UserID:             "user",
-		Region:             "region",
-		Fingerprint:        "fingerprint",
-		PrivateKeyPath:     "private_key_path",
+		CompartmentId:  "compartment",
+		TagOnTerminate: true,
 	}
 	mockComputeClient := new(MockComputeClient)
 	ociCli := &OciCli{
@@ -280,13 +2448,23 @@ func TestDeleteInstanceWithId(t *testing.T) {
 		cfg:           cfg,
 	}
 	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+
+	// The termination protection check succeeds, looking the tags up for the
+	// termination record fails.
+	mockComputeClient.On("GetInstance", ctx, mock.Anything).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: common.String(inst)},
+	}, nil).Once()
+	mockComputeClient.On("GetInstance", ctx, mock.Anything).Return(core.GetInstanceResponse{}, MockServiceError{StatusCode: 500})
 	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
-		InstanceId: &inst,
+		InstanceId:         common.String(inst),
+		PreserveBootVolume: common.Bool(false),
 	}).Return(core.TerminateInstanceResponse{}, nil)
 
 	err := ociCli.DeleteInstance(ctx, inst)
 
-	assert.Nil(t, err)
+	require.NoError(t, err)
+	mockComputeClient.AssertNotCalled(t, "UpdateInstance", ctx, mock.Anything)
+	mockComputeClient.AssertCalled(t, "TerminateInstance", ctx, mock.Anything)
 }
 
 func TestListInstances(t *testing.T) {
@@ -337,33 +2515,148 @@ func TestListInstances(t *testing.T) {
 	assert.Equal(t, expectedInstances, instances)
 }
 
-func TestStopInstance(t *testing.T) {
+func TestListInstancesPagination(t *testing.T) {
 	ctx := context.Background()
 	cfg := &config.Config{
-		AvailabilityDomain: "ad",
-		CompartmentId:      "compartment",
-		SubnetID:           "subnet",
-		NsgID:              "nsg",
-		TenancyID:          "tenancy",
-		UserID:             "user",
-		Region:             "region",
-		Fingerprint:        "fingerprint",
-		PrivateKeyPath:     "private_key_path",
+		CompartmentId: "compartment",
 	}
 	mockComputeClient := new(MockComputeClient)
 	ociCli := &OciCli{
 		computeClient: mockComputeClient,
 		cfg:           cfg,
 	}
-	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
-	mockComputeClient.On("InstanceAction", ctx, core.InstanceActionRequest{
-		InstanceId: &inst,
-		Action:     core.InstanceActionActionStop,
-	}).Return(core.InstanceActionResponse{}, nil)
+	first := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.first"),
+		FreeformTags:   map[string]string{"GARM_POOL_ID": "pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	second := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.second"),
+		FreeformTags:   map[string]string{"GARM_POOL_ID": "pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items:       []core.Instance{first},
+		OpcNextPage: common.String("page-2"),
+	}, nil)
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+		Page:          common.String("page-2"),
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{second},
+	}, nil)
 
-	err := ociCli.StopInstance(ctx, inst)
+	instances, err := ociCli.ListInstances(ctx, "pool")
 
-	assert.Nil(t, err)
+	require.NoError(t, err)
+	assert.Equal(t, []core.Instance{first, second}, instances)
+	mockComputeClient.AssertNumberOfCalls(t, "ListInstances", 2)
+}
+
+func TestListInstancesWithPendingMaintenance(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+		controllerID:  "controller",
+	}
+	rebootDue := &common.SDKTime{Time: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	garmTags := func(name, controllerID string) map[string]string {
+		return map[string]string{
+			"Name":               name,
+			"GARM_POOL_ID":       "my-pool",
+			"GARM_CONTROLLER_ID": controllerID,
+		}
+	}
+	pending := core.Instance{
+		Id:                       common.String("ocid1.instance.oc1.iad.pending"),
+		FreeformTags:             garmTags("pending", "controller"),
+		LifecycleState:           core.InstanceLifecycleStateRunning,
+		TimeMaintenanceRebootDue: rebootDue,
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{
+			pending,
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.healthy"),
+				FreeformTags:   garmTags("healthy", "controller"),
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+			{
+				Id:                       common.String("ocid1.instance.oc1.iad.other"),
+				FreeformTags:             garmTags("other", "other-controller"),
+				LifecycleState:           core.InstanceLifecycleStateRunning,
+				TimeMaintenanceRebootDue: rebootDue,
+			},
+			{
+				Id:                       common.String("ocid1.instance.oc1.iad.unmanaged"),
+				LifecycleState:           core.InstanceLifecycleStateRunning,
+				TimeMaintenanceRebootDue: rebootDue,
+			},
+			{
+				Id:                       common.String("ocid1.instance.oc1.iad.terminated"),
+				FreeformTags:             garmTags("terminated", "controller"),
+				LifecycleState:           core.InstanceLifecycleStateTerminated,
+				TimeMaintenanceRebootDue: rebootDue,
+			},
+		},
+	}, nil)
+
+	instances, err := ociCli.ListInstancesWithPendingMaintenance(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, []core.Instance{pending}, instances)
+}
+
+func TestStopInstance(t *testing.T) {
+	tests := []struct {
+		name     string
+		force    bool
+		expected core.InstanceActionActionEnum
+	}{
+		{name: "stop", force: false, expected: core.InstanceActionActionSoftstop},
+		{name: "forced", force: true, expected: core.InstanceActionActionStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				TenancyID:          "tenancy",
+				UserID:             "user",
+				Region:             "region",
+				Fingerprint:        "fingerprint",
+				PrivateKeyPath:     "private_key_path",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+			mockComputeClient.On("InstanceAction", ctx, core.InstanceActionRequest{
+				InstanceId: &inst,
+				Action:     tt.expected,
+			}).Return(core.InstanceActionResponse{}, nil)
+
+			err := ociCli.StopInstance(ctx, inst, tt.force)
+
+			assert.Nil(t, err)
+			mockComputeClient.AssertNumberOfCalls(t, "InstanceAction", 1)
+		})
+	}
 }
 
 func TestStartInstance(t *testing.T) {
@@ -395,6 +2688,77 @@ func TestStartInstance(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestStartInstanceSoftResetFallback(t *testing.T) {
+	incorrectState := MockServiceError{StatusCode: 409, Code: "IncorrectState"}
+	tests := []struct {
+		name          string
+		softReset     bool
+		startErr      error
+		resetErr      error
+		expectedReset bool
+		errString     string
+	}{
+		{
+			name:          "soft reset succeeds",
+			softReset:     true,
+			startErr:      incorrectState,
+			expectedReset: true,
+		},
+		{
+			name:          "soft reset fails",
+			softReset:     true,
+			startErr:      incorrectState,
+			resetErr:      MockServiceError{StatusCode: 500, Code: "InternalError"},
+			expectedReset: true,
+			errString:     "error starting instance: " + incorrectState.Error() + ", and soft resetting it: Error returned by Service. Http Status Code: 500. Error Code: InternalError. Message: ",
+		},
+		{
+			name:      "fallback disabled",
+			startErr:  incorrectState,
+			errString: "error starting instance: " + incorrectState.Error(),
+		},
+		{
+			name:      "other start failure",
+			softReset: true,
+			startErr:  MockServiceError{StatusCode: 404, Code: "NotAuthorizedOrNotFound"},
+			errString: "error starting instance: Error returned by Service. Http Status Code: 404. Error Code: NotAuthorizedOrNotFound. Message: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           &config.Config{SoftResetOnFailedStart: tt.softReset},
+			}
+			inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+			mockComputeClient.On("InstanceAction", ctx, core.InstanceActionRequest{
+				InstanceId: &inst,
+				Action:     core.InstanceActionActionStart,
+			}).Return(core.InstanceActionResponse{}, tt.startErr)
+			resetRequest := core.InstanceActionRequest{
+				InstanceId: &inst,
+				Action:     core.InstanceActionActionSoftreset,
+			}
+			mockComputeClient.On("InstanceAction", ctx, resetRequest).Return(core.InstanceActionResponse{}, tt.resetErr)
+
+			err := ociCli.StartInstance(ctx, inst)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+			if tt.expectedReset {
+				mockComputeClient.AssertCalled(t, "InstanceAction", ctx, resetRequest)
+			} else {
+				mockComputeClient.AssertNotCalled(t, "InstanceAction", ctx, resetRequest)
+			}
+		})
+	}
+}
+
 func TestFindInstanceByTags(t *testing.T) {
 	ctx := context.Background()
 	cfg := &config.Config{
@@ -435,3 +2799,305 @@ func TestFindInstanceByTags(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, &expectedInstance, instance)
 }
+
+func TestFindInstanceByTagsNotFound(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances []core.Instance
+	}{
+		{
+			name: "no instances",
+		},
+		{
+			name: "no instance matches",
+			instances: []core.Instance{
+				{
+					Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+					FreeformTags:   map[string]string{"Name": "instance2"},
+					LifecycleState: core.InstanceLifecycleStateRunning,
+				},
+				{
+					Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf8"),
+					FreeformTags:   map[string]string{"Name": "instance1"},
+					LifecycleState: core.InstanceLifecycleStateTerminated,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				CompartmentId: "compartment",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+				CompartmentId: &cfg.CompartmentId,
+			}).Return(core.ListInstancesResponse{
+				Items: tt.instances,
+			}, nil)
+
+			instance, err := ociCli.FindInstanceByTags(ctx, map[string]string{"Name": "instance1"})
+			require.ErrorIs(t, err, garmErrors.ErrNotFound)
+			require.Nil(t, instance)
+
+			_, err = ociCli.GetInstance(ctx, "instance1")
+			require.EqualError(t, err, "instance not found")
+
+			err = ociCli.DeleteInstance(ctx, "instance1")
+			require.NoError(t, err)
+			mockComputeClient.AssertNotCalled(t, "GetInstance", ctx, mock.Anything)
+			mockComputeClient.AssertNotCalled(t, "TerminateInstance", ctx, mock.Anything)
+		})
+	}
+}
+
+func TestFindInstanceByTagsSkipsMismatches(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	tags := map[string]string{
+		"Name":         "instance2",
+		"GARM_POOL_ID": "pool",
+	}
+	expectedInstance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf9"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				FreeformTags:   map[string]string{"Name": "instance1", "GARM_POOL_ID": "pool"},
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf8"),
+				FreeformTags:   map[string]string{"Name": "instance2"},
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+			expectedInstance,
+		},
+	}, nil)
+
+	instance, err := ociCli.FindInstanceByTags(ctx, tags)
+
+	require.NoError(t, err)
+	assert.Equal(t, &expectedInstance, instance)
+}
+
+func TestFindInstanceByTagsPagination(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	tags := map[string]string{
+		"Name": "instance2",
+	}
+	expectedInstance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf8"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{{
+			Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+			FreeformTags:   map[string]string{"Name": "instance1"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+		}},
+		OpcNextPage: common.String("page-2"),
+	}, nil)
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+		Page:          common.String("page-2"),
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{expectedInstance},
+	}, nil)
+
+	instance, err := ociCli.FindInstanceByTags(ctx, tags)
+
+	require.NoError(t, err)
+	assert.Equal(t, &expectedInstance, instance)
+}
+
+func TestGetInstanceWithDuplicateNames(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	tags := map[string]string{
+		"Name": "instance1",
+	}
+	older := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.older"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+		TimeCreated:    &common.SDKTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	newer := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.newer"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+		TimeCreated:    &common.SDKTime{Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{older, newer},
+	}, nil)
+
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: newer.Id,
+	}).Return(core.GetInstanceResponse{
+		Instance: newer,
+	}, nil)
+
+	instance, err := ociCli.GetInstance(ctx, "instance1")
+
+	require.NoError(t, err)
+	assert.Equal(t, "ocid1.instance.oc1.iad.newer", *instance.Id)
+	assert.Contains(t, logs.String(), "level=WARN")
+	assert.Contains(t, logs.String(), "found multiple instances with the same tags")
+}
+
+func TestNameLookupSkipsTerminatedDuplicate(t *testing.T) {
+	tags := map[string]string{
+		"Name": "instance1",
+	}
+	running := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.running"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+		TimeCreated:    &common.SDKTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	// The terminated instance is the most recently created one, it must
+	// still be skipped.
+	terminated := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.terminated"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateTerminated,
+		TimeCreated:    &common.SDKTime{Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	tests := []struct {
+		name   string
+		lookup func(t *testing.T, ctx context.Context, ociCli *OciCli, mockComputeClient *MockComputeClient)
+	}{
+		{
+			name: "get instance",
+			lookup: func(t *testing.T, ctx context.Context, ociCli *OciCli, mockComputeClient *MockComputeClient) {
+				mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+					InstanceId: running.Id,
+				}).Return(core.GetInstanceResponse{
+					Instance: running,
+				}, nil)
+
+				instance, err := ociCli.GetInstance(ctx, "instance1")
+				require.NoError(t, err)
+				assert.Equal(t, *running.Id, *instance.Id)
+			},
+		},
+		{
+			name: "delete instance",
+			lookup: func(t *testing.T, ctx context.Context, ociCli *OciCli, mockComputeClient *MockComputeClient) {
+				mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+					InstanceId:         running.Id,
+					PreserveBootVolume: common.Bool(false),
+				}).Return(core.TerminateInstanceResponse{}, nil)
+
+				err := ociCli.DeleteInstance(ctx, "instance1")
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				CompartmentId: "compartment",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+				CompartmentId: &cfg.CompartmentId,
+			}).Return(core.ListInstancesResponse{
+				Items: []core.Instance{running, terminated},
+			}, nil)
+
+			tt.lookup(t, ctx, ociCli, mockComputeClient)
+			mockComputeClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListDriftedInstances(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{CompartmentId: "compartment"}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	current := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.current"),
+		FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool", "GARM_SPEC_HASH": "current"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	drifted := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.drifted"),
+		FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool", "GARM_SPEC_HASH": "previous"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	untagged := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.untagged"),
+		FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{current, drifted, untagged},
+	}, nil)
+
+	instances, err := ociCli.ListDriftedInstances(ctx, "my-pool", "current")
+
+	require.NoError(t, err)
+	assert.Equal(t, []core.Instance{drifted, untagged}, instances)
+}
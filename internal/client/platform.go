@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"fmt"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// launchPlatformConfig returns the platform config of the launch for the
+// type of platform the shape runs on, or nil if no feature is enabled.
+func launchPlatformConfig(shape core.Shape, platformConfig *spec.PlatformConfig) (core.LaunchInstancePlatformConfig, error) {
+	if !platformConfig.Enabled() {
+		return nil, nil
+	}
+	name := ""
+	if shape.Shape != nil {
+		name = *shape.Shape
+	}
+	if shape.PlatformConfigOptions == nil {
+		return nil, fmt.Errorf("shape %s doesn't support platform_config", name)
+	}
+	secureBoot := common.Bool(platformConfig.SecureBootEnabled)
+	measuredBoot := common.Bool(platformConfig.MeasuredBootEnabled)
+	tpm := common.Bool(platformConfig.IsTrustedPlatformModuleEnabled)
+	switch shape.PlatformConfigOptions.Type {
+	case core.ShapePlatformConfigOptionsTypeAmdVm:
+		return core.AmdVmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelVm:
+		return core.IntelVmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdMilanBm:
+		return core.AmdMilanBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case core.ShapePlatformConfigOptionsTypeAmdRomeBm:
+		return core.AmdRomeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot, IsTrustedPlatformModuleEnabled: tpm}, nil
+	case core.ShapePlatformConfigOptionsTypeIntelSkylakeBm:
+		return core.IntelSkylakeBmLaunchInstancePlatformConfig{IsSecureBootEnabled: secureBoot, IsMeasuredBootEnabled: measuredBoot, IsTrustedPlatformModuleEnabled: tpm}, nil
+	default:
+		return nil, fmt.Errorf("shape %s has unsupported platform type %s", name, shape.PlatformConfigOptions.Type)
+	}
+}
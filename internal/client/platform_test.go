@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaunchPlatformConfig(t *testing.T) {
+	shape := func(platformType core.ShapePlatformConfigOptionsTypeEnum) core.Shape {
+		return core.Shape{
+			Shape:                 common.String("VM.Standard.E4.Flex"),
+			PlatformConfigOptions: &core.ShapePlatformConfigOptions{Type: platformType},
+		}
+	}
+	shielded := &spec.PlatformConfig{
+		SecureBootEnabled:              true,
+		MeasuredBootEnabled:            true,
+		IsTrustedPlatformModuleEnabled: true,
+	}
+	tests := []struct {
+		name           string
+		shape          core.Shape
+		platformConfig *spec.PlatformConfig
+		expected       core.LaunchInstancePlatformConfig
+		errString      string
+	}{
+		{
+			name:           "not set",
+			shape:          shape(core.ShapePlatformConfigOptionsTypeAmdVm),
+			platformConfig: nil,
+			expected:       nil,
+		},
+		{
+			name:           "no feature enabled",
+			shape:          shape(core.ShapePlatformConfigOptionsTypeAmdVm),
+			platformConfig: &spec.PlatformConfig{},
+			expected:       nil,
+		},
+		{
+			name:           "amd vm",
+			shape:          shape(core.ShapePlatformConfigOptionsTypeAmdVm),
+			platformConfig: &spec.PlatformConfig{SecureBootEnabled: true},
+			expected: core.AmdVmLaunchInstancePlatformConfig{
+				IsSecureBootEnabled:            common.Bool(true),
+				IsMeasuredBootEnabled:          common.Bool(false),
+				IsTrustedPlatformModuleEnabled: common.Bool(false),
+			},
+		},
+		{
+			name:           "intel vm",
+			shape:          shape(core.ShapePlatformConfigOptionsTypeIntelVm),
+			platformConfig: shielded,
+			expected: core.IntelVmLaunchInstancePlatformConfig{
+				IsSecureBootEnabled:            common.Bool(true),
+				IsMeasuredBootEnabled:          common.Bool(true),
+				IsTrustedPlatformModuleEnabled: common.Bool(true),
+			},
+		},
+		{
+			name:           "amd milan bare metal",
+			shape:          shape(core.ShapePlatformConfigOptionsTypeAmdMilanBm),
+			platformConfig: &spec.PlatformConfig{IsTrustedPlatformModuleEnabled: true},
+			expected: core.AmdMilanBmLaunchInstancePlatformConfig{
+				IsSecureBootEnabled:            common.Bool(false),
+				IsMeasuredBootEnabled:          common.Bool(false),
+				IsTrustedPlatformModuleEnabled: common.Bool(true),
+			},
+		},
+		{
+			name:           "shape without platform config",
+			shape:          core.Shape{Shape: common.String("VM.Standard2.1")},
+			platformConfig: shielded,
+			errString:      "shape VM.Standard2.1 doesn't support platform_config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			platformConfig, err := launchPlatformConfig(tt.shape, tt.platformConfig)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, platformConfig)
+		})
+	}
+}
+
+func TestCreateInstanceWithPlatformConfig(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           cfg,
+	}
+	spec := spec.RunnerSpec{
+		AvailabilityDomain: "ad",
+		CompartmentID:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		PlatformConfig:     &spec.PlatformConfig{SecureBootEnabled: true},
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			Flavor: "VM.Standard.E4.Flex",
+			Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+			OSType: params.Linux,
+		},
+	}
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{
+			Shape:                 common.String(spec.BootstrapParams.Flavor),
+			PlatformConfigOptions: &core.ShapePlatformConfigOptions{Type: core.ShapePlatformConfigOptionsTypeAmdVm},
+		}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := ociCli.CreateInstance(ctx, &spec)
+	require.NoError(t, err)
+	req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+	require.Equal(t, core.AmdVmLaunchInstancePlatformConfig{
+		IsSecureBootEnabled:            common.Bool(true),
+		IsMeasuredBootEnabled:          common.Bool(false),
+		IsTrustedPlatformModuleEnabled: common.Bool(false),
+	}, req.LaunchInstanceDetails.PlatformConfig)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// terminationProtectedTag marks instances the provider refuses to terminate.
+// OCI has no native termination protection for instances.
+const terminationProtectedTag = "GARM_TERMINATION_PROTECTED"
+
+// ErrTerminationProtected is returned when deleting an instance that has
+// termination protection enabled.
+var ErrTerminationProtected = errors.New("instance is protected from termination")
+
+func isTerminationProtected(instance core.Instance) bool {
+	return instance.FreeformTags[terminationProtectedTag] == "true"
+}
+
+// SetTerminationProtection enables or disables the termination protection of
+// the instance by setting or clearing its GARM_TERMINATION_PROTECTED tag.
+func (o *OciCli) SetTerminationProtection(ctx context.Context, instanceID string, protected bool) error {
+	instance, err := o.GetInstance(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	tags := make(map[string]string, len(instance.FreeformTags)+1)
+	for key, value := range instance.FreeformTags {
+		tags[key] = value
+	}
+	if protected {
+		tags[terminationProtectedTag] = "true"
+	} else {
+		delete(tags, terminationProtectedTag)
+	}
+	_, err = o.forInstance(*instance.Id).computeClient.UpdateInstance(ctx, core.UpdateInstanceRequest{
+		InstanceId: instance.Id,
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			FreeformTags: tags,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating instance tags: %w", err)
+	}
+	return nil
+}
+
+// checkTerminationProtection returns ErrTerminationProtected if the instance
+// with the given OCID must not be terminated, and otherwise the instance. An
+// instance that no longer exists is not protected, and nil is returned for it.
+func (o *OciCli) checkTerminationProtection(ctx context.Context, instanceID string) (*core.Instance, error) {
+	resp, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+		InstanceId: &instanceID,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error checking termination protection: %w", err)
+	}
+	if isTerminationProtected(resp.Instance) {
+		return nil, fmt.Errorf("%w: %s", ErrTerminationProtected, instanceID)
+	}
+	return &resp.Instance, nil
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetTerminationProtection(t *testing.T) {
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	tests := []struct {
+		name      string
+		tags      map[string]string
+		protected bool
+		expected  map[string]string
+	}{
+		{
+			name:      "enable protection",
+			tags:      map[string]string{"Name": "garm-instance"},
+			protected: true,
+			expected:  map[string]string{"Name": "garm-instance", "GARM_TERMINATION_PROTECTED": "true"},
+		},
+		{
+			name:      "clear protection",
+			tags:      map[string]string{"Name": "garm-instance", "GARM_TERMINATION_PROTECTED": "true"},
+			protected: false,
+			expected:  map[string]string{"Name": "garm-instance"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           &config.Config{CompartmentId: "compartment"},
+			}
+			mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: common.String(inst),
+			}).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: common.String(inst), FreeformTags: tt.tags},
+			}, nil)
+			mockComputeClient.On("UpdateInstance", ctx, core.UpdateInstanceRequest{
+				InstanceId: common.String(inst),
+				UpdateInstanceDetails: core.UpdateInstanceDetails{
+					FreeformTags: tt.expected,
+				},
+			}).Return(core.UpdateInstanceResponse{}, nil)
+
+			err := ociCli.SetTerminationProtection(ctx, inst, tt.protected)
+
+			require.NoError(t, err)
+			mockComputeClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteInstanceTerminationProtected(t *testing.T) {
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	protectedTags := map[string]string{"Name": "garm-instance", "GARM_TERMINATION_PROTECTED": "true"}
+	tests := []struct {
+		name       string
+		instanceID string
+	}{
+		{
+			name:       "by id",
+			instanceID: inst,
+		},
+		{
+			name:       "by name",
+			instanceID: "garm-instance",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{CompartmentId: "compartment"}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+			}
+			mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: common.String(inst),
+			}).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: common.String(inst), FreeformTags: protectedTags},
+			}, nil)
+			mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+				CompartmentId: &cfg.CompartmentId,
+			}).Return(core.ListInstancesResponse{
+				Items: []core.Instance{{
+					Id:             common.String(inst),
+					FreeformTags:   protectedTags,
+					LifecycleState: core.InstanceLifecycleStateRunning,
+				}},
+			}, nil)
+
+			err := ociCli.DeleteInstance(ctx, tt.instanceID)
+
+			require.ErrorIs(t, err, ErrTerminationProtected)
+			mockComputeClient.AssertNotCalled(t, "TerminateInstance", ctx, mock.Anything)
+		})
+	}
+}
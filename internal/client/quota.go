@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v49/common"
+)
+
+// quotaErrorCodes are the OCI error codes returned when a launch is rejected
+// because a quota, a service limit or the request rate is exhausted.
+var quotaErrorCodes = map[string]bool{
+	"LimitExceeded":   true,
+	"QuotaExceeded":   true,
+	"TooManyRequests": true,
+}
+
+// QuotaError is returned when OCI rejects a launch because of a quota or
+// limit. RetryAfter is the backoff suggested by OCI in the Retry-After
+// header, or 0 if it suggested none.
+type QuotaError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *QuotaError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("quota exceeded, retry after %s: %s", e.RetryAfter, e.Err)
+	}
+	return fmt.Sprintf("quota exceeded: %s", e.Err)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+// asQuotaError returns a QuotaError wrapping err if it is a quota related
+// service error, or err unchanged otherwise. The raw response of the failed
+// call carries the Retry-After header.
+func asQuotaError(resp *http.Response, err error, now time.Time) error {
+	var svcErr common.ServiceError
+	if !errors.As(err, &svcErr) {
+		return err
+	}
+	if svcErr.GetHTTPStatusCode() != http.StatusTooManyRequests && !quotaErrorCodes[svcErr.GetCode()] {
+		return err
+	}
+	quotaErr := &QuotaError{Err: err}
+	if resp != nil {
+		quotaErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+	return quotaErr
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as
+// an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now).Round(time.Second)
+	}
+	return 0
+}
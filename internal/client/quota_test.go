@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstanceQuotaError(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name               string
+		launchErr          error
+		retryAfter         string
+		isQuotaErr         bool
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name:               "too many requests with seconds",
+			launchErr:          MockServiceError{StatusCode: 429, Code: "TooManyRequests"},
+			retryAfter:         "120",
+			isQuotaErr:         true,
+			expectedRetryAfter: 2 * time.Minute,
+		},
+		{
+			name:               "limit exceeded with date",
+			launchErr:          MockServiceError{StatusCode: 400, Code: "LimitExceeded"},
+			retryAfter:         now.Add(15 * time.Minute).Format(http.TimeFormat),
+			isQuotaErr:         true,
+			expectedRetryAfter: 15 * time.Minute,
+		},
+		{
+			name:       "quota exceeded without guidance",
+			launchErr:  MockServiceError{StatusCode: 400, Code: "QuotaExceeded"},
+			isQuotaErr: true,
+		},
+		{
+			name:      "other service error",
+			launchErr: MockServiceError{StatusCode: 500, Code: "InternalServerError"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+			}
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           cfg,
+				now:           func() time.Time { return now },
+			}
+			spec := spec.RunnerSpec{
+				AvailabilityDomain: "ad",
+				CompartmentID:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				BootstrapParams: params.BootstrapInstance{
+					Name:   "garm-instance",
+					Flavor: "VM.Standard.E4.Flex",
+					Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
+					OSType: params.Linux,
+				},
+			}
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(spec.BootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				RawResponse: &http.Response{StatusCode: tt.launchErr.(MockServiceError).StatusCode, Header: header},
+			}, tt.launchErr)
+
+			_, err := ociCli.CreateInstance(ctx, &spec)
+
+			require.ErrorIs(t, err, tt.launchErr)
+			var quotaErr *QuotaError
+			require.Equal(t, tt.isQuotaErr, errors.As(err, &quotaErr))
+			if tt.isQuotaErr {
+				require.Equal(t, tt.expectedRetryAfter, quotaErr.RetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+)
+
+// ErrRateLimited is returned when an OCI API call is over the rate limit and
+// fails fast, or can't get a token before the deadline of its context.
+var ErrRateLimited = errors.New("rate limit of OCI API calls exceeded")
+
+// rateLimiter is a token bucket shared by every OCI API call of the
+// provider. A nil rateLimiter doesn't limit calls.
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	failFast bool
+
+	// now and after are the clock of the limiter, replaced in tests.
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// newRateLimiter returns the limiter of the rate limit config, or nil if
+// calls are not rate limited.
+func newRateLimiter(cfg config.RateLimit) *rateLimiter {
+	if !cfg.Enabled() {
+		return nil
+	}
+	burst := float64(cfg.BurstSize())
+	return &rateLimiter{
+		rate:     cfg.RequestsPerSecond,
+		burst:    burst,
+		tokens:   burst,
+		last:     time.Now(),
+		failFast: cfg.FailFast,
+		now:      time.Now,
+		after:    time.After,
+	}
+}
+
+// wait takes a token from the bucket, waiting for one if the bucket is
+// empty, unless the limiter fails fast. It gives up, handing the token
+// back, if the context is done first.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	now := l.now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if l.failFast {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+	// The token is reserved right away, so concurrent calls queue up behind
+	// each other instead of all waking up for the same token.
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < delay {
+		l.mu.Unlock()
+		return fmt.Errorf("%w: no token before the deadline of the call", ErrRateLimited)
+	}
+	l.tokens--
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens = min(l.burst, l.tokens+1)
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-l.after(delay):
+		return nil
+	}
+}
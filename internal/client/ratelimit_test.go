@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock moves forward only when the limiter waits on it.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func newFakeClockLimiter(cfg config.RateLimit) (*rateLimiter, *fakeClock) {
+	// Deadlines of contexts are checked against the real clock, so the fake
+	// one starts now.
+	clock := &fakeClock{now: time.Now()}
+	limiter := newRateLimiter(cfg)
+	limiter.last = clock.now
+	limiter.now = func() time.Time { return clock.now }
+	limiter.after = clock.after
+	return limiter, clock
+}
+
+func TestNewRateLimiterDisabled(t *testing.T) {
+	limiter := newRateLimiter(config.RateLimit{})
+	require.Nil(t, limiter)
+	require.NoError(t, limiter.wait(context.Background()))
+}
+
+func TestRateLimiterThrottlesCalls(t *testing.T) {
+	limiter, clock := newFakeClockLimiter(config.RateLimit{RequestsPerSecond: 2, Burst: 2})
+	mockComputeClient := new(MockComputeClient)
+	computeClient := withComputeTimeout(mockComputeClient, time.Minute, limiter)
+	mockComputeClient.On("ListInstances", mock.Anything, mock.Anything).Return(core.ListInstancesResponse{}, nil)
+	start := clock.now
+
+	for i := 0; i < 6; i++ {
+		_, err := computeClient.ListInstances(context.Background(), core.ListInstancesRequest{})
+		require.NoError(t, err)
+	}
+
+	// The burst goes through right away, the remaining calls every 500ms.
+	assert.Equal(t, []time.Duration{
+		500 * time.Millisecond,
+		500 * time.Millisecond,
+		500 * time.Millisecond,
+		500 * time.Millisecond,
+	}, clock.waits)
+	assert.Equal(t, 2*time.Second, clock.now.Sub(start))
+	mockComputeClient.AssertNumberOfCalls(t, "ListInstances", 6)
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter, clock := newFakeClockLimiter(config.RateLimit{RequestsPerSecond: 1, Burst: 3})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.wait(context.Background()))
+	}
+	// Idle time refills the bucket, up to the burst.
+	clock.now = clock.now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.wait(context.Background()))
+	}
+	assert.Empty(t, clock.waits)
+	require.NoError(t, limiter.wait(context.Background()))
+	assert.Equal(t, []time.Duration{time.Second}, clock.waits)
+}
+
+func TestRateLimiterFailFast(t *testing.T) {
+	limiter, clock := newFakeClockLimiter(config.RateLimit{RequestsPerSecond: 1, Burst: 1, FailFast: true})
+	mockNetworkClient := new(MockNetworkClient)
+	networkClient := withNetworkTimeout(mockNetworkClient, time.Minute, limiter)
+	mockNetworkClient.On("GetSubnet", mock.Anything, mock.Anything).Return(core.GetSubnetResponse{}, nil)
+
+	_, err := networkClient.GetSubnet(context.Background(), core.GetSubnetRequest{})
+	require.NoError(t, err)
+	_, err = networkClient.GetSubnet(context.Background(), core.GetSubnetRequest{})
+	require.ErrorIs(t, err, ErrRateLimited)
+	assert.Empty(t, clock.waits)
+	mockNetworkClient.AssertNumberOfCalls(t, "GetSubnet", 1)
+}
+
+func TestRateLimiterRespectsContext(t *testing.T) {
+	limiter, clock := newFakeClockLimiter(config.RateLimit{RequestsPerSecond: 1, Burst: 1})
+	require.NoError(t, limiter.wait(context.Background()))
+
+	// A deadline that passes before the next token fails right away.
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(100*time.Millisecond))
+	defer cancel()
+	require.ErrorIs(t, limiter.wait(ctx), ErrRateLimited)
+
+	// A canceled call hands its reserved token back.
+	blocked := make(chan time.Time)
+	limiter.after = func(time.Duration) <-chan time.Time { return blocked }
+	ctx, cancel = context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- limiter.wait(ctx) }()
+	require.Eventually(t, func() bool {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		return limiter.tokens < 0
+	}, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	assert.Equal(t, float64(0), limiter.tokens)
+}
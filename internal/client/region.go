@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// maxRegionConcurrency bounds the number of regions queried at the same time.
+const maxRegionConcurrency = 4
+
+type regionClient struct {
+	region             string
+	client             ClientInterface
+	networkClient      NetworkClientInterface
+	blockstorageClient BlockstorageClientInterface
+}
+
+// regionClient returns the clients of the additional region, adding the
+// region if it is not known yet.
+func (o *OciCli) regionClient(region string) *regionClient {
+	for i, rc := range o.regionClients {
+		if rc.region == region {
+			return &o.regionClients[i]
+		}
+	}
+	o.regionClients = append(o.regionClients, regionClient{region: region})
+	return &o.regionClients[len(o.regionClients)-1]
+}
+
+// SetRegionComputeClient sets the compute client used for one of the
+// additional regions instances are listed in.
+func (o *OciCli) SetRegionComputeClient(region string, computeClient ClientInterface) {
+	o.regionClient(region).client = computeClient
+}
+
+// SetRegionNetworkClient sets the network client used for the instances of
+// one of the additional regions.
+func (o *OciCli) SetRegionNetworkClient(region string, networkClient NetworkClientInterface) {
+	o.regionClient(region).networkClient = networkClient
+}
+
+// SetRegionBlockstorageClient sets the blockstorage client used for the
+// instances of one of the additional regions.
+func (o *OciCli) SetRegionBlockstorageClient(region string, blockstorageClient BlockstorageClientInterface) {
+	o.regionClient(region).blockstorageClient = blockstorageClient
+}
+
+// forInstance returns the client to manage the instance with the given OCID
+// with. Instances of an additional region, the region of their OCID, are
+// managed with the clients of that region, all others with o.
+func (o *OciCli) forInstance(instanceID string) *OciCli {
+	region := ocidRegion(instanceID)
+	if region == "" {
+		return o
+	}
+	for _, rc := range o.regionClients {
+		if common.StringToRegion(rc.region) != region {
+			continue
+		}
+		return &OciCli{
+			cfg:                o.cfg,
+			controllerID:       o.controllerID,
+			computeClient:      rc.client,
+			identityClient:     o.identityClient,
+			networkClient:      rc.networkClient,
+			blockstorageClient: rc.blockstorageClient,
+			now:                o.now,
+		}
+	}
+	return o
+}
+
+// ocidRegion returns the region of a regional OCID, of the form
+// ocid1.<type>.<realm>.<region>.<id>, where the region is either its name
+// or its short code. It is empty for other OCIDs.
+func ocidRegion(ocid string) common.Region {
+	parts := strings.Split(ocid, ".")
+	if len(parts) < 5 || parts[0] != "ocid1" || parts[3] == "" {
+		return ""
+	}
+	return common.StringToRegion(parts[3])
+}
+
+// listInstancesInRegions lists the instances of the pool in the configured
+// region and in all additional regions concurrently. The instances of the
+// regions that could be listed are returned along with an error for each
+// region that could not.
+func (o *OciCli) listInstancesInRegions(ctx context.Context, poolID string) ([]core.Instance, error) {
+	return o.listInRegions(ctx, func(ctx context.Context, computeClient ClientInterface) ([]core.Instance, error) {
+		return o.listPoolInstances(ctx, computeClient, poolID)
+	})
+}
+
+// listAllInstances returns all instances in the compartment, in the
+// configured region and in all additional regions.
+func (o *OciCli) listAllInstances(ctx context.Context) ([]core.Instance, error) {
+	if len(o.regionClients) > 0 {
+		return o.listInRegions(ctx, o.listCompartmentInstances)
+	}
+	return o.listCompartmentInstances(ctx, o.computeClient)
+}
+
+// listInRegions lists instances with list in the configured region and in
+// all additional regions concurrently. The instances of the regions that
+// could be listed are returned along with an error for each region that
+// could not.
+func (o *OciCli) listInRegions(ctx context.Context, list func(context.Context, ClientInterface) ([]core.Instance, error)) ([]core.Instance, error) {
+	clients := append([]regionClient{{region: o.cfg.Region, client: o.computeClient}}, o.regionClients...)
+	results := make([][]core.Instance, len(clients))
+	errs := make([]error, len(clients))
+
+	sem := make(chan struct{}, maxRegionConcurrency)
+	var wg sync.WaitGroup
+	for i, rc := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("region %s: %w", rc.region, ctx.Err())
+				return
+			}
+			instances, err := list(ctx, rc.client)
+			if err != nil {
+				errs[i] = fmt.Errorf("region %s: %w", rc.region, err)
+				return
+			}
+			results[i] = instances
+		}()
+	}
+	wg.Wait()
+
+	instances := []core.Instance{}
+	for _, result := range results {
+		instances = append(instances, result...)
+	}
+	return instances, errors.Join(errs...)
+}
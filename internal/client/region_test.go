@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListInstancesInRegions(t *testing.T) {
+	poolID := "pool"
+	tags := map[string]string{"GARM_POOL_ID": poolID}
+	primaryInstance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	regionInstance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.phx.aaaaaaaamf8"),
+		FreeformTags:   tags,
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	tests := []struct {
+		name              string
+		regionErr         error
+		expectedInstances []core.Instance
+		errString         string
+	}{
+		{
+			name:              "results are merged",
+			expectedInstances: []core.Instance{primaryInstance, regionInstance},
+		},
+		{
+			name:              "region error keeps the other region's results",
+			regionErr:         fmt.Errorf("service unavailable"),
+			expectedInstances: []core.Instance{primaryInstance},
+			errString:         "region us-phoenix-1: error listing instances: service unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				CompartmentId:     "compartment",
+				Region:            "us-ashburn-1",
+				AdditionalRegions: []string{"us-phoenix-1"},
+			}
+			primaryClient := new(MockComputeClient)
+			regionClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: primaryClient,
+				cfg:           cfg,
+			}
+			ociCli.SetRegionComputeClient("us-phoenix-1", regionClient)
+			primaryClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{
+				Items: []core.Instance{primaryInstance},
+			}, nil)
+			regionClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{
+				Items: []core.Instance{regionInstance},
+			}, tt.regionErr)
+
+			instances, err := ociCli.ListInstances(ctx, poolID)
+
+			require.Equal(t, tt.expectedInstances, instances)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestListInstancesInRegionsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ociCli := &OciCli{
+		computeClient: new(MockComputeClient),
+		cfg:           &config.Config{CompartmentId: "compartment", Region: "us-ashburn-1"},
+	}
+	regionClients := make([]*MockComputeClient, maxRegionConcurrency+1)
+	for i := range regionClients {
+		regionClients[i] = new(MockComputeClient)
+		regionClients[i].On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{}, context.Canceled).Maybe()
+		ociCli.SetRegionComputeClient(fmt.Sprintf("region-%d", i), regionClients[i])
+	}
+	ociCli.computeClient.(*MockComputeClient).On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{}, context.Canceled).Maybe()
+
+	instances, err := ociCli.ListInstances(ctx, "pool")
+
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, instances)
+}
+
+func TestOcidRegion(t *testing.T) {
+	tests := []struct {
+		ocid     string
+		expected common.Region
+	}{
+		{ocid: "ocid1.instance.oc1.phx.aaaaaaaamf8", expected: common.RegionPHX},
+		{ocid: "ocid1.instance.oc1.us-ashburn-1.aaaaaaaamf7", expected: common.RegionIAD},
+		{ocid: "ocid1.compartment.oc1..aaaaaaaamf7", expected: ""},
+		{ocid: "garm-instance", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ocid, func(t *testing.T) {
+			require.Equal(t, tt.expected, ocidRegion(tt.ocid))
+		})
+	}
+}
+
+func TestDeleteInstanceInAdditionalRegion(t *testing.T) {
+	inst := "ocid1.instance.oc1.phx.aaaaaaaamf8"
+	regionInstance := core.Instance{
+		Id:             common.String(inst),
+		FreeformTags:   map[string]string{"Name": "garm-instance", "GARM_POOL_ID": "pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	tests := []struct {
+		name       string
+		instanceID string
+	}{
+		{name: "by OCID", instanceID: inst},
+		{name: "by name", instanceID: "garm-instance"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := &config.Config{
+				CompartmentId:     "compartment",
+				Region:            "us-ashburn-1",
+				AdditionalRegions: []string{"us-phoenix-1"},
+			}
+			primaryClient := new(MockComputeClient)
+			regionClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: primaryClient,
+				cfg:           cfg,
+			}
+			ociCli.SetRegionComputeClient("us-phoenix-1", regionClient)
+			// Only the lookup by name lists the instances.
+			primaryClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{}, nil).Maybe()
+			regionClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{
+				Items: []core.Instance{regionInstance},
+			}, nil).Maybe()
+			regionClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: common.String(inst),
+			}).Return(core.GetInstanceResponse{Instance: regionInstance}, nil).Maybe()
+			regionClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+				InstanceId:         common.String(inst),
+				PreserveBootVolume: common.Bool(false),
+			}).Return(core.TerminateInstanceResponse{}, nil)
+
+			err := ociCli.DeleteInstance(ctx, tt.instanceID)
+
+			require.NoError(t, err)
+			regionClient.AssertExpectations(t)
+			primaryClient.AssertNotCalled(t, "GetInstance", mock.Anything, mock.Anything)
+			primaryClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestGetInstanceInAdditionalRegion(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		CompartmentId:     "compartment",
+		Region:            "us-ashburn-1",
+		AdditionalRegions: []string{"us-phoenix-1"},
+	}
+	primaryClient := new(MockComputeClient)
+	regionClient := new(MockComputeClient)
+	primaryNetworkClient := new(MockNetworkClient)
+	regionNetworkClient := new(MockNetworkClient)
+	ociCli := &OciCli{
+		computeClient: primaryClient,
+		networkClient: primaryNetworkClient,
+		cfg:           cfg,
+	}
+	ociCli.SetRegionComputeClient("us-phoenix-1", regionClient)
+	ociCli.SetRegionNetworkClient("us-phoenix-1", regionNetworkClient)
+	instance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.phx.aaaaaaaamf8"),
+		CompartmentId:  common.String("compartment"),
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	regionClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: instance.Id,
+	}).Return(core.GetInstanceResponse{Instance: instance}, nil)
+	regionClient.On("ListVnicAttachments", ctx, mock.Anything).Return(core.ListVnicAttachmentsResponse{
+		Items: []core.VnicAttachment{{
+			LifecycleState: core.VnicAttachmentLifecycleStateAttached,
+			VnicId:         common.String("ocid1.vnic.oc1.phx.aaaa"),
+		}},
+	}, nil)
+	regionNetworkClient.On("GetVnic", ctx, mock.Anything).Return(core.GetVnicResponse{
+		Vnic: core.Vnic{IsPrimary: common.Bool(true), PrivateIp: common.String("10.0.0.2")},
+	}, nil)
+
+	result, err := ociCli.GetInstance(ctx, *instance.Id)
+	require.NoError(t, err)
+	addresses, err := ociCli.InstanceAddresses(ctx, result)
+	require.NoError(t, err)
+
+	require.Len(t, addresses, 1)
+	require.Equal(t, "10.0.0.2", addresses[0].Address)
+	primaryClient.AssertNotCalled(t, "GetInstance", mock.Anything, mock.Anything)
+	primaryNetworkClient.AssertNotCalled(t, "GetVnic", mock.Anything, mock.Anything)
+}
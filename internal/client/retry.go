@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// retryingComputeClient retries the instance calls of the wrapped compute
+// client that fail with a transient error, as set by the retry policy.
+type retryingComputeClient struct {
+	ClientInterface
+	policy config.RetryPolicy
+}
+
+// withRetries wraps the compute client so its instance calls are retried, if
+// the retry policy allows more than one attempt.
+func withRetries(computeClient ClientInterface, policy config.RetryPolicy) ClientInterface {
+	if policy.MaxAttempts <= 1 {
+		return computeClient
+	}
+	return &retryingComputeClient{
+		ClientInterface: computeClient,
+		policy:          policy,
+	}
+}
+
+func (r *retryingComputeClient) LaunchInstance(ctx context.Context, request core.LaunchInstanceRequest) (core.LaunchInstanceResponse, error) {
+	// The retry token makes OCI launch a single instance, however many times
+	// the request is sent.
+	if request.OpcRetryToken == nil {
+		request.OpcRetryToken = common.String(common.RetryToken())
+	}
+	return retry(ctx, r.policy, "LaunchInstance", func() (core.LaunchInstanceResponse, error) {
+		return r.ClientInterface.LaunchInstance(ctx, request)
+	})
+}
+
+func (r *retryingComputeClient) GetInstance(ctx context.Context, request core.GetInstanceRequest) (core.GetInstanceResponse, error) {
+	return retry(ctx, r.policy, "GetInstance", func() (core.GetInstanceResponse, error) {
+		return r.ClientInterface.GetInstance(ctx, request)
+	})
+}
+
+func (r *retryingComputeClient) TerminateInstance(ctx context.Context, request core.TerminateInstanceRequest) (core.TerminateInstanceResponse, error) {
+	return retry(ctx, r.policy, "TerminateInstance", func() (core.TerminateInstanceResponse, error) {
+		return r.ClientInterface.TerminateInstance(ctx, request)
+	})
+}
+
+func (r *retryingComputeClient) ListInstances(ctx context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error) {
+	return retry(ctx, r.policy, "ListInstances", func() (core.ListInstancesResponse, error) {
+		return r.ClientInterface.ListInstances(ctx, request)
+	})
+}
+
+func (r *retryingComputeClient) InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error) {
+	if request.OpcRetryToken == nil {
+		request.OpcRetryToken = common.String(common.RetryToken())
+	}
+	return retry(ctx, r.policy, "InstanceAction", func() (core.InstanceActionResponse, error) {
+		return r.ClientInterface.InstanceAction(ctx, request)
+	})
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// retryable or the attempts of the policy are exhausted. It gives up early,
+// returning the last error, if the context is done or its deadline would
+// pass before the next attempt.
+func retry[T any](ctx context.Context, policy config.RetryPolicy, operation string, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		response, err := fn()
+		if err == nil || !isRetryable(err) || attempt >= policy.MaxAttempts {
+			return response, err
+		}
+		delay := retryDelay(policy, attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return response, err
+		}
+		slog.DebugContext(ctx, "retrying OCI API call", "operation", operation, "attempt", attempt, "delay", delay, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryDelay returns the delay before the attempt following the given one:
+// the base delay doubled for every previous retry and capped at the max
+// delay, of which up to half is skipped at random so clients spread out.
+func retryDelay(policy config.RetryPolicy, attempt int) time.Duration {
+	maxDelay := policy.MaxDelayDuration()
+	delay := policy.BaseDelayDuration()
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// isRetryable reports whether the error is a transient OCI service error:
+// too many requests or a server side failure.
+func isRetryable(err error) bool {
+	var svcErr common.ServiceError
+	if !errors.As(err, &svcErr) {
+		return false
+	}
+	status := svcErr.GetHTTPStatusCode()
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = config.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   "1ms",
+	MaxDelay:    "5ms",
+}
+
+func TestRetryingComputeClient(t *testing.T) {
+	tooManyRequests := MockServiceError{StatusCode: 429, Code: "TooManyRequests"}
+	tests := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		errString     string
+	}{
+		{
+			name:          "succeeds after two throttled attempts",
+			errs:          []error{tooManyRequests, MockServiceError{StatusCode: 503, Code: "ServiceUnavailable"}, nil},
+			expectedCalls: 3,
+		},
+		{
+			name:          "attempts exhausted",
+			errs:          []error{tooManyRequests, tooManyRequests, tooManyRequests},
+			expectedCalls: 3,
+			errString:     tooManyRequests.Error(),
+		},
+		{
+			name:          "error is not retryable",
+			errs:          []error{MockServiceError{StatusCode: 404, Code: "NotAuthorizedOrNotFound"}},
+			expectedCalls: 1,
+			errString:     "Error returned by Service. Http Status Code: 404. Error Code: NotAuthorizedOrNotFound. Message: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(MockComputeClient)
+			computeClient := withRetries(mockComputeClient, testRetryPolicy)
+			request := core.GetInstanceRequest{InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")}
+			for _, err := range tt.errs {
+				mockComputeClient.On("GetInstance", ctx, request).Return(core.GetInstanceResponse{}, err).Once()
+			}
+
+			_, err := computeClient.GetInstance(ctx, request)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+			mockComputeClient.AssertNumberOfCalls(t, "GetInstance", tt.expectedCalls)
+		})
+	}
+}
+
+func TestRetryingComputeClientLaunchInstance(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(MockComputeClient)
+	computeClient := withRetries(mockComputeClient, testRetryPolicy)
+	tooManyRequests := MockServiceError{StatusCode: 429, Code: "TooManyRequests"}
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{}, tooManyRequests).Twice()
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil).Once()
+
+	response, err := computeClient.LaunchInstance(ctx, core.LaunchInstanceRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "ocid1.instance.oc1.iad.aaaaaaaamf7", *response.Instance.Id)
+	mockComputeClient.AssertNumberOfCalls(t, "LaunchInstance", 3)
+
+	// All attempts carry the same retry token, so OCI launches one instance.
+	token := mockComputeClient.Calls[0].Arguments.Get(1).(core.LaunchInstanceRequest).OpcRetryToken
+	require.NotNil(t, token)
+	for _, call := range mockComputeClient.Calls {
+		require.Equal(t, token, call.Arguments.Get(1).(core.LaunchInstanceRequest).OpcRetryToken)
+	}
+}
+
+func TestRetryingComputeClientHonorsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	mockComputeClient := new(MockComputeClient)
+	computeClient := withRetries(mockComputeClient, config.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   "1m",
+		MaxDelay:    "1m",
+	})
+	tooManyRequests := MockServiceError{StatusCode: 429, Code: "TooManyRequests"}
+	mockComputeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{}, tooManyRequests)
+
+	start := time.Now()
+	_, err := computeClient.ListInstances(ctx, core.ListInstancesRequest{})
+	require.ErrorIs(t, err, tooManyRequests)
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+	mockComputeClient.AssertNumberOfCalls(t, "ListInstances", 1)
+}
+
+func TestWithRetriesDisabled(t *testing.T) {
+	mockComputeClient := new(MockComputeClient)
+	require.Same(t, mockComputeClient, withRetries(mockComputeClient, config.RetryPolicy{}))
+	require.Same(t, mockComputeClient, withRetries(mockComputeClient, config.RetryPolicy{MaxAttempts: 1}))
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := config.RetryPolicy{BaseDelay: "100ms", MaxDelay: "1s"}
+	for attempt, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		delay := retryDelay(policy, attempt)
+		require.GreaterOrEqual(t, delay, expected/2)
+		require.LessOrEqual(t, delay, expected)
+	}
+}
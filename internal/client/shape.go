@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// fitShapeConfig checks the requested OCPUs and memory against a flexible
+// shape, which only accepts whole OCPUs and whole GBs of memory within the
+// bounds of the shape. When round is set, invalid values are snapped to the
+// nearest valid ones instead of being rejected. Fixed shapes are left alone.
+func fitShapeConfig(shape core.Shape, ocpus, memoryInGBs float32, round bool) (float32, float32, error) {
+	if shape.OcpuOptions == nil {
+		return ocpus, memoryInGBs, nil
+	}
+	name := ""
+	if shape.Shape != nil {
+		name = *shape.Shape
+	}
+
+	ocpuMin, ocpuMax := shape.OcpuOptions.Min, shape.OcpuOptions.Max
+	var memoryMin, memoryMax *float32
+	if shape.MemoryOptions != nil {
+		memoryMin, memoryMax = shape.MemoryOptions.MinInGBs, shape.MemoryOptions.MaxInGBs
+	}
+
+	if round {
+		return clamp(float32(math.Round(float64(ocpus))), ocpuMin, ocpuMax),
+			clamp(float32(math.Round(float64(memoryInGBs))), memoryMin, memoryMax), nil
+	}
+
+	if ocpus != float32(math.Trunc(float64(ocpus))) {
+		return 0, 0, fmt.Errorf("shape %s only accepts a whole number of OCPUs, got %g", name, ocpus)
+	}
+	if memoryInGBs != float32(math.Trunc(float64(memoryInGBs))) {
+		return 0, 0, fmt.Errorf("shape %s only accepts memory in 1 GB increments, got %g", name, memoryInGBs)
+	}
+	if !within(ocpus, ocpuMin, ocpuMax) {
+		return 0, 0, fmt.Errorf("shape %s accepts between %s OCPUs, got %g", name, bounds(ocpuMin, ocpuMax), ocpus)
+	}
+	if !within(memoryInGBs, memoryMin, memoryMax) {
+		return 0, 0, fmt.Errorf("shape %s accepts between %s GB of memory, got %g", name, bounds(memoryMin, memoryMax), memoryInGBs)
+	}
+	return ocpus, memoryInGBs, nil
+}
+
+func clamp(value float32, minValue, maxValue *float32) float32 {
+	if minValue != nil && value < *minValue {
+		value = float32(math.Ceil(float64(*minValue)))
+	}
+	if maxValue != nil && value > *maxValue {
+		value = float32(math.Floor(float64(*maxValue)))
+	}
+	return value
+}
+
+func within(value float32, minValue, maxValue *float32) bool {
+	return (minValue == nil || value >= *minValue) && (maxValue == nil || value <= *maxValue)
+}
+
+func bounds(minValue, maxValue *float32) string {
+	lower, upper := "0", "unlimited"
+	if minValue != nil {
+		lower = fmt.Sprintf("%g", *minValue)
+	}
+	if maxValue != nil {
+		upper = fmt.Sprintf("%g", *maxValue)
+	}
+	return lower + " and " + upper
+}
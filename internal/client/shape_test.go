@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitShapeConfig(t *testing.T) {
+	flex := core.Shape{
+		Shape: common.String("VM.Standard.E4.Flex"),
+		OcpuOptions: &core.ShapeOcpuOptions{
+			Min: common.Float32(1),
+			Max: common.Float32(64),
+		},
+		MemoryOptions: &core.ShapeMemoryOptions{
+			MinInGBs: common.Float32(1),
+			MaxInGBs: common.Float32(1024),
+		},
+	}
+	tests := []struct {
+		name           string
+		shape          core.Shape
+		ocpus          float32
+		memoryInGBs    float32
+		round          bool
+		expectedOcpus  float32
+		expectedMemory float32
+		errString      string
+	}{
+		{
+			name:           "valid values",
+			shape:          flex,
+			ocpus:          2,
+			memoryInGBs:    16,
+			expectedOcpus:  2,
+			expectedMemory: 16,
+		},
+		{
+			name:           "fixed shape is left alone",
+			shape:          core.Shape{Shape: common.String("VM.Standard2.1")},
+			ocpus:          2.5,
+			memoryInGBs:    7.5,
+			expectedOcpus:  2.5,
+			expectedMemory: 7.5,
+		},
+		{
+			name:           "fractional values are rounded",
+			shape:          flex,
+			ocpus:          2.5,
+			memoryInGBs:    7.4,
+			round:          true,
+			expectedOcpus:  3,
+			expectedMemory: 7,
+		},
+		{
+			name:           "out of bounds values are clamped",
+			shape:          flex,
+			ocpus:          0.2,
+			memoryInGBs:    2048,
+			round:          true,
+			expectedOcpus:  1,
+			expectedMemory: 1024,
+		},
+		{
+			name:        "fractional ocpus are rejected",
+			shape:       flex,
+			ocpus:       2.5,
+			memoryInGBs: 16,
+			errString:   "shape VM.Standard.E4.Flex only accepts a whole number of OCPUs, got 2.5",
+		},
+		{
+			name:        "fractional memory is rejected",
+			shape:       flex,
+			ocpus:       2,
+			memoryInGBs: 7.5,
+			errString:   "shape VM.Standard.E4.Flex only accepts memory in 1 GB increments, got 7.5",
+		},
+		{
+			name:        "too many ocpus are rejected",
+			shape:       flex,
+			ocpus:       128,
+			memoryInGBs: 16,
+			errString:   "shape VM.Standard.E4.Flex accepts between 1 and 64 OCPUs, got 128",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ocpus, memoryInGBs, err := fitShapeConfig(tt.shape, tt.ocpus, tt.memoryInGBs, tt.round)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedOcpus, ocpus)
+			require.Equal(t, tt.expectedMemory, memoryInGBs)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// ListStaleInstances returns the instances of the pool that were created more
+// than maxAge ago. Instances that are already terminating are left out.
+func (o *OciCli) ListStaleInstances(ctx context.Context, poolID string, maxAge time.Duration) ([]core.Instance, error) {
+	instances, err := o.ListInstances(ctx, poolID)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := o.currentTime().Add(-maxAge)
+	stale := []core.Instance{}
+	for _, instance := range instances {
+		if instance.LifecycleState == core.InstanceLifecycleStateTerminating || instance.TimeCreated == nil {
+			continue
+		}
+		if instance.TimeCreated.Before(cutoff) {
+			stale = append(stale, instance)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v49/core"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+)
+
+// instanceStatePollInterval is how often an instance is polled while waiting
+// for it to reach a lifecycle state.
+var instanceStatePollInterval = 5 * time.Second
+
+// WaitForInstanceState polls the instance until it reaches the target
+// lifecycle state, the timeout expires or ctx is done, and returns it as last
+// seen in the target state. With a launch grace period configured, an
+// instance that stays PROVISIONING for longer than it fails the wait early.
+func (o *OciCli) WaitForInstanceState(ctx context.Context, instanceID string, target core.InstanceLifecycleStateEnum, timeout time.Duration) (core.Instance, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var provisioningSince time.Time
+	for {
+		resp, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+			InstanceId: &instanceID,
+		})
+		if err != nil {
+			return core.Instance{}, fmt.Errorf("error getting instance %s: %w", instanceID, err)
+		}
+		if resp.Instance.LifecycleState == target {
+			return resp.Instance, nil
+		}
+		// A terminating instance never reaches any other state, for example
+		// when the launch failed after it was accepted.
+		if isTerminalState(resp.Instance.LifecycleState) && !isTerminalState(target) {
+			return core.Instance{}, fmt.Errorf("instance %s is %s, it will not be %s", instanceID, resp.Instance.LifecycleState, target)
+		}
+		if resp.Instance.LifecycleState == core.InstanceLifecycleStateProvisioning {
+			if provisioningSince.IsZero() {
+				provisioningSince = time.Now()
+			}
+			if gracePeriod := o.cfg.LaunchGracePeriodDuration(); gracePeriod > 0 && time.Since(provisioningSince) > gracePeriod {
+				return core.Instance{}, fmt.Errorf("instance %s is still %s after the launch grace period of %s", instanceID, resp.Instance.LifecycleState, gracePeriod)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return core.Instance{}, fmt.Errorf("stopped waiting for instance %s to be %s, it is %s: %w", instanceID, target, resp.Instance.LifecycleState, ctx.Err())
+		case <-time.After(instanceStatePollInterval):
+		}
+	}
+}
+
+func isTerminalState(state core.InstanceLifecycleStateEnum) bool {
+	return state == core.InstanceLifecycleStateTerminating || state == core.InstanceLifecycleStateTerminated
+}
+
+// waitUntilStopped resolves the conflict of terminating an instance caught in
+// STOPPING, by waiting for it to be STOPPED, after stopping it right away if
+// configured to force it. Conflicts caused by any other state are returned.
+func (o *OciCli) waitUntilStopped(ctx context.Context, instanceID string) error {
+	resp, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{
+		InstanceId: &instanceID,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting instance: %w", err)
+	}
+	if resp.Instance.LifecycleState != core.InstanceLifecycleStateStopping {
+		return fmt.Errorf("instance is %s, not %s", resp.Instance.LifecycleState, core.InstanceLifecycleStateStopping)
+	}
+	if o.cfg.StoppingOnDelete == config.StoppingOnDeleteForce {
+		slog.WarnContext(ctx, "instance is stopping, forcing it to stop", "instance_id", instanceID)
+		_, err := o.computeClient.InstanceAction(ctx, core.InstanceActionRequest{
+			Action:     core.InstanceActionActionStop,
+			InstanceId: &instanceID,
+		})
+		if err != nil {
+			return fmt.Errorf("error forcing instance to stop: %w", err)
+		}
+	} else {
+		slog.InfoContext(ctx, "instance is stopping, waiting for it to stop", "instance_id", instanceID)
+	}
+	_, err = o.WaitForInstanceState(ctx, instanceID, core.InstanceLifecycleStateStopped, o.cfg.StoppingTimeoutDuration())
+	return err
+}
+
+// launchSecondsTag holds how long the instance took to reach RUNNING after
+// its launch was accepted.
+const launchSecondsTag = "GARM_LAUNCH_SECONDS"
+
+// TagLaunchDuration records how long the instance took to reach RUNNING, in
+// whole seconds, in its GARM_LAUNCH_SECONDS tag. The other freeform tags of
+// the instance, as last seen, are kept.
+func (o *OciCli) TagLaunchDuration(ctx context.Context, instance core.Instance, duration time.Duration) error {
+	tags := make(map[string]string, len(instance.FreeformTags)+1)
+	for key, value := range instance.FreeformTags {
+		tags[key] = value
+	}
+	tags[launchSecondsTag] = strconv.FormatInt(int64(duration.Round(time.Second)/time.Second), 10)
+	_, err := o.computeClient.UpdateInstance(ctx, core.UpdateInstanceRequest{
+		InstanceId: instance.Id,
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			FreeformTags: tags,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating instance tags: %w", err)
+	}
+	return nil
+}
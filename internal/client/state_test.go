@@ -0,0 +1,349 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudbase/garm-provider-oci/config"
+)
+
+func setInstanceStatePollInterval(t *testing.T, interval time.Duration) {
+	previous := instanceStatePollInterval
+	instanceStatePollInterval = interval
+	t.Cleanup(func() { instanceStatePollInterval = previous })
+}
+
+func mockStoppingInstance(mockComputeClient *MockComputeClient, instanceID string, stoppingPolls int) {
+	stopping := core.GetInstanceResponse{
+		Instance: core.Instance{Id: &instanceID, LifecycleState: core.InstanceLifecycleStateStopping},
+	}
+	stopped := core.GetInstanceResponse{
+		Instance: core.Instance{Id: &instanceID, LifecycleState: core.InstanceLifecycleStateStopped},
+	}
+	request := core.GetInstanceRequest{InstanceId: &instanceID}
+	mockComputeClient.On("GetInstance", mock.Anything, request).Return(stopping, nil).Times(stoppingPolls)
+	mockComputeClient.On("GetInstance", mock.Anything, request).Return(stopped, nil)
+}
+
+func TestWaitForInstanceState(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{},
+	}
+	request := core.GetInstanceRequest{InstanceId: &inst}
+	mockComputeClient.On("GetInstance", mock.Anything, request).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateProvisioning},
+	}, nil).Twice()
+	mockComputeClient.On("GetInstance", mock.Anything, request).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateRunning},
+	}, nil)
+
+	instance, err := ociCli.WaitForInstanceState(ctx, inst, core.InstanceLifecycleStateRunning, time.Minute)
+
+	require.NoError(t, err)
+	require.Equal(t, core.InstanceLifecycleStateRunning, instance.LifecycleState)
+	mockComputeClient.AssertNumberOfCalls(t, "GetInstance", 3)
+}
+
+func TestWaitForInstanceStateTimeout(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{},
+	}
+	mockComputeClient.On("GetInstance", mock.Anything, core.GetInstanceRequest{
+		InstanceId: &inst,
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateProvisioning},
+	}, nil)
+
+	_, err := ociCli.WaitForInstanceState(ctx, inst, core.InstanceLifecycleStateRunning, 20*time.Millisecond)
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "it is PROVISIONING")
+}
+
+func TestWaitForInstanceStateLaunchGracePeriod(t *testing.T) {
+	tests := []struct {
+		name              string
+		gracePeriod       string
+		timeout           time.Duration
+		provisioningPolls int
+		errString         string
+		deadlineExceeded  bool
+	}{
+		{
+			name:              "brief stall",
+			gracePeriod:       "1m",
+			timeout:           time.Minute,
+			provisioningPolls: 5,
+		},
+		{
+			name:        "stall beyond the grace period",
+			gracePeriod: "10ms",
+			timeout:     time.Minute,
+			errString:   "instance ocid1.instance.oc1.iad.aaaaaaaamf7 is still PROVISIONING after the launch grace period of 10ms",
+		},
+		{
+			name:             "timeout before the grace period",
+			gracePeriod:      "1m",
+			timeout:          20 * time.Millisecond,
+			errString:        "it is PROVISIONING",
+			deadlineExceeded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInstanceStatePollInterval(t, time.Millisecond)
+			ctx := context.Background()
+			inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           &config.Config{LaunchGracePeriod: tt.gracePeriod},
+			}
+			request := core.GetInstanceRequest{InstanceId: &inst}
+			provisioning := mockComputeClient.On("GetInstance", mock.Anything, request).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateProvisioning},
+			}, nil)
+			if tt.provisioningPolls > 0 {
+				provisioning.Times(tt.provisioningPolls)
+				mockComputeClient.On("GetInstance", mock.Anything, request).Return(core.GetInstanceResponse{
+					Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateRunning},
+				}, nil)
+			}
+
+			instance, err := ociCli.WaitForInstanceState(ctx, inst, core.InstanceLifecycleStateRunning, tt.timeout)
+
+			if tt.errString != "" {
+				require.ErrorContains(t, err, tt.errString)
+				if tt.deadlineExceeded {
+					require.ErrorIs(t, err, context.DeadlineExceeded)
+				} else {
+					require.NotErrorIs(t, err, context.DeadlineExceeded)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, core.InstanceLifecycleStateRunning, instance.LifecycleState)
+			mockComputeClient.AssertNumberOfCalls(t, "GetInstance", tt.provisioningPolls+1)
+		})
+	}
+}
+
+func TestWaitForInstanceStateTerminated(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     core.InstanceLifecycleStateEnum
+		errString string
+	}{
+		{
+			name:      "terminating",
+			state:     core.InstanceLifecycleStateTerminating,
+			errString: "instance ocid1.instance.oc1.iad.aaaaaaaamf7 is TERMINATING, it will not be RUNNING",
+		},
+		{
+			name:      "terminated",
+			state:     core.InstanceLifecycleStateTerminated,
+			errString: "instance ocid1.instance.oc1.iad.aaaaaaaamf7 is TERMINATED, it will not be RUNNING",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setInstanceStatePollInterval(t, time.Millisecond)
+			ctx := context.Background()
+			inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+			mockComputeClient := new(MockComputeClient)
+			ociCli := &OciCli{
+				computeClient: mockComputeClient,
+				cfg:           &config.Config{},
+			}
+			request := core.GetInstanceRequest{InstanceId: &inst}
+			mockComputeClient.On("GetInstance", mock.Anything, request).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateProvisioning},
+			}, nil).Once()
+			mockComputeClient.On("GetInstance", mock.Anything, request).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: &inst, LifecycleState: tt.state},
+			}, nil)
+
+			_, err := ociCli.WaitForInstanceState(ctx, inst, core.InstanceLifecycleStateRunning, time.Minute)
+
+			require.EqualError(t, err, tt.errString)
+			mockComputeClient.AssertNumberOfCalls(t, "GetInstance", 2)
+		})
+	}
+}
+
+func TestDeleteInstanceWaitsForStopping(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{StoppingOnDelete: config.StoppingOnDeleteWait},
+	}
+	// The termination protection check, the conflict check and one poll see
+	// the instance STOPPING.
+	mockStoppingInstance(mockComputeClient, inst, 3)
+	terminate := core.TerminateInstanceRequest{InstanceId: &inst, PreserveBootVolume: common.Bool(false)}
+	mockComputeClient.On("TerminateInstance", ctx, terminate).Return(core.TerminateInstanceResponse{}, MockServiceError{StatusCode: 409, Code: "IncorrectState"}).Once()
+	mockComputeClient.On("TerminateInstance", ctx, terminate).Return(core.TerminateInstanceResponse{}, nil).Once()
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	require.NoError(t, err)
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 2)
+	mockComputeClient.AssertNumberOfCalls(t, "GetInstance", 4)
+	mockComputeClient.AssertNotCalled(t, "InstanceAction", mock.Anything, mock.Anything)
+}
+
+func TestDeleteInstanceForcesStopping(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Millisecond)
+	ctx := context.Background()
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{StoppingOnDelete: config.StoppingOnDeleteForce},
+	}
+	mockStoppingInstance(mockComputeClient, inst, 2)
+	mockComputeClient.On("InstanceAction", ctx, core.InstanceActionRequest{
+		Action:     core.InstanceActionActionStop,
+		InstanceId: &inst,
+	}).Return(core.InstanceActionResponse{}, nil)
+	terminate := core.TerminateInstanceRequest{InstanceId: &inst, PreserveBootVolume: common.Bool(false)}
+	mockComputeClient.On("TerminateInstance", ctx, terminate).Return(core.TerminateInstanceResponse{}, MockServiceError{StatusCode: 409, Code: "IncorrectState"}).Once()
+	mockComputeClient.On("TerminateInstance", ctx, terminate).Return(core.TerminateInstanceResponse{}, nil).Once()
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	require.NoError(t, err)
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 2)
+	mockComputeClient.AssertNumberOfCalls(t, "InstanceAction", 1)
+}
+
+func TestDeleteInstanceStoppingConflictByDefault(t *testing.T) {
+	ctx := context.Background()
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{},
+	}
+	mockStoppingInstance(mockComputeClient, inst, 1)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         &inst,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, MockServiceError{StatusCode: 409, Code: "IncorrectState"})
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	require.ErrorContains(t, err, "error terminating instance")
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 1)
+}
+
+func TestDeleteInstanceStoppingRespectsCancellation(t *testing.T) {
+	setInstanceStatePollInterval(t, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{StoppingOnDelete: config.StoppingOnDeleteWait},
+	}
+	mockComputeClient.On("GetInstance", mock.Anything, core.GetInstanceRequest{
+		InstanceId: &inst,
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateStopping},
+	}, nil)
+	mockComputeClient.On("TerminateInstance", mock.Anything, core.TerminateInstanceRequest{
+		InstanceId:         &inst,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, MockServiceError{StatusCode: 409, Code: "IncorrectState"})
+	cancel()
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorContains(t, err, "stopped waiting for instance")
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 1)
+}
+
+func TestDeleteInstanceConflictNotStopping(t *testing.T) {
+	ctx := context.Background()
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{StoppingOnDelete: config.StoppingOnDeleteWait},
+	}
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: &inst,
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst, LifecycleState: core.InstanceLifecycleStateStarting},
+	}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         &inst,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, MockServiceError{StatusCode: 409, Code: "IncorrectState"})
+
+	err := ociCli.DeleteInstance(ctx, inst)
+
+	require.ErrorContains(t, err, "instance is STARTING, not STOPPING")
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 1)
+}
+
+func TestTagLaunchDuration(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(MockComputeClient)
+	ociCli := &OciCli{
+		computeClient: mockComputeClient,
+		cfg:           &config.Config{},
+	}
+	instance := core.Instance{
+		Id:           common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		FreeformTags: map[string]string{"GARM_POOL_ID": "my-pool"},
+	}
+	mockComputeClient.On("UpdateInstance", ctx, core.UpdateInstanceRequest{
+		InstanceId: instance.Id,
+		UpdateInstanceDetails: core.UpdateInstanceDetails{
+			FreeformTags: map[string]string{"GARM_POOL_ID": "my-pool", "GARM_LAUNCH_SECONDS": "94"},
+		},
+	}).Return(core.UpdateInstanceResponse{}, nil)
+
+	err := ociCli.TagLaunchDuration(ctx, instance, 93*time.Second+600*time.Millisecond)
+	require.NoError(t, err)
+	mockComputeClient.AssertNumberOfCalls(t, "UpdateInstance", 1)
+	require.Equal(t, map[string]string{"GARM_POOL_ID": "my-pool"}, instance.FreeformTags, "the tags of the instance must not be modified")
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/oracle/oci-go-sdk/v49/identity"
+)
+
+// withTimeout calls fn with a context that is canceled after the timeout,
+// so a hung connection can't block the provider indefinitely. The call first
+// waits for the rate limiter, which doesn't count against the timeout.
+func withTimeout[Req, Resp any](ctx context.Context, timeout time.Duration, limiter *rateLimiter, fn func(context.Context, Req) (Resp, error), request Req) (Resp, error) {
+	if err := limiter.wait(ctx); err != nil {
+		var response Resp
+		return response, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fn(ctx, request)
+}
+
+// timeoutComputeClient bounds every call of the wrapped compute client by
+// the request timeout and the rate limit.
+type timeoutComputeClient struct {
+	client  ClientInterface
+	timeout time.Duration
+	limiter *rateLimiter
+}
+
+func withComputeTimeout(computeClient ClientInterface, timeout time.Duration, limiter *rateLimiter) ClientInterface {
+	return &timeoutComputeClient{client: computeClient, timeout: timeout, limiter: limiter}
+}
+
+func (t *timeoutComputeClient) LaunchInstance(ctx context.Context, request core.LaunchInstanceRequest) (core.LaunchInstanceResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.LaunchInstance, request)
+}
+
+func (t *timeoutComputeClient) GetInstance(ctx context.Context, request core.GetInstanceRequest) (core.GetInstanceResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetInstance, request)
+}
+
+func (t *timeoutComputeClient) TerminateInstance(ctx context.Context, request core.TerminateInstanceRequest) (core.TerminateInstanceResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.TerminateInstance, request)
+}
+
+func (t *timeoutComputeClient) ListInstances(ctx context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListInstances, request)
+}
+
+func (t *timeoutComputeClient) InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.InstanceAction, request)
+}
+
+func (t *timeoutComputeClient) GetImage(ctx context.Context, request core.GetImageRequest) (core.GetImageResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetImage, request)
+}
+
+func (t *timeoutComputeClient) ListShapes(ctx context.Context, request core.ListShapesRequest) (core.ListShapesResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListShapes, request)
+}
+
+func (t *timeoutComputeClient) ListBootVolumeAttachments(ctx context.Context, request core.ListBootVolumeAttachmentsRequest) (core.ListBootVolumeAttachmentsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListBootVolumeAttachments, request)
+}
+
+func (t *timeoutComputeClient) UpdateInstance(ctx context.Context, request core.UpdateInstanceRequest) (core.UpdateInstanceResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.UpdateInstance, request)
+}
+
+func (t *timeoutComputeClient) ListComputeCapacityReservations(ctx context.Context, request core.ListComputeCapacityReservationsRequest) (core.ListComputeCapacityReservationsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListComputeCapacityReservations, request)
+}
+
+func (t *timeoutComputeClient) ListVnicAttachments(ctx context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListVnicAttachments, request)
+}
+
+func (t *timeoutComputeClient) ListImages(ctx context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListImages, request)
+}
+
+func (t *timeoutComputeClient) AttachVolume(ctx context.Context, request core.AttachVolumeRequest) (core.AttachVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.AttachVolume, request)
+}
+
+func (t *timeoutComputeClient) ListVolumeAttachments(ctx context.Context, request core.ListVolumeAttachmentsRequest) (core.ListVolumeAttachmentsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListVolumeAttachments, request)
+}
+
+func (t *timeoutComputeClient) GetVolumeAttachment(ctx context.Context, request core.GetVolumeAttachmentRequest) (core.GetVolumeAttachmentResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetVolumeAttachment, request)
+}
+
+func (t *timeoutComputeClient) DetachVolume(ctx context.Context, request core.DetachVolumeRequest) (core.DetachVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.DetachVolume, request)
+}
+
+// timeoutIdentityClient bounds every call of the wrapped identity client by
+// the request timeout and the rate limit.
+type timeoutIdentityClient struct {
+	client  IdentityClientInterface
+	timeout time.Duration
+	limiter *rateLimiter
+}
+
+func withIdentityTimeout(identityClient IdentityClientInterface, timeout time.Duration, limiter *rateLimiter) IdentityClientInterface {
+	return &timeoutIdentityClient{client: identityClient, timeout: timeout, limiter: limiter}
+}
+
+func (t *timeoutIdentityClient) AssembleEffectiveTagSet(ctx context.Context, request identity.AssembleEffectiveTagSetRequest) (identity.AssembleEffectiveTagSetResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.AssembleEffectiveTagSet, request)
+}
+
+func (t *timeoutIdentityClient) GetTagNamespace(ctx context.Context, request identity.GetTagNamespaceRequest) (identity.GetTagNamespaceResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetTagNamespace, request)
+}
+
+func (t *timeoutIdentityClient) ListAvailabilityDomains(ctx context.Context, request identity.ListAvailabilityDomainsRequest) (identity.ListAvailabilityDomainsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListAvailabilityDomains, request)
+}
+
+// timeoutNetworkClient bounds every call of the wrapped network client by
+// the request timeout and the rate limit.
+type timeoutNetworkClient struct {
+	client  NetworkClientInterface
+	timeout time.Duration
+	limiter *rateLimiter
+}
+
+func withNetworkTimeout(networkClient NetworkClientInterface, timeout time.Duration, limiter *rateLimiter) NetworkClientInterface {
+	return &timeoutNetworkClient{client: networkClient, timeout: timeout, limiter: limiter}
+}
+
+func (t *timeoutNetworkClient) GetSubnet(ctx context.Context, request core.GetSubnetRequest) (core.GetSubnetResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetSubnet, request)
+}
+
+func (t *timeoutNetworkClient) ListNetworkSecurityGroups(ctx context.Context, request core.ListNetworkSecurityGroupsRequest) (core.ListNetworkSecurityGroupsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListNetworkSecurityGroups, request)
+}
+
+func (t *timeoutNetworkClient) ListPrivateIps(ctx context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListPrivateIps, request)
+}
+
+func (t *timeoutNetworkClient) CreatePrivateIp(ctx context.Context, request core.CreatePrivateIpRequest) (core.CreatePrivateIpResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.CreatePrivateIp, request)
+}
+
+func (t *timeoutNetworkClient) GetVnic(ctx context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetVnic, request)
+}
+
+// timeoutBlockstorageClient bounds every call of the wrapped blockstorage
+// client by the request timeout and the rate limit.
+type timeoutBlockstorageClient struct {
+	client  BlockstorageClientInterface
+	timeout time.Duration
+	limiter *rateLimiter
+}
+
+func withBlockstorageTimeout(blockstorageClient BlockstorageClientInterface, timeout time.Duration, limiter *rateLimiter) BlockstorageClientInterface {
+	return &timeoutBlockstorageClient{client: blockstorageClient, timeout: timeout, limiter: limiter}
+}
+
+func (t *timeoutBlockstorageClient) GetBootVolume(ctx context.Context, request core.GetBootVolumeRequest) (core.GetBootVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetBootVolume, request)
+}
+
+func (t *timeoutBlockstorageClient) ListBootVolumes(ctx context.Context, request core.ListBootVolumesRequest) (core.ListBootVolumesResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListBootVolumes, request)
+}
+
+func (t *timeoutBlockstorageClient) UpdateBootVolume(ctx context.Context, request core.UpdateBootVolumeRequest) (core.UpdateBootVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.UpdateBootVolume, request)
+}
+
+func (t *timeoutBlockstorageClient) CreateVolume(ctx context.Context, request core.CreateVolumeRequest) (core.CreateVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.CreateVolume, request)
+}
+
+func (t *timeoutBlockstorageClient) GetVolume(ctx context.Context, request core.GetVolumeRequest) (core.GetVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.GetVolume, request)
+}
+
+func (t *timeoutBlockstorageClient) DeleteVolume(ctx context.Context, request core.DeleteVolumeRequest) (core.DeleteVolumeResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.DeleteVolume, request)
+}
+
+func (t *timeoutBlockstorageClient) ListVolumes(ctx context.Context, request core.ListVolumesRequest) (core.ListVolumesResponse, error) {
+	return withTimeout(ctx, t.timeout, t.limiter, t.client.ListVolumes, request)
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeClientTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     time.Duration
+		errString string
+	}{
+		{name: "call finishes in time", delay: 0},
+		{name: "call hangs past the timeout", delay: time.Minute, errString: context.DeadlineExceeded.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockComputeClient := new(MockComputeClient)
+			computeClient := withComputeTimeout(mockComputeClient, 10*time.Millisecond, nil)
+			request := core.GetInstanceRequest{InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")}
+			// Like the SDK, the mock gives up on the call once the deadline
+			// of its context passes.
+			call := mockComputeClient.On("GetInstance", mock.Anything, request)
+			call.Run(func(args mock.Arguments) {
+				ctx := args.Get(0).(context.Context)
+				_, ok := ctx.Deadline()
+				require.True(t, ok, "the call must have a deadline")
+				select {
+				case <-time.After(tt.delay):
+					call.ReturnArguments = mock.Arguments{core.GetInstanceResponse{}, nil}
+				case <-ctx.Done():
+					call.ReturnArguments = mock.Arguments{core.GetInstanceResponse{}, ctx.Err()}
+				}
+			})
+
+			_, err := computeClient.GetInstance(context.Background(), request)
+			if tt.errString != "" {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClientTimeoutKeepsEarlierDeadline(t *testing.T) {
+	mockNetworkClient := new(MockNetworkClient)
+	networkClient := withNetworkTimeout(mockNetworkClient, time.Hour, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	expected, _ := ctx.Deadline()
+	mockNetworkClient.On("GetSubnet", mock.MatchedBy(func(callCtx context.Context) bool {
+		deadline, ok := callCtx.Deadline()
+		return ok && deadline.Equal(expected)
+	}), mock.Anything).Return(core.GetSubnetResponse{}, nil)
+
+	_, err := networkClient.GetSubnet(ctx, core.GetSubnetRequest{SubnetId: common.String("subnet")})
+	require.NoError(t, err)
+	mockNetworkClient.AssertNumberOfCalls(t, "GetSubnet", 1)
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const cloudConfigHeader = "#cloud-config"
+
+// parseCloudConfig decodes a base64 encoded cloud-config into its top level
+// mapping. The #cloud-config header is optional.
+func parseCloudConfig(encoded string) (map[string]interface{}, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64: %w", err)
+	}
+	cfg := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid cloud-config: %w", err)
+	}
+	return cfg, nil
+}
+
+// mergeCloudConfig merges the user cloud-config into the generated one, the
+// way cloud-init merges parts with dict(recurse_array)+list(append): mappings
+// are merged recursively, lists are appended to and other values of the user
+// replace the generated ones.
+func mergeCloudConfig(generated []byte, user map[string]interface{}) ([]byte, error) {
+	merged := map[string]interface{}{}
+	if err := yaml.Unmarshal(generated, &merged); err != nil {
+		return nil, fmt.Errorf("failed to parse generated cloud-config: %w", err)
+	}
+	mergeCloudConfigMaps(merged, user)
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal merged cloud-config: %w", err)
+	}
+	return []byte(cloudConfigHeader + "\n" + strings.TrimPrefix(string(data), cloudConfigHeader+"\n")), nil
+}
+
+func mergeCloudConfigMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		switch srcValue := value.(type) {
+		case map[string]interface{}:
+			if dstValue, ok := dst[key].(map[string]interface{}); ok {
+				mergeCloudConfigMaps(dstValue, srcValue)
+				continue
+			}
+		case []interface{}:
+			if dstValue, ok := dst[key].([]interface{}); ok {
+				dst[key] = append(dstValue, srcValue...)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
@@ -16,16 +16,27 @@
 package spec
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
 	"sync"
+	"text/template"
 
 	"github.com/cloudbase/garm-provider-common/cloudconfig"
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/cloudbase/garm-provider-common/util"
 	"github.com/cloudbase/garm-provider-oci/config"
+	ociutil "github.com/cloudbase/garm-provider-oci/internal/util"
 	"github.com/invopop/jsonschema"
+	"github.com/oracle/oci-go-sdk/v49/core"
 	"github.com/xeipuuv/gojsonschema"
 )
 
@@ -33,12 +44,65 @@ const (
 	defaultMemoryAllocation float32 = 4
 	defaultOcpusAllocation  float32 = 1
 	defaultBootVolumeSize   int64   = 255
+	// minMemoryPerOcpu and maxMemoryPerOcpu bound the memory of flexible
+	// shapes, in GBs per OCPU.
+	minMemoryPerOcpu float32 = 1
+	maxMemoryPerOcpu float32 = 64
 )
 
+// defaultBootVolumeVpusPerGB are the boot volume VPUs per GB used for each OS
+// type when boot_volume_vpus_per_gb is not set. Windows runners are IO heavy
+// at boot and get the Higher Performance level, Linux runners the Balanced
+// one.
+var defaultBootVolumeVpusPerGB = map[params.OSType]int64{
+	params.Linux:   10,
+	params.Windows: 20,
+}
+
+// kernelArgRegex matches a single kernel command line argument, either a flag
+// or a key=value pair. Quotes, whitespace and shell metacharacters are not allowed.
+var kernelArgRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+(=[A-Za-z0-9_.,:/+@-]+)?$`)
+
+// hostnameLabelRegex matches a hostname label accepted by OCI for a VNIC.
+var hostnameLabelRegex = regexp.MustCompile(`^[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var dnsUnsafeRegex = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// unsafeEnvChars may not appear in proxy URLs, as they end up in shell and
+// systemd environment files.
+const unsafeEnvChars = " \t\r\n'\"`$\\"
+
+// gpuDriverVersionRegex matches an NVIDIA driver version, like 535 or
+// 535.183.01.
+var gpuDriverVersionRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// noProxyRegex matches a comma separated list of hosts, domains and CIDRs.
+var noProxyRegex = regexp.MustCompile(`^[A-Za-z0-9.,:/*_-]*$`)
+
 type ToolFetchFunc func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error)
 
 var DefaultToolFetch ToolFetchFunc = util.GetTools
 
+// withToolsMirror wraps fetch so the tools it returns are downloaded from
+// mirrorURL instead of GitHub. The download token is dropped, as it is only
+// valid for GitHub.
+func withToolsMirror(fetch ToolFetchFunc, mirrorURL, region string) ToolFetchFunc {
+	baseURL := strings.TrimSuffix(strings.ReplaceAll(mirrorURL, "{region}", region), "/")
+	return func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		tool, err := fetch(osType, osArch, tools)
+		if err != nil {
+			return params.RunnerApplicationDownload{}, err
+		}
+		if tool.Filename == nil || *tool.Filename == "" {
+			return params.RunnerApplicationDownload{}, fmt.Errorf("tools for %s/%s have no filename to look up in the mirror", osType, osArch)
+		}
+		downloadURL := baseURL + "/" + url.PathEscape(*tool.Filename)
+		tool.DownloadURL = &downloadURL
+		tool.TempDownloadToken = nil
+		return tool, nil
+	}
+}
+
 func generateJSONSchema() *jsonschema.Schema {
 	reflector := jsonschema.Reflector{
 		AllowAdditionalProperties: false,
@@ -58,7 +122,7 @@ func jsonSchemaValidation(schema json.RawMessage) error {
 		return fmt.Errorf("failed to validate schema: %w", err)
 	}
 	if !result.Valid() {
-		return fmt.Errorf("schema validation failed: %s", result.Errors())
+		return fmt.Errorf("schema validation failed: %s", describeSchemaErrors(jsonSchema, result.Errors()))
 	}
 	return nil
 }
@@ -80,23 +144,147 @@ func newExtraSpecsFromBootstrapData(data params.BootstrapInstance) (*extraSpecs,
 }
 
 type extraSpecs struct {
-	Ocpus           float32  `json:"ocpus,omitempty" jsonschema:"description=Number of OCPUs"`
-	MemoryInGBs     float32  `json:"memory_in_gbs,omitempty" jsonschema:"description=Memory in GBs"`
-	BootVolumeSize  int64    `json:"boot_volume_size,omitempty" jsonschema:"description=Boot volume size in GBs"`
-	SSHPublicKeys   []string `json:"ssh_public_keys,omitempty" jsonschema:"description=List of SSH public keys"`
-	DisableUpdates  bool     `json:"disable_updates,omitempty" jsonschema:"description=Disable automatic updates on the VM."`
-	EnableBootDebug bool     `json:"enable_boot_debug,omitempty" jsonschema:"description=Enable boot debug on the VM."`
-	ExtraPackages   []string `json:"extra_packages,omitempty" jsonschema:"description=Extra packages to install on the VM."`
+	Ocpus                          float32                      `json:"ocpus,omitempty" jsonschema:"description=Number of OCPUs"`
+	MemoryInGBs                    float32                      `json:"memory_in_gbs,omitempty" jsonschema:"description=Memory in GBs"`
+	BootVolumeSize                 int64                        `json:"boot_volume_size,omitempty" jsonschema:"description=Boot volume size in GBs"`
+	SSHPublicKeys                  []string                     `json:"ssh_public_keys,omitempty" jsonschema:"description=List of SSH public keys"`
+	DisableUpdates                 bool                         `json:"disable_updates,omitempty" jsonschema:"description=Disable automatic updates on the VM."`
+	EnableBootDebug                bool                         `json:"enable_boot_debug,omitempty" jsonschema:"description=Enable boot debug on the VM."`
+	ExtraPackages                  []string                     `json:"extra_packages,omitempty" jsonschema:"description=Extra packages to install on the VM."`
+	IsMultipath                    bool                         `json:"is_multipath,omitempty" jsonschema:"description=Attach the boot and data volumes over iSCSI so multipath can be used. Only supported on bare metal shapes."`
+	GPUDriver                      string                       `json:"gpu_driver,omitempty" jsonschema:"description=Version of the NVIDIA driver to install at boot on GPU shapes unless the image already has one. For example 535. Ignored on other shapes. Linux only."`
+	CloudInitMerge                 string                       `json:"cloud_init_merge,omitempty" jsonschema:"description=Base64 encoded cloud-config merged into the one generated by GARM. Mappings are merged recursively and lists are appended to. Other values replace the generated ones. Linux only."`
+	KernelArgs                     []string                     `json:"kernel_args,omitempty" jsonschema:"description=Extra kernel command line arguments added to the grub config. They take effect on the next boot. Linux only."`
+	ExtraTags                      map[string]string            `json:"extra_tags,omitempty" jsonschema:"description=Extra freeform tags set on the instance. They can't override the tags set by the provider."`
+	DefinedTags                    map[string]map[string]string `json:"defined_tags,omitempty" jsonschema:"description=Defined tags set on the instance by tag namespace and tag key."`
+	CopyImageTags                  []string                     `json:"copy_image_tags,omitempty" jsonschema:"description=Freeform tags of the image to copy onto the instance. Use * to copy all of them. Tags set by GARM are never overwritten."`
+	IsPvEncryptionInTransitEnabled bool                         `json:"is_pv_encryption_in_transit_enabled,omitempty" jsonschema:"description=Encrypt the data in transit between the instance and its paravirtualized boot volume. Only supported on virtual machine shapes."`
+	AreLegacyImdsEndpointsDisabled bool                         `json:"are_legacy_imds_endpoints_disabled,omitempty" jsonschema:"description=Disable the legacy v1 endpoints of the instance metadata service so only IMDSv2 can be used."`
+	HostnameLabel                  string                       `json:"hostname_label,omitempty" jsonschema:"pattern=^[a-z]([a-z0-9-]*[a-z0-9])?$,maxLength=63,description=Hostname label of the VNIC of the instance. Gives the instance a stable DNS name in the subnet. Can't be combined with hostname_template."`
+	HostnameTemplate               string                       `json:"hostname_template,omitempty" jsonschema:"description=Go template for the VNIC hostname label. Available fields are .PoolID, .ShortPoolID and .Suffix. The result must be a valid DNS label."`
+	NetworkPerformance             string                       `json:"network_performance,omitempty" jsonschema:"enum=paravirtualized,enum=hardware_assisted,enum=emulated,description=The VNIC attachment type. hardware_assisted uses SR-IOV for better network performance. Only supported on virtual machine shapes."`
+	PlatformConfig                 *PlatformConfig              `json:"platform_config,omitempty" jsonschema:"description=Shielded instance features of the instance. The shape must support them."`
+	ProxyConfig                    *ProxyConfig                 `json:"proxy_config,omitempty" jsonschema:"description=Proxy settings exported to the environment of the system and its services before the runner is installed. Linux only."`
+	RoundToValid                   bool                         `json:"round_to_valid,omitempty" jsonschema:"description=Round ocpus and memory_in_gbs to the nearest values accepted by the flexible shape instead of rejecting them."`
+	BlockVolumes                   []BlockVolume                `json:"block_volumes,omitempty" jsonschema:"maxItems=32,description=Block volumes created for the instance and attached to it once it is running. They are deleted with the instance."`
+	BootVolumeID                   string                       `json:"boot_volume_id,omitempty" jsonschema:"description=OCID of an existing available boot volume to boot the instance from instead of the image. It must be in the availability domain of the pool."`
+	BootVolumeDetachedAutotune     bool                         `json:"boot_volume_detached_autotune,omitempty" jsonschema:"description=Enable the detached volume autotune policy of the boot volume, which lowers its performance and cost while it is not attached to an instance."`
+	CapacityReservationID          string                       `json:"capacity_reservation_id,omitempty" jsonschema:"description=OCID of the compute capacity reservation to launch the instance in. Can't be combined with capacity_reservation_name."`
+	CapacityReservationName        string                       `json:"capacity_reservation_name,omitempty" jsonschema:"description=Display name of the compute capacity reservation to launch the instance in. It must be unique in the availability domain."`
+	DedicatedVMHostID              string                       `json:"dedicated_vm_host_id,omitempty" jsonschema:"description=OCID of the dedicated virtual machine host to launch the instance on. Instances share the hosts of the tenancy when omitted."`
+	NetworkSecurityMode            string                       `json:"network_security_mode,omitempty" jsonschema:"enum=nsg,enum=security_list,enum=both,description=How traffic of the instance is secured. security_list relies on the security lists of the subnet only and attaches no network security group. nsg and both attach the network security group. Defaults to nsg."`
+	AssignPublicIP                 *bool                        `json:"assign_public_ip,omitempty" jsonschema:"description=Assign a public IP to the VNIC of the instance. When omitted the default of the subnet applies."`
+	SubnetID                       string                       `json:"subnet_id,omitempty" jsonschema:"pattern=^ocid1\\.subnet\\.,description=OCID of the subnet to launch the instance in. It overrides the subnet of the provider config."`
+	NsgIDs                         []string                     `json:"nsg_ids,omitempty" jsonschema:"description=OCIDs of the network security groups attached to the VNIC of the instance. They replace the network security group of the provider config."`
+	FaultDomain                    string                       `json:"fault_domain,omitempty" jsonschema:"pattern=^FAULT-DOMAIN-[1-3]$,description=Fault domain of the availability domain to launch the instance in. OCI picks one when omitted."`
+	FaultDomainSpread              bool                         `json:"fault_domain_spread,omitempty" jsonschema:"description=Launch every instance in the fault domain with the fewest instances of the pool so the pool is spread round-robin across fault domains. Can't be combined with fault_domain."`
+	Metadata                       map[string]string            `json:"metadata,omitempty" jsonschema:"description=Extra instance metadata. Values may reference environment variables of the provider as ${NAME}, resolved when the instance is created."`
+	Preemptible                    bool                         `json:"preemptible,omitempty" jsonschema:"description=Launch the instance on preemptible capacity. It is terminated when the capacity is reclaimed."`
+	PreserveBootVolumeOnPreemption bool                         `json:"preserve_boot_volume_on_preemption,omitempty" jsonschema:"description=Preserve the boot volume when a preemptible instance is terminated on preemption. Requires preemptible."`
+	BootVolumeVpusPerGB            int64                        `json:"boot_volume_vpus_per_gb,omitempty" jsonschema:"minimum=10,maximum=120,multipleOf=10,description=Boot volume performance in VPUs per GB. Defaults to 20 (Higher Performance) on Windows and 10 (Balanced) on Linux."`
+	SecondaryPrivateIPs            []string                     `json:"secondary_private_ips,omitempty" jsonschema:"description=IPv4 addresses of the subnet assigned to the primary VNIC as secondary private IPs after the launch."`
+	SecondaryPrivateIPCount        int                          `json:"secondary_private_ip_count,omitempty" jsonschema:"minimum=0,maximum=31,description=Number of secondary private IPs picked by OCI and assigned to the primary VNIC after the launch. Can't be combined with secondary_private_ips."`
 	// The Cloudconfig struct from common package
 	cloudconfig.CloudConfigSpec
 }
 
+// ProxyConfig holds the proxy settings of the runner.
+type ProxyConfig struct {
+	HTTPProxy  string `json:"http_proxy,omitempty" jsonschema:"description=URL of the proxy used for HTTP requests."`
+	HTTPSProxy string `json:"https_proxy,omitempty" jsonschema:"description=URL of the proxy used for HTTPS requests."`
+	NoProxy    string `json:"no_proxy,omitempty" jsonschema:"description=Comma separated list of hosts, domains and CIDRs that are reached without the proxy."`
+}
+
+// Validate checks that the proxy settings are well formed and safe to write
+// into the environment files of the runner.
+func (p *ProxyConfig) Validate() error {
+	for _, v := range []struct{ name, value string }{
+		{"http_proxy", p.HTTPProxy},
+		{"https_proxy", p.HTTPSProxy},
+	} {
+		if v.value == "" {
+			continue
+		}
+		u, err := url.Parse(v.value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(v.value, unsafeEnvChars) {
+			return fmt.Errorf("proxy_config.%s must be a valid http or https URL", v.name)
+		}
+	}
+	if !noProxyRegex.MatchString(p.NoProxy) {
+		return fmt.Errorf("proxy_config.no_proxy must be a comma separated list of hosts, domains or CIDRs")
+	}
+	return nil
+}
+
+// env returns the proxy environment variables in both lower and upper case,
+// as tools disagree on which of the two they read.
+func (p *ProxyConfig) env() []string {
+	var env []string
+	for _, v := range []struct{ name, value string }{
+		{"http_proxy", p.HTTPProxy},
+		{"https_proxy", p.HTTPSProxy},
+		{"no_proxy", p.NoProxy},
+	} {
+		if v.value == "" {
+			continue
+		}
+		env = append(env, v.name+"="+v.value, strings.ToUpper(v.name)+"="+v.value)
+	}
+	return env
+}
+
+// BlockVolume is a block volume created for the instance and attached to it.
+type BlockVolume struct {
+	SizeInGBs int64 `json:"size_in_gbs" jsonschema:"minimum=50,maximum=32768,description=Size of the block volume in GBs."`
+	VpusPerGB int64 `json:"vpus_per_gb,omitempty" jsonschema:"minimum=0,maximum=120,multipleOf=10,description=Block volume performance in VPUs per GB. Defaults to 10 (Balanced)."`
+}
+
+// PlatformConfig holds the shielded instance features of the instance.
+type PlatformConfig struct {
+	SecureBootEnabled              bool `json:"secure_boot_enabled,omitempty" jsonschema:"description=Boot only firmware and boot loaders signed by a trusted authority."`
+	MeasuredBootEnabled            bool `json:"measured_boot_enabled,omitempty" jsonschema:"description=Measure the boot process into the TPM. Requires is_trusted_platform_module_enabled."`
+	IsTrustedPlatformModuleEnabled bool `json:"is_trusted_platform_module_enabled,omitempty" jsonschema:"description=Enable the Trusted Platform Module of the instance."`
+}
+
+// Enabled reports whether any of the features is enabled.
+func (p *PlatformConfig) Enabled() bool {
+	return p != nil && (p.SecureBootEnabled || p.MeasuredBootEnabled || p.IsTrustedPlatformModuleEnabled)
+}
+
 func GetRunnerSpecFromBootstrapParams(cfg *config.Config, data params.BootstrapInstance, controllerID string) (*RunnerSpec, error) {
-	tools, err := DefaultToolFetch(data.OSType, data.OSArch, data.Tools)
+	fetch := DefaultToolFetch
+	if cfg.ToolsMirrorURL != "" {
+		fetch = withToolsMirror(fetch, cfg.ToolsMirrorURL, cfg.Region)
+	}
+	tools, err := fetch(data.OSType, data.OSArch, data.Tools)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tools: %s", err)
 	}
 
+	spec, err := newRunnerSpec(cfg, data, controllerID)
+	if err != nil {
+		return nil, err
+	}
+	spec.Tools = tools
+	if err := spec.SetUserData(); err != nil {
+		return nil, fmt.Errorf("error setting extra specs: %w", err)
+	}
+
+	return spec, nil
+}
+
+// ValidateBootstrapParams checks the bootstrap params the way creating an
+// instance would, without fetching the runner tools or calling OCI, so pools
+// can be linted offline. Checks that need OCI, like the bounds of the shape,
+// are left to the launch.
+func ValidateBootstrapParams(cfg *config.Config, data params.BootstrapInstance, controllerID string) error {
+	_, err := newRunnerSpec(cfg, data, controllerID)
+	return err
+}
+
+// newRunnerSpec builds and validates the spec of the bootstrap params, up to
+// the parts that need the runner tools.
+func newRunnerSpec(cfg *config.Config, data params.BootstrapInstance, controllerID string) (*RunnerSpec, error) {
 	extraSpecs, err := newExtraSpecsFromBootstrapData(data)
 	if err != nil {
 		return nil, fmt.Errorf("error loading extra specs: %w", err)
@@ -107,37 +295,75 @@ func GetRunnerSpecFromBootstrapParams(cfg *config.Config, data params.BootstrapI
 		CompartmentID:      cfg.CompartmentId,
 		SubnetID:           cfg.SubnetID,
 		NsgID:              cfg.NsgID,
+		NsgName:            cfg.NsgName,
 		ControllerID:       controllerID,
-		Tools:              tools,
 		BootstrapParams:    data,
 		ExtraPackages:      extraSpecs.ExtraPackages,
 	}
 
 	spec.MergeExtraSpecs(extraSpecs)
-	if err := spec.SetUserData(); err != nil {
-		return nil, fmt.Errorf("error setting extra specs: %w", err)
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating spec: %w", err)
+	}
+	if err := spec.validateTags(); err != nil {
+		return nil, fmt.Errorf("error validating tags: %w", err)
+	}
+	if err := spec.SetHostnameLabel(); err != nil {
+		return nil, fmt.Errorf("error setting hostname label: %w", err)
 	}
-
 	return spec, nil
 }
 
 type RunnerSpec struct {
-	AvailabilityDomain string
-	CompartmentID      string
-	SubnetID           string
-	NsgID              string
-	BootVolumeSize     int64
-	UserData           string
-	ControllerID       string
-	Ocpus              float32
-	MemoryInGBs        float32
-	SSHPublicKeys      []string
-	DisableUpdates     bool
-	ExtraPackages      []string
-	EnableBootDebug    bool
-	Tools              params.RunnerApplicationDownload
-	BootstrapParams    params.BootstrapInstance
-	mux                sync.Mutex
+	AvailabilityDomain             string
+	CompartmentID                  string
+	SubnetID                       string
+	NsgID                          string
+	NsgName                        string
+	NsgIDs                         []string
+	AssignPublicIP                 *bool
+	BootVolumeSize                 int64
+	UserData                       string
+	ControllerID                   string
+	Ocpus                          float32
+	MemoryInGBs                    float32
+	SSHPublicKeys                  []string
+	DisableUpdates                 bool
+	ExtraPackages                  []string
+	EnableBootDebug                bool
+	IsMultipath                    bool
+	KernelArgs                     []string
+	CloudInitMerge                 string
+	GPUDriver                      string
+	ExtraTags                      map[string]string
+	DefinedTags                    map[string]map[string]string
+	CopyImageTags                  []string
+	HostnameTemplate               string
+	HostnameLabel                  string
+	NetworkPerformance             string
+	IsPvEncryptionInTransitEnabled bool
+	AreLegacyImdsEndpointsDisabled bool
+	PlatformConfig                 *PlatformConfig
+	ProxyConfig                    *ProxyConfig
+	RoundToValid                   bool
+	BlockVolumes                   []BlockVolume
+	BootVolumeID                   string
+	BootVolumeDetachedAutotune     bool
+	CapacityReservationID          string
+	CapacityReservationName        string
+	DedicatedVMHostID              string
+	FaultDomain                    string
+	FaultDomainSpread              bool
+	NetworkSecurityMode            string
+	Metadata                       map[string]string
+	Preemptible                    bool
+	PreserveBootVolumeOnPreemption bool
+	BootVolumeVpusPerGB            int64
+	SecondaryPrivateIPs            []string
+	SecondaryPrivateIPCount        int
+	Tools                          params.RunnerApplicationDownload
+	BootstrapParams                params.BootstrapInstance
+	mux                            sync.Mutex
 }
 
 func (r *RunnerSpec) MergeExtraSpecs(extraSpecs *extraSpecs) {
@@ -156,12 +382,406 @@ func (r *RunnerSpec) MergeExtraSpecs(extraSpecs *extraSpecs) {
 	if len(extraSpecs.SSHPublicKeys) > 0 {
 		r.SSHPublicKeys = extraSpecs.SSHPublicKeys
 	}
+	r.BootVolumeVpusPerGB = defaultBootVolumeVpusPerGB[r.BootstrapParams.OSType]
+	if extraSpecs.BootVolumeVpusPerGB > 0 {
+		r.BootVolumeVpusPerGB = extraSpecs.BootVolumeVpusPerGB
+	}
 	if extraSpecs.DisableUpdates {
 		r.DisableUpdates = extraSpecs.DisableUpdates
 	}
 	if extraSpecs.EnableBootDebug {
 		r.EnableBootDebug = extraSpecs.EnableBootDebug
 	}
+	if extraSpecs.IsMultipath {
+		r.IsMultipath = extraSpecs.IsMultipath
+	}
+	if extraSpecs.GPUDriver != "" {
+		r.GPUDriver = extraSpecs.GPUDriver
+	}
+	if len(extraSpecs.KernelArgs) > 0 {
+		r.KernelArgs = extraSpecs.KernelArgs
+	}
+	if extraSpecs.CloudInitMerge != "" {
+		r.CloudInitMerge = extraSpecs.CloudInitMerge
+	}
+	if len(extraSpecs.ExtraTags) > 0 {
+		r.ExtraTags = extraSpecs.ExtraTags
+	}
+	if len(extraSpecs.DefinedTags) > 0 {
+		r.DefinedTags = extraSpecs.DefinedTags
+	}
+	if len(extraSpecs.CopyImageTags) > 0 {
+		r.CopyImageTags = extraSpecs.CopyImageTags
+	}
+	if extraSpecs.HostnameLabel != "" {
+		r.HostnameLabel = extraSpecs.HostnameLabel
+	}
+	if extraSpecs.HostnameTemplate != "" {
+		r.HostnameTemplate = extraSpecs.HostnameTemplate
+	}
+	if extraSpecs.IsPvEncryptionInTransitEnabled {
+		r.IsPvEncryptionInTransitEnabled = extraSpecs.IsPvEncryptionInTransitEnabled
+	}
+	if extraSpecs.AreLegacyImdsEndpointsDisabled {
+		r.AreLegacyImdsEndpointsDisabled = extraSpecs.AreLegacyImdsEndpointsDisabled
+	}
+	if extraSpecs.NetworkPerformance != "" {
+		r.NetworkPerformance = extraSpecs.NetworkPerformance
+	}
+	if extraSpecs.PlatformConfig != nil {
+		r.PlatformConfig = extraSpecs.PlatformConfig
+	}
+	if extraSpecs.ProxyConfig != nil {
+		r.ProxyConfig = extraSpecs.ProxyConfig
+	}
+	if extraSpecs.RoundToValid {
+		r.RoundToValid = extraSpecs.RoundToValid
+	}
+	if extraSpecs.BootVolumeDetachedAutotune {
+		r.BootVolumeDetachedAutotune = extraSpecs.BootVolumeDetachedAutotune
+	}
+	if len(extraSpecs.BlockVolumes) > 0 {
+		r.BlockVolumes = extraSpecs.BlockVolumes
+	}
+	if extraSpecs.BootVolumeID != "" {
+		r.BootVolumeID = extraSpecs.BootVolumeID
+	}
+	if extraSpecs.CapacityReservationID != "" {
+		r.CapacityReservationID = extraSpecs.CapacityReservationID
+	}
+	if extraSpecs.CapacityReservationName != "" {
+		r.CapacityReservationName = extraSpecs.CapacityReservationName
+	}
+	if extraSpecs.DedicatedVMHostID != "" {
+		r.DedicatedVMHostID = extraSpecs.DedicatedVMHostID
+	}
+	if extraSpecs.NetworkSecurityMode != "" {
+		r.NetworkSecurityMode = extraSpecs.NetworkSecurityMode
+	}
+	if extraSpecs.SubnetID != "" {
+		r.SubnetID = extraSpecs.SubnetID
+	}
+	if len(extraSpecs.NsgIDs) > 0 {
+		r.NsgIDs = extraSpecs.NsgIDs
+	}
+	if extraSpecs.AssignPublicIP != nil {
+		r.AssignPublicIP = extraSpecs.AssignPublicIP
+	}
+	if extraSpecs.FaultDomain != "" {
+		r.FaultDomain = extraSpecs.FaultDomain
+	}
+	if extraSpecs.FaultDomainSpread {
+		r.FaultDomainSpread = extraSpecs.FaultDomainSpread
+	}
+	if len(extraSpecs.Metadata) > 0 {
+		r.Metadata = extraSpecs.Metadata
+	}
+	if extraSpecs.Preemptible {
+		r.Preemptible = extraSpecs.Preemptible
+	}
+	if extraSpecs.PreserveBootVolumeOnPreemption {
+		r.PreserveBootVolumeOnPreemption = extraSpecs.PreserveBootVolumeOnPreemption
+	}
+	if len(extraSpecs.SecondaryPrivateIPs) > 0 {
+		r.SecondaryPrivateIPs = extraSpecs.SecondaryPrivateIPs
+	}
+	if extraSpecs.SecondaryPrivateIPCount > 0 {
+		r.SecondaryPrivateIPCount = extraSpecs.SecondaryPrivateIPCount
+	}
+}
+
+// networkTypes maps the network_performance values to the launch option
+// network type.
+var networkTypes = map[string]core.LaunchOptionsNetworkTypeEnum{
+	"paravirtualized":   core.LaunchOptionsNetworkTypeParavirtualized,
+	"hardware_assisted": core.LaunchOptionsNetworkTypeVfio,
+	"emulated":          core.LaunchOptionsNetworkTypeE1000,
+}
+
+// The network_security_mode values. The security lists of the subnet always
+// apply, so nsg and both only differ in intent.
+const (
+	NetworkSecurityModeNsg          = "nsg"
+	NetworkSecurityModeSecurityList = "security_list"
+	NetworkSecurityModeBoth         = "both"
+)
+
+// AttachesNsg reports whether network security groups are attached to the
+// VNIC of the instance.
+func (r *RunnerSpec) AttachesNsg() bool {
+	return r.NetworkSecurityMode != NetworkSecurityModeSecurityList
+}
+
+// NetworkType returns the launch option network type for the requested
+// network performance, or an empty value if none was requested.
+func (r *RunnerSpec) NetworkType() core.LaunchOptionsNetworkTypeEnum {
+	return networkTypes[r.NetworkPerformance]
+}
+
+// Validate checks that the merged spec is consistent with the requested shape.
+func (r *RunnerSpec) Validate() error {
+	if err := r.validateFlexShapeConfig(); err != nil {
+		return err
+	}
+	if r.IsMultipath && !strings.HasPrefix(r.BootstrapParams.Flavor, "BM.") {
+		return fmt.Errorf("is_multipath is not supported for shape %s, only bare metal shapes support iSCSI multipath", r.BootstrapParams.Flavor)
+	}
+	if r.IsPvEncryptionInTransitEnabled && !strings.HasPrefix(r.BootstrapParams.Flavor, "VM.") {
+		return fmt.Errorf("is_pv_encryption_in_transit_enabled is not supported for shape %s, only virtual machine shapes support in-transit encryption", r.BootstrapParams.Flavor)
+	}
+	if r.NetworkPerformance != "" {
+		if _, ok := networkTypes[r.NetworkPerformance]; !ok {
+			return fmt.Errorf("invalid network_performance %q", r.NetworkPerformance)
+		}
+		if !strings.HasPrefix(r.BootstrapParams.Flavor, "VM.") {
+			return fmt.Errorf("network_performance is not supported for shape %s, only virtual machine shapes support selecting the VNIC attachment type", r.BootstrapParams.Flavor)
+		}
+	}
+	switch r.NetworkSecurityMode {
+	case "":
+	case NetworkSecurityModeSecurityList:
+		if len(r.NsgIDs) > 0 {
+			return fmt.Errorf("nsg_ids can't be combined with network_security_mode %s", r.NetworkSecurityMode)
+		}
+	case NetworkSecurityModeNsg, NetworkSecurityModeBoth:
+		if r.NsgID == "" && r.NsgName == "" && len(r.NsgIDs) == 0 {
+			return fmt.Errorf("network_security_mode %s requires a network security group", r.NetworkSecurityMode)
+		}
+	default:
+		return fmt.Errorf("invalid network_security_mode %q", r.NetworkSecurityMode)
+	}
+	for _, nsgID := range r.NsgIDs {
+		if !strings.HasPrefix(nsgID, "ocid1.networksecuritygroup.") {
+			return fmt.Errorf("invalid nsg_ids entry %q, it must be the OCID of a network security group", nsgID)
+		}
+	}
+	if r.PlatformConfig != nil && r.PlatformConfig.MeasuredBootEnabled && !r.PlatformConfig.IsTrustedPlatformModuleEnabled {
+		return fmt.Errorf("platform_config.measured_boot_enabled requires platform_config.is_trusted_platform_module_enabled")
+	}
+	if r.ProxyConfig != nil {
+		if r.BootstrapParams.OSType != params.Linux {
+			return fmt.Errorf("proxy_config is only supported on linux")
+		}
+		if err := r.ProxyConfig.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(r.SecondaryPrivateIPs) > 0 && r.SecondaryPrivateIPCount > 0 {
+		return fmt.Errorf("secondary_private_ips and secondary_private_ip_count can't be combined")
+	}
+	seenIPs := map[string]bool{}
+	for _, ip := range r.SecondaryPrivateIPs {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || parsed.To4() == nil {
+			return fmt.Errorf("invalid secondary private IP %q, it must be an IPv4 address", ip)
+		}
+		if seenIPs[parsed.String()] {
+			return fmt.Errorf("secondary private IP %s is listed more than once", ip)
+		}
+		seenIPs[parsed.String()] = true
+	}
+	if r.CapacityReservationID != "" {
+		if r.CapacityReservationName != "" {
+			return fmt.Errorf("capacity_reservation_id and capacity_reservation_name can't be combined")
+		}
+		if !strings.HasPrefix(r.CapacityReservationID, "ocid1.capacityreservation.") {
+			return fmt.Errorf("invalid capacity_reservation_id %q, it must be the OCID of a compute capacity reservation", r.CapacityReservationID)
+		}
+	}
+	if r.BootVolumeID != "" && !strings.HasPrefix(r.BootVolumeID, "ocid1.bootvolume.") {
+		return fmt.Errorf("invalid boot_volume_id %q, it must be the OCID of a boot volume", r.BootVolumeID)
+	}
+	if r.DedicatedVMHostID != "" {
+		if !strings.HasPrefix(r.DedicatedVMHostID, "ocid1.dedicatedvmhost.") {
+			return fmt.Errorf("invalid dedicated_vm_host_id %q, it must be the OCID of a dedicated virtual machine host", r.DedicatedVMHostID)
+		}
+		if r.Preemptible {
+			return fmt.Errorf("preemptible instances can't be launched on a dedicated virtual machine host")
+		}
+	}
+	if r.HostnameLabel != "" && r.HostnameTemplate != "" {
+		return fmt.Errorf("hostname_label and hostname_template can't be combined")
+	}
+	if r.FaultDomainSpread && r.FaultDomain != "" {
+		return fmt.Errorf("fault_domain_spread and fault_domain can't be combined")
+	}
+	if r.PreserveBootVolumeOnPreemption && !r.Preemptible {
+		return fmt.Errorf("preserve_boot_volume_on_preemption requires preemptible")
+	}
+	if len(r.KernelArgs) > 0 && r.BootstrapParams.OSType != params.Linux {
+		return fmt.Errorf("kernel_args are only supported on linux")
+	}
+	for _, arg := range r.KernelArgs {
+		if !kernelArgRegex.MatchString(arg) {
+			return fmt.Errorf("invalid kernel argument %q", arg)
+		}
+	}
+	if r.CloudInitMerge != "" {
+		if r.BootstrapParams.OSType != params.Linux {
+			return fmt.Errorf("cloud_init_merge is only supported on linux")
+		}
+		if _, err := parseCloudConfig(r.CloudInitMerge); err != nil {
+			return fmt.Errorf("invalid cloud_init_merge: %w", err)
+		}
+	}
+	if r.GPUDriver != "" {
+		if r.BootstrapParams.OSType != params.Linux {
+			return fmt.Errorf("gpu_driver is only supported on linux")
+		}
+		if !gpuDriverVersionRegex.MatchString(r.GPUDriver) {
+			return fmt.Errorf("invalid gpu_driver version %q", r.GPUDriver)
+		}
+	}
+	return nil
+}
+
+// validateFlexShapeConfig checks the OCPUs of flexible shapes are a whole
+// number and their memory within the 1 to 64 GB per OCPU that OCI allows
+// them. It is an offline approximation of the bounds the shape itself
+// reports, so a bad pair fails before any OCI call. With round_to_valid the
+// OCPUs are rounded at launch, so only the ratio of the rounded OCPUs is
+// checked.
+func (r *RunnerSpec) validateFlexShapeConfig() error {
+	if !strings.HasSuffix(r.BootstrapParams.Flavor, ".Flex") || r.Ocpus <= 0 {
+		return nil
+	}
+	ocpus := r.Ocpus
+	if r.RoundToValid {
+		ocpus = max(float32(math.Round(float64(ocpus))), 1)
+	} else if ocpus != float32(math.Trunc(float64(ocpus))) {
+		return fmt.Errorf("shape %s only accepts a whole number of OCPUs, got %g", r.BootstrapParams.Flavor, ocpus)
+	}
+	perOcpu := r.MemoryInGBs / ocpus
+	if perOcpu < minMemoryPerOcpu || perOcpu > maxMemoryPerOcpu {
+		return fmt.Errorf("shape %s accepts between %g and %g GB of memory per OCPU, got %g GB for %g OCPUs", r.BootstrapParams.Flavor, minMemoryPerOcpu, maxMemoryPerOcpu, r.MemoryInGBs, ocpus)
+	}
+	return nil
+}
+
+// IsGPUShape reports whether the shape of the instance has GPUs.
+func (r *RunnerSpec) IsGPUShape() bool {
+	return strings.HasPrefix(r.BootstrapParams.Flavor, "VM.GPU") || strings.HasPrefix(r.BootstrapParams.Flavor, "BM.GPU")
+}
+
+// SetHostnameLabel renders the hostname template, if any, into a DNS label
+// for the VNIC of the instance.
+func (r *RunnerSpec) SetHostnameLabel() error {
+	if r.HostnameTemplate == "" {
+		return nil
+	}
+	tpl, err := template.New("hostname").Option("missingkey=error").Parse(r.HostnameTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse hostname_template: %w", err)
+	}
+	poolID := dnsSafe(r.BootstrapParams.PoolID)
+	shortPoolID := poolID
+	if len(shortPoolID) > 8 {
+		shortPoolID = strings.Trim(shortPoolID[:8], "-")
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, struct {
+		PoolID      string
+		ShortPoolID string
+		Suffix      string
+	}{
+		PoolID:      poolID,
+		ShortPoolID: shortPoolID,
+		Suffix:      hostnameSuffix(r.BootstrapParams.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render hostname_template: %w", err)
+	}
+	label := strings.ToLower(buf.String())
+	if !hostnameLabelRegex.MatchString(label) {
+		return fmt.Errorf("hostname label %q is not a valid DNS label, it must start with a letter, contain only letters, digits and hyphens and be at most 63 characters long", label)
+	}
+	r.HostnameLabel = label
+	return nil
+}
+
+// hostnameSuffix returns a short, DNS safe suffix unique to the instance,
+// derived from the random part of the GARM instance name.
+func hostnameSuffix(name string) string {
+	suffix := dnsSafe(name[strings.LastIndex(name, "-")+1:])
+	if len(suffix) > 8 {
+		suffix = strings.Trim(suffix[len(suffix)-8:], "-")
+	}
+	return suffix
+}
+
+// dnsSafe lowercases the value and replaces anything that is not allowed in a
+// DNS label with a hyphen.
+func dnsSafe(value string) string {
+	value = strings.ToLower(value)
+	value = dnsUnsafeRegex.ReplaceAllString(value, "-")
+	return strings.Trim(value, "-")
+}
+
+// RedactedJSON returns the resolved spec as JSON, with the user data and the
+// instance token replaced, so it can be shown to operators.
+func (r *RunnerSpec) RedactedJSON() ([]byte, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal spec: %w", err)
+	}
+	var resolved map[string]interface{}
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal spec: %w", err)
+	}
+	if r.UserData != "" {
+		resolved["UserData"] = ociutil.RedactedValue
+	}
+	if r.CloudInitMerge != "" {
+		resolved["CloudInitMerge"] = ociutil.RedactedValue
+	}
+	if bootstrapParams, ok := resolved["BootstrapParams"].(map[string]interface{}); ok && r.BootstrapParams.InstanceToken != "" {
+		bootstrapParams["instance-token"] = ociutil.RedactedValue
+	}
+	return json.Marshal(resolved)
+}
+
+// specHashExcluded are the fields of the spec that differ between instances
+// of the same pool, or are not part of the pool config, and are left out of
+// its hash.
+var specHashExcluded = []string{"UserData", "HostnameLabel", "Tools"}
+
+// specHashBootstrapParams are the bootstrap params that are part of the pool
+// config and are included in the hash of the spec.
+var specHashBootstrapParams = []string{"flavor", "image", "os_type", "arch", "labels", "pool_id"}
+
+// Hash returns a stable hash of the resolved spec, leaving out the fields
+// that change from one instance of the pool to the next, like the name and
+// the user data. Instances launched from the same pool config have the same
+// hash.
+func (r *RunnerSpec) Hash() (string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal spec: %w", err)
+	}
+	var resolved map[string]interface{}
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return "", fmt.Errorf("failed to unmarshal spec: %w", err)
+	}
+	for _, field := range specHashExcluded {
+		delete(resolved, field)
+	}
+	bootstrapParams, _ := resolved["BootstrapParams"].(map[string]interface{})
+	hashedParams := map[string]interface{}{}
+	for _, param := range specHashBootstrapParams {
+		hashedParams[param] = bootstrapParams[param]
+	}
+	resolved["BootstrapParams"] = hashedParams
+	// Map keys are marshaled sorted, which keeps the hash stable.
+	hashed, err := json.Marshal(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal spec: %w", err)
+	}
+	sum := sha256.Sum256(hashed)
+	return hex.EncodeToString(sum[:]), nil
 }
 
 func (r *RunnerSpec) SetUserData() error {
@@ -186,13 +806,131 @@ func (r *RunnerSpec) ComposeUserData() ([]byte, error) {
 	bootstrapParams.UserDataOptions.DisableUpdatesOnBoot = r.DisableUpdates
 	bootstrapParams.UserDataOptions.ExtraPackages = r.ExtraPackages
 	bootstrapParams.UserDataOptions.EnableBootDebug = r.EnableBootDebug
+	if scripts := r.preInstallScripts(); len(scripts) > 0 {
+		extraSpecs, err := withPreInstallScripts(bootstrapParams.ExtraSpecs, scripts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add pre install scripts: %w", err)
+		}
+		bootstrapParams.ExtraSpecs = extraSpecs
+	}
 	switch r.BootstrapParams.OSType {
 	case params.Linux, params.Windows:
 		udata, err := cloudconfig.GetCloudConfig(bootstrapParams, r.Tools, bootstrapParams.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate userdata: %w", err)
 		}
-		return []byte(udata), nil
+		if r.CloudInitMerge == "" {
+			return []byte(udata), nil
+		}
+		userConfig, err := parseCloudConfig(r.CloudInitMerge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cloud_init_merge: %w", err)
+		}
+		return mergeCloudConfig([]byte(udata), userConfig)
 	}
 	return nil, fmt.Errorf("unsupported OS type for cloud config: %s", bootstrapParams.OSType)
 }
+
+// preInstallScripts returns the scripts generated by the provider that need to
+// run before the runner is installed. The keys are prefixed so they sort, and
+// run, before any user supplied pre install scripts.
+func (r *RunnerSpec) preInstallScripts() map[string][]byte {
+	scripts := map[string][]byte{}
+	if r.ProxyConfig != nil {
+		if env := r.ProxyConfig.env(); len(env) > 0 {
+			scripts["00-garm-proxy"] = proxyScript(env)
+		}
+	}
+	if len(r.KernelArgs) > 0 {
+		scripts["00-garm-kernel-args"] = kernelArgsScript(r.KernelArgs)
+	}
+	if r.GPUDriver != "" && r.IsGPUShape() {
+		scripts["00-garm-gpu-driver"] = gpuDriverScript(r.GPUDriver)
+	}
+	return scripts
+}
+
+// gpuDriverScript installs the NVIDIA driver from the distribution packages,
+// or from the NVIDIA repository on Oracle Linux, unless one is installed.
+func gpuDriverScript(version string) []byte {
+	return []byte(fmt.Sprintf(`#!/bin/bash
+set -e
+DRIVER_VERSION="%s"
+if command -v nvidia-smi >/dev/null 2>&1; then
+	exit 0
+fi
+if command -v apt-get >/dev/null 2>&1; then
+	apt-get update
+	DEBIAN_FRONTEND=noninteractive apt-get install -y "nvidia-driver-${DRIVER_VERSION%%%%.*}-server"
+elif command -v dnf >/dev/null 2>&1; then
+	RHEL=$(rpm -E %%rhel)
+	dnf config-manager --add-repo "https://developer.download.nvidia.com/compute/cuda/repos/rhel${RHEL}/$(uname -m)/cuda-rhel${RHEL}.repo"
+	dnf module install -y "nvidia-driver:${DRIVER_VERSION%%%%.*}-dkms"
+fi
+`, version))
+}
+
+func kernelArgsScript(args []string) []byte {
+	joined := strings.Join(args, " ")
+	return []byte(fmt.Sprintf(`#!/bin/bash
+set -e
+KERNEL_ARGS="%s"
+if command -v grubby >/dev/null 2>&1; then
+	grubby --update-kernel=ALL --args="$KERNEL_ARGS"
+elif [ -f /etc/default/grub ]; then
+	sed -i "s|^GRUB_CMDLINE_LINUX=\"\(.*\)\"|GRUB_CMDLINE_LINUX=\"\1 $KERNEL_ARGS\"|" /etc/default/grub
+	if command -v update-grub >/dev/null 2>&1; then
+		update-grub
+	else
+		grub2-mkconfig -o /boot/grub2/grub.cfg
+	fi
+fi
+`, joined))
+}
+
+// proxyScript exports the proxy environment to login shells and, through the
+// systemd manager defaults, to the runner service installed later on.
+func proxyScript(env []string) []byte {
+	return []byte(fmt.Sprintf(`#!/bin/bash
+set -e
+cat >> /etc/environment <<'EOF'
+%s
+EOF
+mkdir -p /etc/systemd/system.conf.d
+cat > /etc/systemd/system.conf.d/10-garm-proxy.conf <<'EOF'
+[Manager]
+DefaultEnvironment=%s
+EOF
+systemctl daemon-reexec || true
+`, strings.Join(env, "\n"), strings.Join(env, " ")))
+}
+
+// withPreInstallScripts merges the given scripts into the pre_install_scripts
+// field of the raw extra specs, so they get picked up by the cloud config
+// generated by the common package.
+func withPreInstallScripts(extraSpecs json.RawMessage, scripts map[string][]byte) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if len(extraSpecs) > 0 {
+		if err := json.Unmarshal(extraSpecs, &fields); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal extra specs: %w", err)
+		}
+	}
+
+	existing := map[string][]byte{}
+	if raw, ok := fields["pre_install_scripts"]; ok {
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal pre install scripts: %w", err)
+		}
+	}
+	for name, script := range scripts {
+		existing[name] = script
+	}
+
+	raw, err := json.Marshal(existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pre install scripts: %w", err)
+	}
+	fields["pre_install_scripts"] = raw
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// maxSuggestionDistance is the largest edit distance between an unknown key
+// and a valid one for the valid key to be suggested.
+const maxSuggestionDistance = 3
+
+// describeSchemaErrors formats the schema validation errors. Unknown keys are
+// reported along with the closest valid key, if there is one.
+func describeSchemaErrors(schema *jsonschema.Schema, resultErrors []gojsonschema.ResultError) string {
+	descriptions := make([]string, 0, len(resultErrors))
+	for _, resultErr := range resultErrors {
+		property, ok := resultErr.Details()["property"].(string)
+		if resultErr.Type() != "additional_property_not_allowed" || !ok {
+			descriptions = append(descriptions, resultErr.String())
+			continue
+		}
+		description := fmt.Sprintf("unknown key %q", property)
+		if resultErr.Field() != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			description = fmt.Sprintf("%s: %s", resultErr.Field(), description)
+		}
+		if suggestion := closestKey(property, schemaProperties(schema, resultErr.Field())); suggestion != "" {
+			description = fmt.Sprintf("%s, did you mean %q?", description, suggestion)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// schemaProperties returns the property names of the object at the given
+// gojsonschema field path.
+func schemaProperties(schema *jsonschema.Schema, field string) []string {
+	current := resolveRef(schema, schema)
+	if field != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+		for _, part := range strings.Split(field, ".") {
+			if current == nil {
+				return nil
+			}
+			if current.Items != nil {
+				current = resolveRef(schema, current.Items)
+				continue
+			}
+			if current.Properties == nil {
+				return nil
+			}
+			next, ok := current.Properties.Get(part)
+			if !ok {
+				return nil
+			}
+			current = resolveRef(schema, next)
+		}
+	}
+	if current == nil || current.Properties == nil {
+		return nil
+	}
+	properties := make([]string, 0, current.Properties.Len())
+	for pair := current.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		properties = append(properties, pair.Key)
+	}
+	return properties
+}
+
+func resolveRef(root, schema *jsonschema.Schema) *jsonschema.Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = root.Definitions[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	}
+	return schema
+}
+
+// closestKey returns the candidate closest to key, or an empty string if
+// none is within maxSuggestionDistance edits.
+func closestKey(key string, candidates []string) string {
+	best := ""
+	bestDistance := maxSuggestionDistance + 1
+	for _, candidate := range candidates {
+		if distance := levenshtein(key, candidate); distance < bestDistance {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
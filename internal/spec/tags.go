@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package spec
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cloudbase/garm-provider-oci/internal/util"
+)
+
+const (
+	// maxTagKeyLength and maxTagValueLength are the limits OCI puts on
+	// freeform tags, in characters.
+	maxTagKeyLength   = 100
+	maxTagValueLength = 256
+)
+
+// reservedTags returns the freeform tags the provider sets on every instance
+// that are known from the spec.
+func (r *RunnerSpec) reservedTags() map[string]string {
+	tags := map[string]string{
+		"Name":               r.BootstrapParams.Name,
+		"GARM_POOL_ID":       r.BootstrapParams.PoolID,
+		"OSType":             string(r.BootstrapParams.OSType),
+		"OSArch":             string(r.BootstrapParams.OSArch),
+		"GARM_CONTROLLER_ID": r.ControllerID,
+	}
+	if labels := util.LabelsToTagValue(r.BootstrapParams.Labels); labels != "" {
+		tags["GARM_LABELS"] = labels
+	}
+	return tags
+}
+
+// isReservedTag reports whether the freeform tag key is set by the provider.
+// Tag keys are case insensitive.
+func isReservedTag(key string) bool {
+	switch strings.ToLower(key) {
+	case "name", "ostype", "osarch":
+		return true
+	}
+	return strings.HasPrefix(strings.ToUpper(key), "GARM_")
+}
+
+// validateTags checks the freeform tags of the instance against the
+// constraints of OCI, so an invalid tag is reported before the launch.
+func (r *RunnerSpec) validateTags() error {
+	for key, value := range r.reservedTags() {
+		if err := validateFreeformTag(key, value); err != nil {
+			return err
+		}
+	}
+	for key, value := range r.ExtraTags {
+		if isReservedTag(key) {
+			return fmt.Errorf("freeform tag %q is set by the provider", key)
+		}
+		if err := validateFreeformTag(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFreeformTag checks a freeform tag against the constraints of OCI:
+// keys have 1 to 100 characters, without periods, spaces or control
+// characters, and values have at most 256 characters, without control
+// characters.
+func validateFreeformTag(key, value string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("freeform tag keys must not be empty")
+	case utf8.RuneCountInString(key) > maxTagKeyLength:
+		return fmt.Errorf("freeform tag %q: key must be at most %d characters", key, maxTagKeyLength)
+	case strings.ContainsFunc(key, func(r rune) bool { return r == '.' || unicode.IsSpace(r) || unicode.IsControl(r) }):
+		return fmt.Errorf("freeform tag %q: key must not contain periods, spaces or control characters", key)
+	case !utf8.ValidString(value) || utf8.RuneCountInString(value) > maxTagValueLength:
+		return fmt.Errorf("freeform tag %q: value must be at most %d characters", key, maxTagValueLength)
+	case strings.ContainsFunc(value, unicode.IsControl):
+		return fmt.Errorf("freeform tag %q: value must not contain control characters", key)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+// Package tracing wires the provider to OpenTelemetry. Spans are only
+// exported when an OTLP endpoint is configured through the standard
+// OTEL_EXPORTER_OTLP_* environment variables, otherwise they are no-ops.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/cloudbase/garm-provider-oci"
+
+// InstanceNameKey is the attribute holding the name of the GARM instance.
+const InstanceNameKey = attribute.Key("garm.instance.name")
+
+// Setup installs an OTLP exporter as the global tracer provider when one is
+// configured in the environment. The returned function flushes and shuts
+// down the exporter and must be called before the process exits.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// ContextFromEnvironment returns a context carrying the trace of the caller,
+// passed in the TRACEPARENT and TRACESTATE environment variables.
+func ContextFromEnvironment(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// Start starts a span using the global tracer provider. When tracing is not
+// enabled the span is not recorded and the context is returned unchanged.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	spanCtx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+	if !span.IsRecording() {
+		return ctx, span
+	}
+	return spanCtx, span
+}
+
+// End records err, if any, on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WrapDispatcher returns a dispatcher that creates a span for every request
+// an OCI client sends.
+func WrapDispatcher(dispatcher common.HTTPRequestDispatcher) common.HTTPRequestDispatcher {
+	return &tracingDispatcher{dispatcher: dispatcher}
+}
+
+type tracingDispatcher struct {
+	dispatcher common.HTTPRequestDispatcher
+}
+
+func (t *tracingDispatcher) Do(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), operationName(req),
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+	)
+	resp, err := t.dispatcher.Do(req.WithContext(ctx))
+	if resp != nil {
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.String("oci.opc_request_id", resp.Header.Get("opc-request-id")),
+		)
+		if err == nil && resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	End(span, err)
+	return resp, err
+}
+
+// operationName builds the span name from the request method and path, with
+// the API version dropped and OCIDs replaced by a placeholder.
+func operationName(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(segments) > 0 && len(segments[0]) == 8 && strings.Trim(segments[0], "0123456789") == "" {
+		segments = segments[1:]
+	}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "ocid1.") {
+			segments[i] = "{id}"
+		}
+	}
+	return fmt.Sprintf("OCI %s /%s", req.Method, strings.Join(segments, "/"))
+}
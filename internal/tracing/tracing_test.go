@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type dispatcherFunc func(req *http.Request) (*http.Response, error)
+
+func (f dispatcherFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newTestTracerProvider(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return exporter
+}
+
+func TestWrapDispatcher(t *testing.T) {
+	exporter := newTestTracerProvider(t)
+
+	var dispatchedCtx context.Context
+	dispatcher := WrapDispatcher(dispatcherFunc(func(req *http.Request) (*http.Response, error) {
+		dispatchedCtx = req.Context()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Opc-Request-Id": []string{"request-id"}},
+		}, nil
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "https://iaas.us-ashburn-1.oraclecloud.com/20160918/instances/ocid1.instance.oc1.iad.aaaa", nil)
+	require.NoError(t, err)
+	_, err = dispatcher.Do(req)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "OCI GET /instances/{id}", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, spans[0].Attributes, attribute.String("oci.opc_request_id", "request-id"))
+	assert.Equal(t, spans[0].SpanContext.SpanID(), trace.SpanContextFromContext(dispatchedCtx).SpanID())
+}
+
+func TestContextFromEnvironment(t *testing.T) {
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	spanContext := trace.SpanContextFromContext(ContextFromEnvironment(context.Background()))
+	assert.True(t, spanContext.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spanContext.SpanID().String())
+}
@@ -16,10 +16,94 @@
 package util
 
 import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/oracle/oci-go-sdk/v49/core"
 )
 
+// MaxFreeformTagValueLength is the maximum length OCI accepts for the value
+// of a freeform tag.
+const MaxFreeformTagValueLength = 256
+
+// RedactedValue replaces sensitive values before they are logged.
+const RedactedValue = "<redacted>"
+
+// redactedMetadataKeys are the instance metadata keys that hold secrets, like
+// the runner registration token in the user data, and must never be logged.
+var redactedMetadataKeys = []string{
+	"user_data",
+	"ssh_authorized_keys",
+}
+
+// RedactMetadata returns a copy of the instance metadata that is safe to log.
+// Any extra keys given are redacted as well.
+func RedactMetadata(metadata map[string]string, extraKeys ...string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		redacted[key] = value
+	}
+	for _, key := range append(redactedMetadataKeys, extraKeys...) {
+		if _, ok := redacted[key]; ok {
+			redacted[key] = RedactedValue
+		}
+	}
+	return redacted
+}
+
+// envReferenceRegex matches the ${NAME} environment variable references
+// expanded by ExpandEnv.
+var envReferenceRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces the ${NAME} references in value with the value of the
+// environment variable. Unlike os.ExpandEnv, referencing an undefined
+// variable is an error. The returned bool reports whether value referenced
+// any variable.
+func ExpandEnv(value string) (string, bool, error) {
+	var undefined []string
+	expanded := envReferenceRegex.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReferenceRegex.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return envValue
+	})
+	if len(undefined) > 0 {
+		return "", false, fmt.Errorf("undefined environment variable %s", strings.Join(undefined, ", "))
+	}
+	return expanded, envReferenceRegex.MatchString(value), nil
+}
+
+// LabelsToTagValue joins the runner labels into a single comma separated value
+// suitable for a freeform tag. Labels are trimmed, empty labels and labels
+// containing commas are skipped and the result is truncated to the OCI limit
+// without cutting a label in half.
+func LabelsToTagValue(labels []string) string {
+	var value string
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" || strings.Contains(label, ",") {
+			continue
+		}
+		candidate := label
+		if value != "" {
+			candidate = value + "," + label
+		}
+		if len(candidate) > MaxFreeformTagValueLength {
+			break
+		}
+		value = candidate
+	}
+	return value
+}
+
 func OciInstanceToProviderInstance(ociInstance core.Instance) params.ProviderInstance {
 	details := params.ProviderInstance{
 		ProviderID: *ociInstance.Id,
@@ -34,6 +118,10 @@ func OciInstanceToProviderInstance(ociInstance core.Instance) params.ProviderIns
 	case core.InstanceLifecycleStateStopped, core.InstanceLifecycleStateTerminated:
 
 		details.Status = params.InstanceStopped
+	case core.InstanceLifecycleStateProvisioning, core.InstanceLifecycleStateStarting:
+		details.Status = params.InstancePendingCreate
+	case core.InstanceLifecycleStateStopping, core.InstanceLifecycleStateTerminating:
+		details.Status = params.InstancePendingDelete
 	default:
 		details.Status = params.InstanceStatusUnknown
 	}
@@ -16,6 +16,7 @@
 package util
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/cloudbase/garm-provider-common/params"
@@ -85,7 +86,7 @@ func TestOciInstanceToProviderInstance(t *testing.T) {
 				Name:       "name",
 				OSType:     params.Linux,
 				OSArch:     params.Amd64,
-				Status:     params.InstanceStatusUnknown,
+				Status:     params.InstancePendingCreate,
 			},
 		},
 	}
@@ -98,3 +99,116 @@ func TestOciInstanceToProviderInstance(t *testing.T) {
 	}
 
 }
+
+func TestOciInstanceToProviderInstanceStatus(t *testing.T) {
+	tests := []struct {
+		state    core.InstanceLifecycleStateEnum
+		expected params.InstanceStatus
+	}{
+		{state: core.InstanceLifecycleStateMoving, expected: params.InstanceStatusUnknown},
+		{state: core.InstanceLifecycleStateProvisioning, expected: params.InstancePendingCreate},
+		{state: core.InstanceLifecycleStateRunning, expected: params.InstanceRunning},
+		{state: core.InstanceLifecycleStateStarting, expected: params.InstancePendingCreate},
+		{state: core.InstanceLifecycleStateStopping, expected: params.InstancePendingDelete},
+		{state: core.InstanceLifecycleStateStopped, expected: params.InstanceStopped},
+		{state: core.InstanceLifecycleStateCreatingImage, expected: params.InstanceStatusUnknown},
+		{state: core.InstanceLifecycleStateTerminating, expected: params.InstancePendingDelete},
+		{state: core.InstanceLifecycleStateTerminated, expected: params.InstanceStopped},
+	}
+
+	id := "id"
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			actual := OciInstanceToProviderInstance(core.Instance{Id: &id, LifecycleState: tt.state})
+			assert.Equal(t, tt.expected, actual.Status)
+		})
+	}
+}
+
+func TestLabelsToTagValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   []string
+		expected string
+	}{
+		{
+			name:     "no labels",
+			labels:   nil,
+			expected: "",
+		},
+		{
+			name:     "single label",
+			labels:   []string{"linux"},
+			expected: "linux",
+		},
+		{
+			name:     "multiple labels",
+			labels:   []string{"oci", " linux ", "", "x64"},
+			expected: "oci,linux,x64",
+		},
+		{
+			name:     "labels containing commas are skipped",
+			labels:   []string{"oci", "bad,label", "linux"},
+			expected: "oci,linux",
+		},
+		{
+			name:     "truncated to the tag value limit",
+			labels:   []string{strings.Repeat("a", 200), strings.Repeat("b", 100)},
+			expected: strings.Repeat("a", 200),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := LabelsToTagValue(tt.labels)
+			assert.Equal(t, tt.expected, actual)
+			assert.LessOrEqual(t, len(actual), MaxFreeformTagValueLength)
+		})
+	}
+}
+
+func TestRedactMetadata(t *testing.T) {
+	metadata := map[string]string{
+		"user_data":           "c2VjcmV0",
+		"ssh_authorized_keys": "ssh-rsa AAAA",
+		"other":               "value",
+	}
+	redacted := RedactMetadata(metadata)
+	assert.Equal(t, map[string]string{
+		"user_data":           RedactedValue,
+		"ssh_authorized_keys": RedactedValue,
+		"other":               "value",
+	}, redacted)
+	assert.Equal(t, "c2VjcmV0", metadata["user_data"], "the original metadata must not be modified")
+	assert.Nil(t, RedactMetadata(nil))
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GARM_TEST_TOKEN", "s3cr3t")
+	t.Setenv("GARM_TEST_EMPTY", "")
+	tests := []struct {
+		name               string
+		value              string
+		expected           string
+		expectedReferenced bool
+		errString          string
+	}{
+		{name: "no reference", value: "plain $HOME value", expected: "plain $HOME value"},
+		{name: "reference", value: "token=${GARM_TEST_TOKEN}", expected: "token=s3cr3t", expectedReferenced: true},
+		{name: "empty variable", value: "${GARM_TEST_EMPTY}", expected: "", expectedReferenced: true},
+		{name: "undefined variable", value: "${GARM_TEST_TOKEN}${GARM_TEST_UNDEFINED}", errString: "undefined environment variable GARM_TEST_UNDEFINED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expanded, referenced, err := ExpandEnv(tt.value)
+			if tt.errString != "" {
+				assert.EqualError(t, err, tt.errString)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, expanded)
+			assert.Equal(t, tt.expectedReferenced, referenced)
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"syscall"
 
 	"github.com/cloudbase/garm-provider-common/execution"
+	"github.com/cloudbase/garm-provider-oci/internal/tracing"
 	"github.com/cloudbase/garm-provider-oci/provider"
 )
 
@@ -36,24 +37,49 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), signals...)
 	defer stop()
 
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting up tracing: %q", err)
+		os.Exit(1)
+	}
+	exit := func(code int) {
+		shutdownTracing(context.Background())
+		os.Exit(code)
+	}
+	ctx = tracing.ContextFromEnvironment(ctx)
+
+	if len(os.Args) > 1 {
+		command, ok := commands[os.Args[1]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			exit(1)
+		}
+		if err := command(ctx, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %+v\n", os.Args[1], err)
+			exit(1)
+		}
+		exit(0)
+	}
+
 	executionEnv, err := execution.GetEnvironment()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error getting environment: %q", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	prov, err := provider.NewOciProvider(ctx, executionEnv.ProviderConfigFile, executionEnv.ControllerID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating provider: %q", err)
-		os.Exit(1)
+		exit(1)
 	}
 
 	result, err := executionEnv.Run(ctx, prov)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to run command: %+v\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	if len(result) > 0 {
 		fmt.Fprint(os.Stdout, result)
 	}
+	exit(0)
 }
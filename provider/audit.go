@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/core"
+)
+
+// auditRecord describes a launched instance as OCI resolved it, so cost and
+// capacity can be analyzed from the audit records alone.
+type auditRecord struct {
+	InstanceID                  string            `json:"instance_id"`
+	Name                        string            `json:"name"`
+	PoolID                      string            `json:"pool_id"`
+	Timestamp                   time.Time         `json:"timestamp"`
+	Shape                       string            `json:"shape,omitempty"`
+	RequestedShape              string            `json:"requested_shape"`
+	ShapeConfig                 *auditShapeConfig `json:"shape_config,omitempty"`
+	AvailabilityDomain          string            `json:"availability_domain,omitempty"`
+	RequestedAvailabilityDomain string            `json:"requested_availability_domain"`
+	FaultDomain                 string            `json:"fault_domain,omitempty"`
+}
+
+type auditShapeConfig struct {
+	Ocpus                   *float32 `json:"ocpus,omitempty"`
+	MemoryInGBs             *float32 `json:"memory_in_gbs,omitempty"`
+	BaselineOcpuUtilization string   `json:"baseline_ocpu_utilization,omitempty"`
+}
+
+// newAuditRecord records the launched instance as OCI reported it, next to
+// the shape and availability domain of the spec it was requested with.
+// Values OCI didn't report are left out rather than assumed.
+func newAuditRecord(instance core.Instance, spec *spec.RunnerSpec, now time.Time) auditRecord {
+	record := auditRecord{
+		InstanceID:                  stringValue(instance.Id),
+		Name:                        spec.BootstrapParams.Name,
+		PoolID:                      spec.BootstrapParams.PoolID,
+		Timestamp:                   now.UTC(),
+		Shape:                       stringValue(instance.Shape),
+		RequestedShape:              spec.BootstrapParams.Flavor,
+		AvailabilityDomain:          stringValue(instance.AvailabilityDomain),
+		RequestedAvailabilityDomain: spec.AvailabilityDomain,
+		FaultDomain:                 stringValue(instance.FaultDomain),
+	}
+	if instance.ShapeConfig != nil {
+		record.ShapeConfig = &auditShapeConfig{
+			Ocpus:                   instance.ShapeConfig.Ocpus,
+			MemoryInGBs:             instance.ShapeConfig.MemoryInGBs,
+			BaselineOcpuUtilization: string(instance.ShapeConfig.BaselineOcpuUtilization),
+		}
+	}
+	return record
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// writeAudit writes the audit record of the instance to the configured audit
+// directory, if any. Failures are logged and never returned, like webhook
+// notifications.
+func (o *OciProvider) writeAudit(ctx context.Context, instance core.Instance, spec *spec.RunnerSpec) {
+	auditDir := o.ociCli.Config().AuditDir
+	if auditDir == "" {
+		return
+	}
+	record := newAuditRecord(instance, spec, time.Now())
+	if err := writeAuditRecord(auditDir, record); err != nil {
+		slog.WarnContext(ctx, "failed to write audit record", "instance_id", record.InstanceID, "error", err)
+	}
+}
+
+// writeAuditRecord writes the record to a temporary file renamed into place,
+// so readers never see a partial record.
+func writeAuditRecord(auditDir string, record auditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit record: %w", err)
+	}
+	tmp, err := os.CreateTemp(auditDir, ".audit-*.json")
+	if err != nil {
+		return fmt.Errorf("error creating audit record: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing audit record: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing audit record: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing audit record: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(auditDir, record.InstanceID+".json")); err != nil {
+		return fmt.Errorf("error renaming audit record: %w", err)
+	}
+	return nil
+}
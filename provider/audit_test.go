@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/client"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInstanceAudit(t *testing.T) {
+	ctx := context.Background()
+	auditDir := t.TempDir()
+	mockComputeClient := new(client.MockComputeClient)
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return params.RunnerApplicationDownload{
+			OS:           common.String("linux"),
+			Architecture: common.String("amd64"),
+			DownloadURL:  common.String("MockURL"),
+			Filename:     common.String("garm-runner"),
+		}, nil
+	}
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		AuditDir:           auditDir,
+	}
+	bootstrapParams := params.BootstrapInstance{
+		Name:       "garm-instance",
+		Flavor:     "VM.Standard.E4.Flex",
+		Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+		OSType:     params.Linux,
+		OSArch:     params.Amd64,
+		PoolID:     "my-pool",
+		ExtraSpecs: json.RawMessage(`{"ocpus": 2, "memory_in_gbs": 16}`),
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{
+			Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+			Shape:              common.String(bootstrapParams.Flavor),
+			AvailabilityDomain: common.String("ad"),
+			FaultDomain:        common.String("FAULT-DOMAIN-2"),
+			ShapeConfig: &core.InstanceShapeConfig{
+				Ocpus:       common.Float32(2),
+				MemoryInGBs: common.Float32(16),
+			},
+		},
+	}, nil)
+
+	_, err := OciProvider.CreateInstance(ctx, bootstrapParams)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(auditDir, "ocid1.instance.oc1.iad.aaaaaaaamf7.json"))
+	require.NoError(t, err)
+	var record auditRecord
+	require.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "garm-instance", record.Name)
+	assert.Equal(t, "my-pool", record.PoolID)
+	assert.Equal(t, "VM.Standard.E4.Flex", record.Shape)
+	assert.Equal(t, "VM.Standard.E4.Flex", record.RequestedShape)
+	assert.Equal(t, "ad", record.AvailabilityDomain)
+	assert.Equal(t, "FAULT-DOMAIN-2", record.FaultDomain)
+	assert.Equal(t, &auditShapeConfig{Ocpus: common.Float32(2), MemoryInGBs: common.Float32(16)}, record.ShapeConfig)
+	assert.False(t, record.Timestamp.IsZero())
+
+	// Only the record is left in the directory, no temporary files.
+	entries, err := os.ReadDir(auditDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestNewAuditRecord(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	runnerSpec := &spec.RunnerSpec{
+		AvailabilityDomain: "Uocm:US-ASHBURN-AD-1",
+		BootstrapParams: params.BootstrapInstance{
+			Name:   "garm-instance",
+			PoolID: "my-pool",
+			Flavor: "VM.Standard.E5.Flex",
+		},
+	}
+	instance := core.Instance{
+		Id:                 common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		Shape:              common.String("VM.Standard.E4.Flex"),
+		AvailabilityDomain: common.String("Uocm:US-ASHBURN-AD-2"),
+		ShapeConfig: &core.InstanceShapeConfig{
+			Ocpus:                   common.Float32(1),
+			MemoryInGBs:             common.Float32(8),
+			BaselineOcpuUtilization: core.InstanceShapeConfigBaselineOcpuUtilization2,
+		},
+	}
+
+	record := newAuditRecord(instance, runnerSpec, now)
+
+	assert.Equal(t, auditRecord{
+		InstanceID:                  "ocid1.instance.oc1.iad.aaaaaaaamf7",
+		Name:                        "garm-instance",
+		PoolID:                      "my-pool",
+		Timestamp:                   now,
+		Shape:                       "VM.Standard.E4.Flex",
+		RequestedShape:              "VM.Standard.E5.Flex",
+		AvailabilityDomain:          "Uocm:US-ASHBURN-AD-2",
+		RequestedAvailabilityDomain: "Uocm:US-ASHBURN-AD-1",
+		ShapeConfig: &auditShapeConfig{
+			Ocpus:                   common.Float32(1),
+			MemoryInGBs:             common.Float32(8),
+			BaselineOcpuUtilization: "BASELINE_1_2",
+		},
+	}, record)
+
+	// The requested values are not passed off as the ones OCI resolved.
+	record = newAuditRecord(core.Instance{Id: instance.Id}, runnerSpec, now)
+	assert.Empty(t, record.Shape)
+	assert.Empty(t, record.AvailabilityDomain)
+}
+
+func TestWriteAuditRecordReplacesRecord(t *testing.T) {
+	auditDir := t.TempDir()
+	record := auditRecord{InstanceID: "ocid1.instance.oc1.iad.aaaaaaaamf7", Shape: "VM.Standard.E4.Flex"}
+	require.NoError(t, writeAuditRecord(auditDir, record))
+	record.Shape = "VM.Standard.E5.Flex"
+	require.NoError(t, writeAuditRecord(auditDir, record))
+
+	data, err := os.ReadFile(filepath.Join(auditDir, "ocid1.instance.oc1.iad.aaaaaaaamf7.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"shape":"VM.Standard.E5.Flex"`)
+	entries, err := os.ReadDir(auditDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Error(t, writeAuditRecord(filepath.Join(auditDir, "missing"), record))
+}
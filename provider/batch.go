@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cloudbase/garm-provider-common/params"
+)
+
+// maxBatchConcurrency bounds the number of instances a batch launches at the
+// same time.
+const maxBatchConcurrency = 4
+
+// BatchCreateInstances creates one instance per name, concurrently, from the
+// same bootstrap params, to warm up a pool faster than one instance at a
+// time. The instances that were created are returned, in the order of their
+// names, along with an error for each instance that could not be.
+func (o *OciProvider) BatchCreateInstances(ctx context.Context, bootstrapParams params.BootstrapInstance, names []string) ([]params.ProviderInstance, error) {
+	results := make([]*params.ProviderInstance, len(names))
+	errs := make([]error, len(names))
+
+	sem := make(chan struct{}, maxBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("instance %s: %w", name, ctx.Err())
+				return
+			}
+			instanceParams := bootstrapParams
+			instanceParams.Name = name
+			instance, err := o.CreateInstance(ctx, instanceParams)
+			if err != nil {
+				errs[i] = fmt.Errorf("instance %s: %w", name, err)
+				return
+			}
+			results[i] = &instance
+		}()
+	}
+	wg.Wait()
+
+	instances := []params.ProviderInstance{}
+	for _, result := range results {
+		if result != nil {
+			instances = append(instances, *result)
+		}
+	}
+	return instances, errors.Join(errs...)
+}
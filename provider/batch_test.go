@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/client"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchCreateInstances(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return tools[0], nil
+	}
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	bootstrapParams := params.BootstrapInstance{
+		Tools: []params.RunnerApplicationDownload{
+			{
+				OS:           common.String("linux"),
+				Architecture: common.String("amd64"),
+				DownloadURL:  common.String("MockURL"),
+				Filename:     common.String("garm-runner"),
+			},
+		},
+		Flavor:     "VM.Standard.E4.Flex",
+		Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+		OSType:     params.Linux,
+		OSArch:     params.Amd64,
+		PoolID:     "my-pool",
+		ExtraSpecs: json.RawMessage(`{}`),
+	}
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	launching := func(name string) interface{} {
+		return mock.MatchedBy(func(req core.LaunchInstanceRequest) bool {
+			return *req.DisplayName == name
+		})
+	}
+	for _, name := range []string{"runner-1", "runner-3"} {
+		mockComputeClient.On("LaunchInstance", ctx, launching(name)).Return(core.LaunchInstanceResponse{
+			Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad." + name)},
+		}, nil)
+	}
+	mockComputeClient.On("LaunchInstance", ctx, launching("runner-2")).Return(core.LaunchInstanceResponse{}, errors.New("out of host capacity"))
+
+	instances, err := OciProvider.BatchCreateInstances(ctx, bootstrapParams, []string{"runner-1", "runner-2", "runner-3"})
+
+	require.ErrorContains(t, err, "instance runner-2: error creating instance")
+	require.ErrorContains(t, err, "out of host capacity")
+	require.Len(t, instances, 2)
+	assert.Equal(t, "runner-1", instances[0].Name)
+	assert.Equal(t, "ocid1.instance.oc1.iad.runner-1", instances[0].ProviderID)
+	assert.Equal(t, "runner-3", instances[1].Name)
+	assert.Equal(t, "ocid1.instance.oc1.iad.runner-3", instances[1].ProviderID)
+	mockComputeClient.AssertNumberOfCalls(t, "LaunchInstance", 3)
+}
@@ -17,7 +17,12 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
 
 	execution "github.com/cloudbase/garm-provider-common/execution/v0.1.0"
 	"github.com/cloudbase/garm-provider-common/params"
@@ -25,11 +30,19 @@ import (
 	"github.com/cloudbase/garm-provider-oci/internal/client"
 	"github.com/cloudbase/garm-provider-oci/internal/spec"
 	"github.com/cloudbase/garm-provider-oci/internal/util"
+	"github.com/oracle/oci-go-sdk/v49/core"
 )
 
 var _ execution.ExternalProvider = &OciProvider{}
 
-var Version = "v0.0.0-unknown"
+// dryRunEnvVar turns RemoveAllInstances into RemoveAllInstancesDryRun when
+// set to a true value, so operators can check which instances match the
+// controller before a destructive run.
+const dryRunEnvVar = "GARM_OCI_DRY_RUN"
+
+// Version is the version of the provider, set at build time with
+// -ldflags "-X github.com/cloudbase/garm-provider-oci/provider.Version=...".
+var Version = "dev"
 
 func NewOciProvider(ctx context.Context, cfgFile string, controllerID string) (*OciProvider, error) {
 	conf, err := config.NewConfig(cfgFile)
@@ -40,6 +53,12 @@ func NewOciProvider(ctx context.Context, cfgFile string, controllerID string) (*
 	if err != nil {
 		return nil, fmt.Errorf("error creating oci client: %w", err)
 	}
+	ociCli.SetControllerID(controllerID)
+	if conf.ValidateOnStart {
+		if err := ociCli.ValidateAvailabilityDomain(ctx); err != nil {
+			return nil, fmt.Errorf("error validating config: %w", err)
+		}
+	}
 	return &OciProvider{
 		ociCli:       ociCli,
 		controllerID: controllerID,
@@ -61,27 +80,122 @@ func (o *OciProvider) CreateInstance(ctx context.Context, bootstrapParams params
 	if err != nil {
 		return params.ProviderInstance{}, fmt.Errorf("error creating instance: %w", err)
 	}
+	status := util.OciInstanceToProviderInstance(ociInstance).Status
+	if o.ociCli.Config().WaitForRunning {
+		launchedAt := time.Now()
+		timeout := o.ociCli.Config().LaunchTimeout.For(spec.BootVolumeSize)
+		running, err := o.ociCli.WaitForInstanceState(ctx, *ociInstance.Id, core.InstanceLifecycleStateRunning, timeout)
+		if err != nil {
+			if deleteErr := o.ociCli.DeleteInstance(ctx, *ociInstance.Id); deleteErr != nil {
+				slog.WarnContext(ctx, "failed to terminate instance that didn't start", "instance_id", *ociInstance.Id, "error", deleteErr)
+			}
+			return params.ProviderInstance{}, fmt.Errorf("error waiting for instance %s to be running: %w", *ociInstance.Id, err)
+		}
+		// The tag is only informational, the instance is up either way.
+		if err := o.ociCli.TagLaunchDuration(ctx, running, time.Since(launchedAt)); err != nil {
+			slog.WarnContext(ctx, "failed to tag launch duration", "instance_id", *ociInstance.Id, "error", err)
+		}
+		status = util.OciInstanceToProviderInstance(running).Status
+	}
+	if o.ociCli.Config().GarmAPIURL != "" {
+		if err := o.waitForRegistration(ctx, spec.BootstrapParams.Name); err != nil {
+			if deleteErr := o.ociCli.DeleteInstance(ctx, *ociInstance.Id); deleteErr != nil {
+				slog.WarnContext(ctx, "failed to terminate unregistered instance", "instance_id", *ociInstance.Id, "error", deleteErr)
+			}
+			return params.ProviderInstance{}, fmt.Errorf("error waiting for runner %s to register: %w", spec.BootstrapParams.Name, err)
+		}
+	}
 	instance := params.ProviderInstance{
 		ProviderID: *ociInstance.Id,
 		Name:       spec.BootstrapParams.Name,
 		OSType:     spec.BootstrapParams.OSType,
 		OSArch:     spec.BootstrapParams.OSArch,
-		Status:     "running",
+		Status:     status,
 	}
+	o.writeAudit(ctx, ociInstance, spec)
+	o.notifyWebhook(ctx, webhookPayload{
+		Event:      webhookEventCreate,
+		InstanceID: instance.ProviderID,
+		Name:       instance.Name,
+		PoolID:     spec.BootstrapParams.PoolID,
+	})
 	return instance, nil
 }
 
+// GetRunnerSpec returns, as JSON, the spec an instance would be launched
+// with after the defaults, the config and the extra specs are applied. Nothing
+// is launched and secrets are redacted.
+func (o *OciProvider) GetRunnerSpec(ctx context.Context, bootstrapParams params.BootstrapInstance) ([]byte, error) {
+	spec, err := spec.GetRunnerSpecFromBootstrapParams(o.ociCli.Config(), bootstrapParams, o.controllerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting runner spec: %w", err)
+	}
+	return spec.RedactedJSON()
+}
+
+// DriftedInstances returns the instances of the pool that were launched with
+// a spec other than the one the bootstrap params currently resolve to, for
+// example because the extra specs of the pool changed since.
+func (o *OciProvider) DriftedInstances(ctx context.Context, bootstrapParams params.BootstrapInstance) ([]params.ProviderInstance, error) {
+	spec, err := spec.GetRunnerSpecFromBootstrapParams(o.ociCli.Config(), bootstrapParams, o.controllerID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting runner spec: %w", err)
+	}
+	specHash, err := spec.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("error hashing spec: %w", err)
+	}
+	ociInstances, err := o.ociCli.ListDriftedInstances(ctx, bootstrapParams.PoolID, specHash)
+	if err != nil {
+		return nil, fmt.Errorf("error listing drifted instances: %w", err)
+	}
+	providerInstances := []params.ProviderInstance{}
+	for _, ociInstance := range ociInstances {
+		providerInstances = append(providerInstances, util.OciInstanceToProviderInstance(ociInstance))
+	}
+	return providerInstances, nil
+}
+
 func (o *OciProvider) GetInstance(ctx context.Context, instanceID string) (params.ProviderInstance, error) {
 	ociInstance, err := o.ociCli.GetInstance(ctx, instanceID)
 	if err != nil {
 		return params.ProviderInstance{}, fmt.Errorf("error getting instance: %w", err)
 	}
+	return o.providerInstance(ctx, ociInstance), nil
+}
+
+// providerInstance converts the OCI instance and adds the addresses of its
+// primary VNIC. Failing to look the addresses up is not an error, the
+// instance is returned without them.
+func (o *OciProvider) providerInstance(ctx context.Context, ociInstance core.Instance) params.ProviderInstance {
 	providerInstance := util.OciInstanceToProviderInstance(ociInstance)
-	return providerInstance, nil
+	addresses, err := o.ociCli.InstanceAddresses(ctx, ociInstance)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to get instance addresses", "instance_id", providerInstance.ProviderID, "error", err)
+	}
+	providerInstance.Addresses = addresses
+	return providerInstance
 }
 
 func (o *OciProvider) DeleteInstance(ctx context.Context, instanceID string) error {
-	return o.ociCli.DeleteInstance(ctx, instanceID)
+	payload := webhookPayload{
+		Event:      webhookEventDelete,
+		InstanceID: instanceID,
+	}
+	if o.ociCli.Config().WebhookURL != "" {
+		// Look the instance up before it goes away, so the notification
+		// carries its details. Not finding it is not an error here.
+		if ociInstance, err := o.ociCli.GetInstance(ctx, instanceID); err == nil && ociInstance.Id != nil {
+			payload.InstanceID = *ociInstance.Id
+			payload.Name = ociInstance.FreeformTags["Name"]
+			payload.PoolID = ociInstance.FreeformTags["GARM_POOL_ID"]
+		}
+	}
+	if err := o.ociCli.DeleteInstance(ctx, instanceID); err != nil {
+		return err
+	}
+	o.notifyWebhook(ctx, payload)
+	return nil
 }
 
 func (o *OciProvider) ListInstances(ctx context.Context, poolID string) ([]params.ProviderInstance, error) {
@@ -89,25 +203,138 @@ func (o *OciProvider) ListInstances(ctx context.Context, poolID string) ([]param
 	if err != nil {
 		return nil, fmt.Errorf("error listing instances: %w", err)
 	}
-	var providerInstances []params.ProviderInstance
+	providerInstances := []params.ProviderInstance{}
 	for _, ociInstance := range ociInstances {
-		providerInstances = append(providerInstances, util.OciInstanceToProviderInstance(ociInstance))
+		providerInstances = append(providerInstances, o.providerInstance(ctx, ociInstance))
 	}
 	return providerInstances, nil
 }
 
+// MaintenanceEvent describes a runner scheduled for a maintenance reboot.
+type MaintenanceEvent struct {
+	ProviderID string    `json:"provider_id"`
+	Name       string    `json:"name"`
+	PoolID     string    `json:"pool_id"`
+	RebootDue  time.Time `json:"reboot_due"`
+}
+
+// PendingMaintenance lists the runners OCI scheduled for a maintenance
+// reboot, so they can be replaced before the reboot happens.
+func (o *OciProvider) PendingMaintenance(ctx context.Context) ([]MaintenanceEvent, error) {
+	ociInstances, err := o.ociCli.ListInstancesWithPendingMaintenance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing instances with pending maintenance: %w", err)
+	}
+	events := []MaintenanceEvent{}
+	for _, ociInstance := range ociInstances {
+		events = append(events, MaintenanceEvent{
+			ProviderID: *ociInstance.Id,
+			Name:       ociInstance.FreeformTags["Name"],
+			PoolID:     ociInstance.FreeformTags["GARM_POOL_ID"],
+			RebootDue:  ociInstance.TimeMaintenanceRebootDue.Time,
+		})
+	}
+	return events, nil
+}
+
+// RemoveAllInstances terminates all non-terminated instances of the
+// controller. A failed termination doesn't stop the others from being
+// terminated, all failures are returned together. With GARM_OCI_DRY_RUN set,
+// the instances are only logged.
 func (o *OciProvider) RemoveAllInstances(ctx context.Context) error {
+	dryRun, err := dryRunFromEnv()
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		_, err := o.RemoveAllInstancesDryRun(ctx)
+		return err
+	}
+	ociInstances, err := o.ociCli.ListControllerInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing instances: %w", err)
+	}
+	var errs []error
+	for _, ociInstance := range ociInstances {
+		if err := o.ociCli.DeleteInstance(ctx, *ociInstance.Id); err != nil {
+			errs = append(errs, fmt.Errorf("instance %s: %w", *ociInstance.Id, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error removing instances: %w", err)
+	}
 	return nil
 }
 
+// RemoveAllInstancesDryRun logs the instances of the controller that
+// RemoveAllInstances would terminate and returns their OCIDs, without
+// terminating anything.
+func (o *OciProvider) RemoveAllInstancesDryRun(ctx context.Context) ([]string, error) {
+	ociInstances, err := o.ociCli.ListControllerInstances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing instances: %w", err)
+	}
+	ids := []string{}
+	for _, ociInstance := range ociInstances {
+		slog.InfoContext(ctx, "dry run: would terminate instance",
+			"instance_id", *ociInstance.Id,
+			"name", ociInstance.FreeformTags["Name"],
+			"pool_id", ociInstance.FreeformTags["GARM_POOL_ID"])
+		ids = append(ids, *ociInstance.Id)
+	}
+	return ids, nil
+}
+
+// RecycleStaleInstances terminates the instances of the pool that were
+// created more than maxAge ago, so GARM replaces them with fresh ones. It
+// returns the OCIDs of the terminated instances. A failed termination doesn't
+// stop the others from being terminated, all failures are returned together.
+func (o *OciProvider) RecycleStaleInstances(ctx context.Context, poolID string, maxAge time.Duration) ([]string, error) {
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("max age must be positive")
+	}
+	ociInstances, err := o.ociCli.ListStaleInstances(ctx, poolID, maxAge)
+	if err != nil {
+		return nil, fmt.Errorf("error listing stale instances: %w", err)
+	}
+	ids := []string{}
+	var errs []error
+	for _, ociInstance := range ociInstances {
+		if err := o.ociCli.DeleteInstance(ctx, *ociInstance.Id); err != nil {
+			errs = append(errs, fmt.Errorf("instance %s: %w", *ociInstance.Id, err))
+			continue
+		}
+		ids = append(ids, *ociInstance.Id)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return ids, fmt.Errorf("error recycling instances: %w", err)
+	}
+	return ids, nil
+}
+
+// dryRunFromEnv reports whether GARM_OCI_DRY_RUN asks for a dry run. Values
+// that are not booleans are rejected rather than risk a real run.
+func dryRunFromEnv() (bool, error) {
+	value, ok := os.LookupEnv(dryRunEnvVar)
+	if !ok || value == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q, it must be a boolean", dryRunEnvVar, value)
+	}
+	return dryRun, nil
+}
+
 func (o *OciProvider) Stop(ctx context.Context, instance string, force bool) error {
-	return o.ociCli.StopInstance(ctx, instance)
+	return o.ociCli.StopInstance(ctx, instance, force)
 }
 
 func (o *OciProvider) Start(ctx context.Context, instance string) error {
 	return o.ociCli.StartInstance(ctx, instance)
 }
 
+// GetVersion returns the version the provider was built with.
 func (o *OciProvider) GetVersion(ctx context.Context) string {
 	return Version
 }
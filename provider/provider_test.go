@@ -16,9 +16,13 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/cloudbase/garm-provider-oci/config"
@@ -55,7 +59,7 @@ func TestCreateInstance(t *testing.T) {
 	bootstrapParams := params.BootstrapInstance{
 		Name:   "garm-instance",
 		Flavor: "n1-standard-1",
-		Image:  "projects/garm-testing/global/images/garm-image",
+		Image:  "ocid1.image.oc1.iad.aaaaaaaamf7",
 		Tools: []params.RunnerApplicationDownload{
 			{
 				OS:           common.String("linux"),
@@ -84,6 +88,10 @@ func TestCreateInstance(t *testing.T) {
 	OciProvider.ociCli.SetComputeClient(mockComputeClient)
 	OciProvider.ociCli.SetConfig(cfg)
 
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
 	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
 		Instance: core.Instance{
 			Id:                 common.String("garm-instance"),
@@ -107,6 +115,218 @@ func TestCreateInstance(t *testing.T) {
 	assert.Equal(t, expectedInstance, result)
 }
 
+func TestCreateInstanceSubnetOverride(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return params.RunnerApplicationDownload{
+			OS:           common.String("linux"),
+			Architecture: common.String("amd64"),
+			DownloadURL:  common.String("MockURL"),
+			Filename:     common.String("garm-runner"),
+		}, nil
+	}
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "ocid1.subnet.oc1.iad.config",
+		NsgID:              "nsg",
+	}
+	bootstrapParams := params.BootstrapInstance{
+		Name:       "garm-instance",
+		Flavor:     "n1-standard-1",
+		Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+		OSType:     params.Linux,
+		OSArch:     params.Amd64,
+		PoolID:     "my-pool",
+		ExtraSpecs: json.RawMessage(`{"subnet_id": "ocid1.subnet.oc1.iad.pool"}`),
+	}
+
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{
+			Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+			DisplayName:    common.String(bootstrapParams.Name),
+			LifecycleState: core.InstanceLifecycleStateProvisioning,
+		},
+	}, nil)
+
+	_, err := OciProvider.CreateInstance(ctx, bootstrapParams)
+	if !assert.NoError(t, err) {
+		return
+	}
+	req := mockComputeClient.Calls[len(mockComputeClient.Calls)-1].Arguments.Get(1).(core.LaunchInstanceRequest)
+	assert.Equal(t, "ocid1.subnet.oc1.iad.pool", *req.LaunchInstanceDetails.CreateVnicDetails.SubnetId)
+}
+
+func TestCreateInstanceProvisioning(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return params.RunnerApplicationDownload{
+			OS:           common.String("linux"),
+			Architecture: common.String("amd64"),
+			DownloadURL:  common.String("MockURL"),
+			Filename:     common.String("garm-runner"),
+		}, nil
+	}
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+	}
+	bootstrapParams := params.BootstrapInstance{
+		Name:       "garm-instance",
+		Flavor:     "n1-standard-1",
+		Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+		OSType:     params.Linux,
+		OSArch:     params.Amd64,
+		PoolID:     "my-pool",
+		ExtraSpecs: json.RawMessage(`{}`),
+	}
+
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{
+			Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+			DisplayName:    common.String(bootstrapParams.Name),
+			LifecycleState: core.InstanceLifecycleStateProvisioning,
+		},
+	}, nil)
+
+	result, err := OciProvider.CreateInstance(ctx, bootstrapParams)
+	assert.NoError(t, err)
+	assert.Equal(t, params.InstancePendingCreate, result.Status)
+	mockComputeClient.AssertNotCalled(t, "GetInstance", mock.Anything, mock.Anything)
+}
+
+func TestCreateInstanceWaitForRunning(t *testing.T) {
+	running := func(m *client.MockComputeClient) {
+		m.On("GetInstance", mock.Anything, mock.Anything).Return(core.GetInstanceResponse{
+			Instance: core.Instance{
+				Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool"},
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+		}, nil)
+	}
+	tests := []struct {
+		name        string
+		getInstance func(*client.MockComputeClient)
+		updateErr   error
+		errString   string
+	}{
+		{
+			name:        "running",
+			getInstance: running,
+		},
+		{
+			name:        "tagging the launch duration fails",
+			getInstance: running,
+			updateErr:   errors.New("conflict"),
+		},
+		{
+			name: "gone before running",
+			getInstance: func(m *client.MockComputeClient) {
+				m.On("GetInstance", mock.Anything, mock.Anything).Return(
+					core.GetInstanceResponse{}, client.MockServiceError{StatusCode: 404, Code: "NotAuthorizedOrNotFound"})
+			},
+			errString: "error waiting for instance ocid1.instance.oc1.iad.aaaaaaaamf7 to be running",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(client.MockComputeClient)
+			spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+				return params.RunnerApplicationDownload{
+					OS:           common.String("linux"),
+					Architecture: common.String("amd64"),
+					DownloadURL:  common.String("MockURL"),
+					Filename:     common.String("garm-runner"),
+				}, nil
+			}
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				WaitForRunning:     true,
+			}
+			bootstrapParams := params.BootstrapInstance{
+				Name:       "garm-instance",
+				Flavor:     "n1-standard-1",
+				Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+				OSType:     params.Linux,
+				OSArch:     params.Amd64,
+				PoolID:     "my-pool",
+				ExtraSpecs: json.RawMessage(`{}`),
+			}
+			OciProvider := OciProvider{
+				ociCli:       &client.OciCli{},
+				controllerID: "controller",
+			}
+			OciProvider.ociCli.SetComputeClient(mockComputeClient)
+			OciProvider.ociCli.SetConfig(cfg)
+
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{
+					Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+					LifecycleState: core.InstanceLifecycleStateProvisioning,
+				},
+			}, nil)
+			mockComputeClient.On("TerminateInstance", ctx, mock.Anything).Return(core.TerminateInstanceResponse{}, nil)
+			mockComputeClient.On("UpdateInstance", ctx, mock.Anything).Return(core.UpdateInstanceResponse{}, tt.updateErr)
+			tt.getInstance(mockComputeClient)
+
+			result, err := OciProvider.CreateInstance(ctx, bootstrapParams)
+			if tt.errString != "" {
+				assert.ErrorContains(t, err, tt.errString)
+				mockComputeClient.AssertCalled(t, "TerminateInstance", ctx, core.TerminateInstanceRequest{InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"), PreserveBootVolume: common.Bool(false)})
+				mockComputeClient.AssertNotCalled(t, "UpdateInstance", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, params.InstanceRunning, result.Status)
+			mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+			// The duration is tagged once the wait completes, keeping the
+			// tags the instance already has.
+			mockComputeClient.AssertCalled(t, "UpdateInstance", ctx, core.UpdateInstanceRequest{
+				InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				UpdateInstanceDetails: core.UpdateInstanceDetails{
+					FreeformTags: map[string]string{"GARM_POOL_ID": "my-pool", "GARM_LAUNCH_SECONDS": "0"},
+				},
+			})
+		})
+	}
+}
+
 func TestGetInstancewithName(t *testing.T) {
 	ctx := context.Background()
 	mockComputeClient := new(client.MockComputeClient)
@@ -218,6 +438,76 @@ func TestGetInstancewithId(t *testing.T) {
 
 }
 
+func TestGetInstanceAddresses(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	mockNetworkClient := new(client.MockNetworkClient)
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		TenancyID:          "tenancy",
+		UserID:             "user",
+		Region:             "region",
+		Fingerprint:        "fingerprint",
+		PrivateKeyPath:     "private_key_path",
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetNetworkClient(mockNetworkClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	ociInstance := core.Instance{
+		Id:            &inst,
+		CompartmentId: common.String("compartment"),
+		FreeformTags: map[string]string{
+			"Name":               "garm-instance",
+			"GARM_POOL_ID":       "my-pool",
+			"OSType":             "linux",
+			"OSArch":             "amd64",
+			"GARM_CONTROLLER_ID": "controller",
+		},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	expectedInstance := params.ProviderInstance{
+		ProviderID: inst,
+		Name:       "garm-instance",
+		OSType:     "linux",
+		OSArch:     "amd64",
+		Status:     "running",
+		Addresses: []params.Address{
+			{Address: "10.0.0.5", Type: params.PrivateAddress},
+			{Address: "203.0.113.10", Type: params.PublicAddress},
+		},
+	}
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: &inst,
+	}).Return(core.GetInstanceResponse{Instance: ociInstance}, nil)
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{Items: []core.Instance{ociInstance}}, nil)
+	mockComputeClient.On("ListVnicAttachments", ctx, mock.Anything).Return(core.ListVnicAttachmentsResponse{
+		Items: []core.VnicAttachment{
+			{VnicId: common.String("ocid1.vnic.oc1..primary"), LifecycleState: core.VnicAttachmentLifecycleStateAttached},
+		},
+	}, nil)
+	mockNetworkClient.On("GetVnic", ctx, core.GetVnicRequest{VnicId: common.String("ocid1.vnic.oc1..primary")}).Return(core.GetVnicResponse{
+		Vnic: core.Vnic{IsPrimary: common.Bool(true), PrivateIp: common.String("10.0.0.5"), PublicIp: common.String("203.0.113.10")},
+	}, nil)
+
+	result, err := OciProvider.GetInstance(ctx, inst)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedInstance, result)
+
+	results, err := OciProvider.ListInstances(ctx, "my-pool")
+	assert.NoError(t, err)
+	assert.Equal(t, []params.ProviderInstance{expectedInstance}, results)
+}
+
 func TestDeleteInstanceWithName(t *testing.T) {
 	ctx := context.Background()
 	mockComputeClient := new(client.MockComputeClient)
@@ -251,7 +541,8 @@ func TestDeleteInstanceWithName(t *testing.T) {
 			LifecycleState:     core.InstanceLifecycleStateRunning,
 		}}}, nil)
 	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
-		InstanceId: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		InstanceId:         common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+		PreserveBootVolume: common.Bool(false),
 	}).Return(core.TerminateInstanceResponse{}, nil)
 
 	err := OciProvider.DeleteInstance(ctx, inst)
@@ -279,8 +570,14 @@ func TestDeleteInstanceWithId(t *testing.T) {
 	OciProvider.ociCli.SetComputeClient(mockComputeClient)
 	OciProvider.ociCli.SetConfig(cfg)
 	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
-	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
 		InstanceId: &inst,
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: &inst},
+	}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         &inst,
+		PreserveBootVolume: common.Bool(false),
 	}).Return(core.TerminateInstanceResponse{}, nil)
 
 	err := OciProvider.DeleteInstance(ctx, inst)
@@ -359,7 +656,7 @@ func TestListInstance(t *testing.T) {
 	assert.Equal(t, expectedInstance, result)
 }
 
-func TestStop(t *testing.T) {
+func TestListInstanceEmptyPool(t *testing.T) {
 	ctx := context.Background()
 	mockComputeClient := new(client.MockComputeClient)
 	cfg := &config.Config{
@@ -379,14 +676,425 @@ func TestStop(t *testing.T) {
 	}
 	OciProvider.ociCli.SetComputeClient(mockComputeClient)
 	OciProvider.ociCli.SetConfig(cfg)
-	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
-	mockComputeClient.On("InstanceAction", ctx, core.InstanceActionRequest{
-		InstanceId: &inst,
-		Action:     core.InstanceActionActionStop,
-	}).Return(core.InstanceActionResponse{}, nil)
 
-	err := OciProvider.Stop(ctx, inst, false)
-	assert.Nil(t, err)
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{}, nil)
+
+	result, err := OciProvider.ListInstances(ctx, "unknown-pool")
+	assert.NoError(t, err)
+	assert.NotNil(t, result)
+	assert.Len(t, result, 0)
+}
+
+func TestRemoveAllInstancesDryRun(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	OciProvider.ociCli.SetControllerID("controller")
+
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{
+		Items: []core.Instance{
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+				FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf8"),
+				FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+				LifecycleState: core.InstanceLifecycleStateStopped,
+			},
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.terminated"),
+				FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+				LifecycleState: core.InstanceLifecycleStateTerminated,
+			},
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.foreign"),
+				FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "other-controller", "GARM_POOL_ID": "my-pool"},
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+		},
+	}, nil)
+
+	result, err := OciProvider.RemoveAllInstancesDryRun(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ocid1.instance.oc1.iad.aaaaaaaamf7", "ocid1.instance.oc1.iad.aaaaaaaamf8"}, result)
+	mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+}
+
+func TestRemoveAllInstances(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	OciProvider.ociCli.SetControllerID("controller")
+
+	instances := []core.Instance{
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+			FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+		},
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf8"),
+			FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+			LifecycleState: core.InstanceLifecycleStateStopped,
+		},
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.foreign"),
+			FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "other-controller", "GARM_POOL_ID": "my-pool"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+		},
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.poolless"),
+			FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+		},
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{Items: instances}, nil)
+	for _, instance := range instances[:2] {
+		mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+			InstanceId: instance.Id,
+		}).Return(core.GetInstanceResponse{Instance: instance}, nil)
+	}
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         instances[0].Id,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, errors.New("conflict"))
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         instances[1].Id,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := OciProvider.RemoveAllInstances(ctx)
+	assert.ErrorContains(t, err, "instance ocid1.instance.oc1.iad.aaaaaaaamf7: error terminating instance: conflict")
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 2)
+	mockComputeClient.AssertCalled(t, "TerminateInstance", ctx, core.TerminateInstanceRequest{InstanceId: instances[1].Id, PreserveBootVolume: common.Bool(false)})
+	mockComputeClient.AssertNotCalled(t, "TerminateInstance", ctx, core.TerminateInstanceRequest{InstanceId: instances[2].Id, PreserveBootVolume: common.Bool(false)})
+	mockComputeClient.AssertNotCalled(t, "TerminateInstance", ctx, core.TerminateInstanceRequest{InstanceId: instances[3].Id, PreserveBootVolume: common.Bool(false)})
+}
+
+func TestRemoveAllInstancesWithoutControllerID(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	OciProvider := OciProvider{
+		ociCli: &client.OciCli{},
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	mockComputeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{
+		Items: []core.Instance{
+			{
+				Id:             common.String("ocid1.instance.oc1.iad.untagged"),
+				LifecycleState: core.InstanceLifecycleStateRunning,
+			},
+		},
+	}, nil).Maybe()
+	mockComputeClient.On("TerminateInstance", ctx, mock.Anything).Return(core.TerminateInstanceResponse{}, nil).Maybe()
+
+	err := OciProvider.RemoveAllInstances(ctx)
+	assert.EqualError(t, err, "error listing instances: controller ID is not set")
+	mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+}
+
+func TestRemoveAllInstancesDryRunFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		terminates bool
+		errString  string
+	}{
+		{name: "dry run", value: "true", terminates: false},
+		{name: "real run", value: "false", terminates: true},
+		{name: "unset", value: "", terminates: true},
+		{name: "invalid", value: "maybe", errString: `invalid GARM_OCI_DRY_RUN "maybe", it must be a boolean`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GARM_OCI_DRY_RUN", tt.value)
+			var logs bytes.Buffer
+			defaultLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+			defer slog.SetDefault(defaultLogger)
+
+			ctx := context.Background()
+			mockComputeClient := new(client.MockComputeClient)
+			cfg := &config.Config{
+				CompartmentId: "compartment",
+			}
+			OciProvider := OciProvider{
+				ociCli:       &client.OciCli{},
+				controllerID: "controller",
+			}
+			OciProvider.ociCli.SetComputeClient(mockComputeClient)
+			OciProvider.ociCli.SetConfig(cfg)
+			OciProvider.ociCli.SetControllerID("controller")
+
+			instances := []core.Instance{
+				{
+					Id:             common.String("ocid1.instance.oc1.iad.aaaaaaaamf7"),
+					FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+					LifecycleState: core.InstanceLifecycleStateRunning,
+				},
+				{
+					Id:             common.String("ocid1.instance.oc1.iad.foreign"),
+					FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "other-controller", "GARM_POOL_ID": "my-pool"},
+					LifecycleState: core.InstanceLifecycleStateRunning,
+				},
+			}
+			mockComputeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{Items: instances}, nil)
+			mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: instances[0].Id,
+			}).Return(core.GetInstanceResponse{Instance: instances[0]}, nil)
+			mockComputeClient.On("TerminateInstance", ctx, mock.Anything).Return(core.TerminateInstanceResponse{}, nil)
+
+			err := OciProvider.RemoveAllInstances(ctx)
+			if tt.errString != "" {
+				assert.EqualError(t, err, tt.errString)
+				mockComputeClient.AssertNotCalled(t, "ListInstances", mock.Anything, mock.Anything)
+				mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.terminates {
+				mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 1)
+				mockComputeClient.AssertCalled(t, "TerminateInstance", ctx, core.TerminateInstanceRequest{InstanceId: instances[0].Id, PreserveBootVolume: common.Bool(false)})
+				assert.NotContains(t, logs.String(), "dry run")
+				return
+			}
+			mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+			var record map[string]interface{}
+			assert.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+			assert.Equal(t, "dry run: would terminate instance", record["msg"])
+			assert.Equal(t, "ocid1.instance.oc1.iad.aaaaaaaamf7", record["instance_id"])
+			assert.Equal(t, "my-pool", record["pool_id"])
+		})
+	}
+}
+
+func TestRecycleStaleInstances(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+	}
+	OciProvider := OciProvider{
+		ociCli: &client.OciCli{},
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	created := func(age time.Duration) *common.SDKTime {
+		return &common.SDKTime{Time: time.Now().Add(-age)}
+	}
+	instances := []core.Instance{
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.old"),
+			FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+			TimeCreated:    created(48 * time.Hour),
+		},
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.new"),
+			FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+			TimeCreated:    created(time.Hour),
+		},
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.terminating"),
+			FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool"},
+			LifecycleState: core.InstanceLifecycleStateTerminating,
+			TimeCreated:    created(48 * time.Hour),
+		},
+		{
+			Id:             common.String("ocid1.instance.oc1.iad.other-pool"),
+			FreeformTags:   map[string]string{"GARM_POOL_ID": "other-pool"},
+			LifecycleState: core.InstanceLifecycleStateRunning,
+			TimeCreated:    created(48 * time.Hour),
+		},
+	}
+	mockComputeClient.On("ListInstances", ctx, core.ListInstancesRequest{
+		CompartmentId: &cfg.CompartmentId,
+	}).Return(core.ListInstancesResponse{Items: instances}, nil)
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: instances[0].Id,
+	}).Return(core.GetInstanceResponse{Instance: instances[0]}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         instances[0].Id,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	result, err := OciProvider.RecycleStaleInstances(ctx, "my-pool", 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ocid1.instance.oc1.iad.old"}, result)
+	mockComputeClient.AssertNumberOfCalls(t, "TerminateInstance", 1)
+}
+
+func TestRecycleStaleInstancesInAdditionalRegion(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	regionComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId:     "compartment",
+		Region:            "us-ashburn-1",
+		AdditionalRegions: []string{"us-phoenix-1"},
+	}
+	OciProvider := OciProvider{
+		ociCli: &client.OciCli{},
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetRegionComputeClient("us-phoenix-1", regionComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	stale := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.phx.old"),
+		FreeformTags:   map[string]string{"GARM_POOL_ID": "my-pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+		TimeCreated:    &common.SDKTime{Time: time.Now().Add(-48 * time.Hour)},
+	}
+	mockComputeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{}, nil)
+	regionComputeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{Items: []core.Instance{stale}}, nil)
+	regionComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: stale.Id,
+	}).Return(core.GetInstanceResponse{Instance: stale}, nil)
+	regionComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         stale.Id,
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	result, err := OciProvider.RecycleStaleInstances(ctx, "my-pool", 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ocid1.instance.oc1.phx.old"}, result)
+	mockComputeClient.AssertNotCalled(t, "TerminateInstance", mock.Anything, mock.Anything)
+}
+
+func TestRemoveAllInstancesInAdditionalRegion(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	regionComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId:     "compartment",
+		Region:            "us-ashburn-1",
+		AdditionalRegions: []string{"us-phoenix-1"},
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetRegionComputeClient("us-phoenix-1", regionComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	OciProvider.ociCli.SetControllerID("controller")
+
+	homeInstance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.iad.aaaa"),
+		FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	regionInstance := core.Instance{
+		Id:             common.String("ocid1.instance.oc1.phx.bbbb"),
+		FreeformTags:   map[string]string{"GARM_CONTROLLER_ID": "controller", "GARM_POOL_ID": "my-pool"},
+		LifecycleState: core.InstanceLifecycleStateRunning,
+	}
+	for computeClient, instance := range map[*client.MockComputeClient]core.Instance{mockComputeClient: homeInstance, regionComputeClient: regionInstance} {
+		computeClient.On("ListInstances", ctx, mock.Anything).Return(core.ListInstancesResponse{Items: []core.Instance{instance}}, nil)
+		computeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+			InstanceId: instance.Id,
+		}).Return(core.GetInstanceResponse{Instance: instance}, nil)
+		computeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+			InstanceId:         instance.Id,
+			PreserveBootVolume: common.Bool(false),
+		}).Return(core.TerminateInstanceResponse{}, nil)
+	}
+
+	err := OciProvider.RemoveAllInstances(ctx)
+	assert.NoError(t, err)
+	mockComputeClient.AssertExpectations(t)
+	regionComputeClient.AssertExpectations(t)
+}
+
+func TestRecycleStaleInstancesInvalidMaxAge(t *testing.T) {
+	ctx := context.Background()
+	mockComputeClient := new(client.MockComputeClient)
+	OciProvider := OciProvider{
+		ociCli: &client.OciCli{},
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(&config.Config{})
+
+	_, err := OciProvider.RecycleStaleInstances(ctx, "my-pool", 0)
+	assert.EqualError(t, err, "max age must be positive")
+	mockComputeClient.AssertNotCalled(t, "ListInstances", mock.Anything, mock.Anything)
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		force    bool
+		expected core.InstanceActionActionEnum
+	}{
+		{name: "stop", force: false, expected: core.InstanceActionActionSoftstop},
+		{name: "forced", force: true, expected: core.InstanceActionActionStop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockComputeClient := new(client.MockComputeClient)
+			cfg := &config.Config{
+				AvailabilityDomain: "ad",
+				CompartmentId:      "compartment",
+				SubnetID:           "subnet",
+				NsgID:              "nsg",
+				TenancyID:          "tenancy",
+				UserID:             "user",
+				Region:             "region",
+				Fingerprint:        "fingerprint",
+				PrivateKeyPath:     "private_key_path",
+			}
+			OciProvider := OciProvider{
+				ociCli:       &client.OciCli{},
+				controllerID: "controller",
+			}
+			OciProvider.ociCli.SetComputeClient(mockComputeClient)
+			OciProvider.ociCli.SetConfig(cfg)
+			inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+			mockComputeClient.On("InstanceAction", ctx, core.InstanceActionRequest{
+				InstanceId: &inst,
+				Action:     tt.expected,
+			}).Return(core.InstanceActionResponse{}, nil)
+
+			err := OciProvider.Stop(ctx, inst, tt.force)
+			assert.Nil(t, err)
+			mockComputeClient.AssertNumberOfCalls(t, "InstanceAction", 1)
+		})
+	}
 }
 
 func TestStart(t *testing.T) {
@@ -418,3 +1126,13 @@ func TestStart(t *testing.T) {
 	err := OciProvider.Start(ctx, inst)
 	assert.Nil(t, err)
 }
+
+func TestGetVersion(t *testing.T) {
+	OciProvider := OciProvider{}
+	assert.Equal(t, "dev", OciProvider.GetVersion(context.Background()))
+
+	defaultVersion := Version
+	defer func() { Version = defaultVersion }()
+	Version = "v0.2.0"
+	assert.Equal(t, "v0.2.0", OciProvider.GetVersion(context.Background()))
+}
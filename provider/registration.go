@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// registrationPollInterval is how often the GARM API is polled while waiting
+// for a runner to register.
+var registrationPollInterval = 10 * time.Second
+
+// garmInstance holds the fields of a GARM instance the registration gate
+// looks at.
+type garmInstance struct {
+	RunnerStatus string `json:"runner_status"`
+}
+
+// errRunnerFailed is returned when GARM reports the runner failed to install.
+var errRunnerFailed = errors.New("runner failed")
+
+// waitForRegistration polls the GARM API until the runner registers, that is
+// until GARM reports it idle or active, or until the registration timeout
+// expires.
+func (o *OciProvider) waitForRegistration(ctx context.Context, name string) error {
+	cfg := o.ociCli.Config()
+	timeout := cfg.RegistrationTimeoutDuration()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		status, err := getRunnerStatus(ctx, cfg.GarmAPIURL, cfg.GarmAPIToken, name)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				lastErr = err
+			}
+		case status == "idle" || status == "active":
+			return nil
+		case status == "failed":
+			return errRunnerFailed
+		}
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("runner did not register within %s: %w", timeout, lastErr)
+			}
+			return fmt.Errorf("runner did not register within %s", timeout)
+		case <-time.After(registrationPollInterval):
+		}
+	}
+}
+
+func getRunnerStatus(ctx context.Context, garmAPIURL, token, name string) (string, error) {
+	endpoint := strings.TrimSuffix(garmAPIURL, "/") + "/api/v1/instances/" + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var instance garmInstance
+	if err := json.NewDecoder(resp.Body).Decode(&instance); err != nil {
+		return "", fmt.Errorf("error decoding instance: %w", err)
+	}
+	return instance.RunnerStatus, nil
+}
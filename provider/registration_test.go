@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/client"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newGarmAPIServer serves the given runner statuses in order, repeating the
+// last one.
+func newGarmAPIServer(t *testing.T, statuses ...string) *httptest.Server {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/instances/garm-instance", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		call := int(calls.Add(1)) - 1
+		status := statuses[min(call, len(statuses)-1)]
+		assert.NoError(t, json.NewEncoder(w).Encode(garmInstance{RunnerStatus: status}))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCreateInstanceRegistrationGate(t *testing.T) {
+	interval := registrationPollInterval
+	registrationPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { registrationPollInterval = interval })
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return params.RunnerApplicationDownload{
+			OS:           common.String("linux"),
+			Architecture: common.String("amd64"),
+			DownloadURL:  common.String("MockURL"),
+			Filename:     common.String("garm-runner"),
+		}, nil
+	}
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+	tests := []struct {
+		name       string
+		statuses   []string
+		errString  string
+		terminated bool
+	}{
+		{
+			name:     "registered",
+			statuses: []string{"pending", "installing", "idle"},
+		},
+		{
+			name:       "timeout",
+			statuses:   []string{"installing"},
+			errString:  "error waiting for runner garm-instance to register: runner did not register within 1s",
+			terminated: true,
+		},
+		{
+			name:       "runner failed",
+			statuses:   []string{"installing", "failed"},
+			errString:  "error waiting for runner garm-instance to register: runner failed",
+			terminated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := newGarmAPIServer(t, tt.statuses...)
+			mockComputeClient := new(client.MockComputeClient)
+			cfg := &config.Config{
+				AvailabilityDomain:  "ad",
+				CompartmentId:       "compartment",
+				SubnetID:            "subnet",
+				NsgID:               "nsg",
+				GarmAPIURL:          server.URL,
+				GarmAPIToken:        "token",
+				RegistrationTimeout: "1s",
+			}
+			bootstrapParams := params.BootstrapInstance{
+				Name:       "garm-instance",
+				Flavor:     "VM.Standard.E4.Flex",
+				Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+				OSType:     params.Linux,
+				OSArch:     params.Amd64,
+				PoolID:     "my-pool",
+				ExtraSpecs: json.RawMessage(`{}`),
+			}
+			OciProvider := OciProvider{
+				ociCli:       &client.OciCli{},
+				controllerID: "controller",
+			}
+			OciProvider.ociCli.SetComputeClient(mockComputeClient)
+			OciProvider.ociCli.SetConfig(cfg)
+
+			mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+				Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+			}, nil)
+			mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+			mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+				Instance: core.Instance{Id: common.String(inst)},
+			}, nil)
+			mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+				InstanceId: common.String(inst),
+			}).Return(core.GetInstanceResponse{
+				Instance: core.Instance{Id: common.String(inst)},
+			}, nil)
+			mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+				InstanceId:         common.String(inst),
+				PreserveBootVolume: common.Bool(false),
+			}).Return(core.TerminateInstanceResponse{}, nil)
+
+			instance, err := OciProvider.CreateInstance(ctx, bootstrapParams)
+			if tt.errString != "" {
+				require.EqualError(t, err, tt.errString)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, inst, instance.ProviderID)
+			}
+			if tt.terminated {
+				mockComputeClient.AssertCalled(t, "TerminateInstance", ctx, mock.Anything)
+			} else {
+				mockComputeClient.AssertNotCalled(t, "TerminateInstance", ctx, mock.Anything)
+			}
+		})
+	}
+}
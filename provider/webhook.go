@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookEventCreate = "create"
+	webhookEventDelete = "delete"
+
+	webhookTimeout = 10 * time.Second
+)
+
+type webhookPayload struct {
+	Event      string    `json:"event"`
+	InstanceID string    `json:"instance_id"`
+	Name       string    `json:"name"`
+	PoolID     string    `json:"pool_id"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// notifyWebhook posts the payload to the configured webhook, if any. Failures
+// are logged and never returned, a broken webhook must not break the provider.
+func (o *OciProvider) notifyWebhook(ctx context.Context, payload webhookPayload) {
+	webhookURL := o.ociCli.Config().WebhookURL
+	if webhookURL == "" {
+		return
+	}
+	payload.Timestamp = time.Now().UTC()
+	if err := postWebhook(ctx, webhookURL, payload); err != nil {
+		slog.WarnContext(ctx, "failed to send webhook notification", "event", payload.Event, "instance_id", payload.InstanceID, "error", err)
+	}
+}
+
+func postWebhook(ctx context.Context, webhookURL string, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
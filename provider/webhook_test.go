@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright 2024 Cloudbase Solutions SRL
+//
+//    Licensed under the Apache License, Version 2.0 (the "License"); you may
+//    not use this file except in compliance with the License. You may obtain
+//    a copy of the License at
+//
+//         http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+//    WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+//    License for the specific language governing permissions and limitations
+//    under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/cloudbase/garm-provider-oci/config"
+	"github.com/cloudbase/garm-provider-oci/internal/client"
+	"github.com/cloudbase/garm-provider-oci/internal/spec"
+	"github.com/oracle/oci-go-sdk/v49/common"
+	"github.com/oracle/oci-go-sdk/v49/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newWebhookServer(t *testing.T) (*httptest.Server, chan webhookPayload) {
+	payloads := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var payload webhookPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, payloads
+}
+
+func TestCreateInstanceWebhook(t *testing.T) {
+	ctx := context.Background()
+	server, payloads := newWebhookServer(t)
+	mockComputeClient := new(client.MockComputeClient)
+	spec.DefaultToolFetch = func(osType params.OSType, osArch params.OSArch, tools []params.RunnerApplicationDownload) (params.RunnerApplicationDownload, error) {
+		return params.RunnerApplicationDownload{
+			OS:           common.String("linux"),
+			Architecture: common.String("amd64"),
+			DownloadURL:  common.String("MockURL"),
+			Filename:     common.String("garm-runner"),
+		}, nil
+	}
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		WebhookURL:         server.URL,
+	}
+	bootstrapParams := params.BootstrapInstance{
+		Name:       "garm-instance",
+		Flavor:     "VM.Standard.E4.Flex",
+		Image:      "ocid1.image.oc1.iad.aaaaaaaamf7",
+		OSType:     params.Linux,
+		OSArch:     params.Amd64,
+		PoolID:     "my-pool",
+		ExtraSpecs: json.RawMessage(`{}`),
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+
+	mockComputeClient.On("ListShapes", ctx, mock.Anything).Return(core.ListShapesResponse{
+		Items: []core.Shape{{Shape: common.String(bootstrapParams.Flavor)}},
+	}, nil)
+	mockComputeClient.On("GetImage", ctx, mock.Anything).Return(core.GetImageResponse{}, nil)
+	mockComputeClient.On("LaunchInstance", ctx, mock.Anything).Return(core.LaunchInstanceResponse{
+		Instance: core.Instance{Id: common.String("ocid1.instance.oc1.iad.aaaaaaaamf7")},
+	}, nil)
+
+	_, err := OciProvider.CreateInstance(ctx, bootstrapParams)
+	require.NoError(t, err)
+
+	payload := <-payloads
+	assert.Equal(t, webhookEventCreate, payload.Event)
+	assert.Equal(t, "ocid1.instance.oc1.iad.aaaaaaaamf7", payload.InstanceID)
+	assert.Equal(t, "garm-instance", payload.Name)
+	assert.Equal(t, "my-pool", payload.PoolID)
+	assert.False(t, payload.Timestamp.IsZero())
+}
+
+func TestDeleteInstanceWebhook(t *testing.T) {
+	ctx := context.Background()
+	server, payloads := newWebhookServer(t)
+	mockComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		AvailabilityDomain: "ad",
+		CompartmentId:      "compartment",
+		SubnetID:           "subnet",
+		NsgID:              "nsg",
+		WebhookURL:         server.URL,
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+
+	mockComputeClient.On("GetInstance", ctx, core.GetInstanceRequest{
+		InstanceId: common.String(inst),
+	}).Return(core.GetInstanceResponse{
+		Instance: core.Instance{
+			Id: common.String(inst),
+			FreeformTags: map[string]string{
+				"Name":         "garm-instance",
+				"GARM_POOL_ID": "my-pool",
+			},
+		},
+	}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, core.TerminateInstanceRequest{
+		InstanceId:         common.String(inst),
+		PreserveBootVolume: common.Bool(false),
+	}).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := OciProvider.DeleteInstance(ctx, inst)
+	require.NoError(t, err)
+
+	payload := <-payloads
+	assert.Equal(t, webhookEventDelete, payload.Event)
+	assert.Equal(t, inst, payload.InstanceID)
+	assert.Equal(t, "garm-instance", payload.Name)
+	assert.Equal(t, "my-pool", payload.PoolID)
+	assert.False(t, payload.Timestamp.IsZero())
+}
+
+func TestWebhookFailureIsIgnored(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	mockComputeClient := new(client.MockComputeClient)
+	cfg := &config.Config{
+		CompartmentId: "compartment",
+		WebhookURL:    server.URL,
+	}
+	OciProvider := OciProvider{
+		ociCli:       &client.OciCli{},
+		controllerID: "controller",
+	}
+	OciProvider.ociCli.SetComputeClient(mockComputeClient)
+	OciProvider.ociCli.SetConfig(cfg)
+	inst := "ocid1.instance.oc1.iad.aaaaaaaamf7"
+
+	mockComputeClient.On("GetInstance", ctx, mock.Anything).Return(core.GetInstanceResponse{
+		Instance: core.Instance{Id: common.String(inst)},
+	}, nil)
+	mockComputeClient.On("TerminateInstance", ctx, mock.Anything).Return(core.TerminateInstanceResponse{}, nil)
+
+	err := OciProvider.DeleteInstance(ctx, inst)
+	assert.NoError(t, err)
+	assert.Error(t, postWebhook(ctx, server.URL, webhookPayload{Event: webhookEventDelete}))
+}